@@ -5,8 +5,8 @@ import (
 	"common/rtpengine/rtp"
 	"common/rtpengine/rtp/codecs"
 	"common/web"
-	"encoding/json"
 	"flag"
+	"fmt"
 	"github.com/pterm/pterm"
 	"net"
 	"os"
@@ -14,9 +14,9 @@ import (
 	"time"
 	"xmediaEmu/pkg/cws"
 	"xmediaEmu/pkg/cws/entity"
-	"xmediaEmu/pkg/emulator/rtpua"
 	"xmediaEmu/pkg/log"
 	"xmediaEmu/pkg/media/h264writer"
+	"xmediaEmu/pkg/media/sdp"
 )
 
 //
@@ -76,6 +76,7 @@ func Connect(url string, stop chan bool) *WsSender {
 	ws.cwsClient = cws.NewClient("testWorkServer", ws.wsClient)
 	// 注册回调函数处理响应.
 	ws.cwsClient.Receive(entity.RoomStarted, ws.OnHandleRoomStart())
+	ws.cwsClient.Receive(entity.GameEvent, ws.OnHandleGameEvent())
 	// ws.cwsClient.Receive(entity.RegisterRoom, ws.OnHandleRoomStart())
 
 	// 开启异步接收协程
@@ -84,6 +85,15 @@ func Connect(url string, stop chan bool) *WsSender {
 		pterm.FgRed.Printfln("The ws url %q connect fail:%q", url, err)
 		os.Exit(-1)
 	}
+
+	// 协商协议版本.
+	hello, _ := (&entity.HelloCall{Versions: []int{entity.ProtocolVersion}}).To()
+	resp, err := ws.cwsClient.SyncSend(cws.WSPacket{ID: entity.Hello, Data: hello})
+	if err != nil {
+		pterm.FgRed.Printfln("The ws url %q hello fail:%v", url, err)
+	} else {
+		pterm.FgWhite.Printfln("Hello from %q server: %s", url, resp.Data)
+	}
 	return ws
 }
 
@@ -96,6 +106,19 @@ func (ws *WsSender) OnHandleRoomClose() cws.PacketHandler {
 	}
 }
 
+// 游戏上报的事件, 如菜单选中.
+func (ws *WsSender) OnHandleGameEvent() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		event := entity.GameEventRsp{}
+		if err := event.From(resp.Data); err != nil {
+			pterm.FgRed.Printfln("OnHandleGameEvent event.From error: %v", err)
+			return cws.EmptyPacket
+		}
+		pterm.FgWhite.Printfln("OnHandleGameEvent room: %s event: %s data: %v", event.RoomId, event.Event, event.Data)
+		return cws.EmptyPacket
+	}
+}
+
 func (ws *WsSender) Send(command, data string) error {
 	// callback must be nil
 	ws.cwsClient.Send(cws.WSPacket{ID: command, Data: data, PacketID: "1", SessionID: "123456890117"}, nil)
@@ -117,12 +140,12 @@ func (ws *WsSender) OnHandleRoomStart() cws.PacketHandler {
 			return cws.EmptyPacket
 		}
 		pterm.FgWhite.Printfln("OnHandleRoomStart response id: %s sdp: %q", rom.RoomId, rom.Sdp)
-		var sdp rtpua.Sdp
-		if err := json.Unmarshal([]byte(rom.Sdp), &sdp); err != nil {
-			pterm.FgRed.Printfln("OnHandleRoomStart json.Unmarshal error: %v", err)
+		answer, err := sdp.Parse(rom.Sdp)
+		if err != nil {
+			pterm.FgRed.Printfln("OnHandleRoomStart sdp.Parse error: %v", err)
 			return cws.EmptyPacket
 		}
-		_ = ws.startVideoRtpReceive(sdp)
+		_ = ws.startVideoRtpReceive(answer)
 
 		// 不用回啥响应
 		return cws.EmptyPacket
@@ -130,7 +153,7 @@ func (ws *WsSender) OnHandleRoomStart() cws.PacketHandler {
 }
 
 // 接收视频video流10s.
-func (ws *WsSender) startVideoRtpReceive(sdp rtpua.Sdp) error {
+func (ws *WsSender) startVideoRtpReceive(answer *sdp.SessionDescription) error {
 	ticker := time.NewTicker(time.Second * 40)
 
 	// 创建rtp流.
@@ -187,7 +210,7 @@ func (ws *WsSender) startVideoRtpReceive(sdp rtpua.Sdp) error {
 }
 
 // 采用rtptrack接收rtp
-func (ws *WsSender) startVideoRtpTrack(sdp rtpua.Sdp) error {
+func (ws *WsSender) startVideoRtpTrack(answer *sdp.SessionDescription) error {
 	ticker := time.NewTicker(time.Second * 20)
 	// create h264 file.
 	h264File, err := h264writer.New(FileNames)
@@ -265,6 +288,13 @@ func (ws *WsSender) startVideoRtpTrack(sdp rtpua.Sdp) error {
 	}
 }
 
+// localOffer 只接收h264视频的offer.
+func localOffer(addr string) string {
+	host, port, _ := net.SplitHostPort(addr)
+	return fmt.Sprintf("v=0\r\no=- 0 0 IN IP4 %s\r\ns=-\r\nc=IN IP4 %s\r\nt=0 0\r\n"+
+		"m=video %s RTP/AVP 101\r\na=rtpmap:101 H264/90000\r\na=fmtp:101 profile-level-id=42e01f;packetization-mode=1\r\na=recvonly\r\n", host, host, port)
+}
+
 // 模拟xmedia分发到client.
 // 转成h264流后给到ffmpeg读取播放.
 // act as ws client.
@@ -310,7 +340,7 @@ func main() {
 	//waitGroup.Wait()
 	// 创建房间交互 Begin:================================================================================================
 	// text or image or chromedp
-	rom := entity.RoomStartCall{Name: "chromedp", AudioPayloadType: 97, VideoPayloadType: 101, Zone: "udp", Addr: IpLocalAddr}
+	rom := entity.RoomStartCall{Name: "chromedp", Zone: "udp", Sdp: localOffer(IpLocalAddr)}
 	data, err := rom.To()
 	if err = sender.Send(entity.RoomStart, data); err != nil {
 		pterm.FgRed.Printfln("sender.Send fail: %v", err)
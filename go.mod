@@ -13,6 +13,7 @@ require (
 	github.com/hajimehoshi/go-mp3 v0.3.3
 	github.com/hajimehoshi/oto/v2 v2.1.0
 	github.com/jfreymuth/oggvorbis v1.0.3
+	github.com/prometheus/client_golang v1.10.0
 	github.com/pterm/pterm v0.12.33
 	github.com/satori/go.uuid v1.2.0
 	golang.org/x/image v0.0.0-20220321031419-a8550c1d254a
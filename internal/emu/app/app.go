@@ -7,6 +7,7 @@ import (
 	"os"
 	"syscall"
 	"time"
+	"xmediaEmu/pkg/emulator/worker"
 	"xmediaEmu/pkg/metric"
 	"xmediaEmu/pkg/util"
 
@@ -48,8 +49,11 @@ func InitService() {
 	metric.InitMetrics(nodeSelf.Id, service.Version)
 
 
+	// 媒体端口池.
+	worker.Init(AppConf.Ims.Ports.Start, AppConf.Ims.Ports.End, time.Duration(AppConf.Ims.Ports.Quarantine)*time.Second, AppConf.Ims.MediaIps()...)
+
 	router.Init(service.Version)
-	monitor.SetMaxCalls((AppConf.Ims.Ports.End - AppConf.Ims.Ports.Start) / 2)
+	monitor.SetMaxCalls(worker.GetPortSuiteHelper().Capacity())
 
 	// set core unlimited
 	var ulimitSize uint64
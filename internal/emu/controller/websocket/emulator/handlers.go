@@ -0,0 +1,191 @@
+package emulator
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	uuid "github.com/satori/go.uuid"
+	"image/jpeg"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	appconfig "xmediaEmu/pkg/config"
+	"xmediaEmu/pkg/cws"
+	"xmediaEmu/pkg/cws/entity"
+	"xmediaEmu/pkg/emulator/config"
+	"xmediaEmu/pkg/emulator/worker"
+	"xmediaEmu/pkg/log"
+)
+
+// http接口用的worker, 和ws连接的worker互不影响.
+var handler *worker.Handler
+
+// CreateRoomRsp 创建room的响应, 比ws的start多了session id.
+type CreateRoomRsp struct {
+	Session string `json:"session"`
+	entity.RoomStartRsp
+}
+
+// Init 按AppConf.Emulator创建worker, 在InitConfig之后调用.
+func Init() {
+	emu := appconfig.AppConf.Emulator
+	video := config.VideoConfig{Codec: emu.Video}
+	if video.Codec == "" {
+		video.Codec = string(config.H264)
+	}
+	video.H264.Profile = "baseline"
+	video.H264.Tune = "stillimage"
+	video.H264.Crf = 20
+	video.H264.Preset = "fast"
+	audio := config.AudioConfig{Codec: emu.Audio, Channels: 1, Frame: 20, Frequency: 8000}
+
+	conf := config.Config{
+		Encoder:      config.EncoderConfig{Audio: audio, Video: video},
+		Width:        emu.Width,
+		Height:       emu.Height,
+		LocalMediaIp: appconfig.AppConf.Ims.Ip,
+	}
+	handler = worker.NewLocalHandler(conf)
+}
+
+// abort 按错误码返回, 错误码和http状态码一致.
+func abort(ctx *gin.Context, err error) {
+	var perr *cws.PacketError
+	if !errors.As(err, &perr) {
+		perr = cws.NewPacketError(cws.CodeInternal, "%v", err)
+	}
+	ctx.AbortWithStatusJSON(perr.Code, perr)
+}
+
+// reply 成功时把响应数据解码到rsp返回.
+func reply(ctx *gin.Context, resp cws.WSPacket, rsp interface{ From(string) error }) {
+	if resp.Error != nil {
+		abort(ctx, resp.Error)
+		return
+	}
+	if err := rsp.From(resp.Data); err != nil {
+		abort(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+// @tags 模拟器
+// @Summary 创建room, 已存在时加入
+// @Accept json
+// @Produce json
+// @Param room query string false "room id, 为空时按游戏名生成"
+// @Param session query string false "session id, 为空时生成"
+// @Param body body entity.RoomStartCall true "同ws的start命令"
+// @Success 200 {object} CreateRoomRsp
+// @Router /emulator/rooms [post]
+func CreateRoomHandle(ctx *gin.Context) {
+	body, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		abort(ctx, cws.NewPacketError(cws.CodeBadRequest, "read body: %v", err))
+		return
+	}
+	sessionID := ctx.Query("session")
+	if sessionID == "" {
+		sessionID = uuid.NewV4().String()
+	}
+
+	resp := handler.Call(cws.WSPacket{ID: entity.RoomStart, SessionID: sessionID, RoomID: ctx.Query("room"), Data: string(body)})
+	if resp.Error != nil {
+		abort(ctx, resp.Error)
+		return
+	}
+	rsp := entity.RoomStartRsp{}
+	if err := rsp.From(resp.Data); err != nil {
+		abort(ctx, err)
+		return
+	}
+	log.Logger.Infof("room %s created by http, session:%s", rsp.RoomId, sessionID)
+	ctx.JSON(http.StatusOK, CreateRoomRsp{Session: sessionID, RoomStartRsp: rsp})
+}
+
+// @tags 模拟器
+// @Summary 所有room的状态
+// @Produce json
+// @Success 200 {object} entity.RoomListRsp
+// @Router /emulator/rooms [get]
+func ListRoomsHandle(ctx *gin.Context) {
+	reply(ctx, handler.Call(cws.WSPacket{ID: entity.ListRooms}), &entity.RoomListRsp{})
+}
+
+// @tags 模拟器
+// @Summary room的状态
+// @Produce json
+// @Param room path string true "room id"
+// @Success 200 {object} entity.RoomInfo
+// @Router /emulator/rooms/{room} [get]
+func GetRoomHandle(ctx *gin.Context) {
+	data, _ := (&entity.RoomCall{RoomId: ctx.Param("room")}).To()
+	reply(ctx, handler.Call(cws.WSPacket{ID: entity.GetRoom, Data: data}), &entity.RoomInfo{})
+}
+
+// @tags 模拟器
+// @Summary 删除room, 拆除room里的所有session
+// @Param room path string true "room id"
+// @Success 204
+// @Router /emulator/rooms/{room} [delete]
+func DeleteRoomHandle(ctx *gin.Context) {
+	roomID := ctx.Param("room")
+	if !handler.CloseRoom(roomID) {
+		abort(ctx, cws.NewPacketError(cws.CodeNotFound, "room %s not found", roomID))
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// @tags 模拟器
+// @Summary room当前画面
+// @Produce jpeg
+// @Param room path string true "room id"
+// @Param quality query int false "jpeg质量1-100, 默认75"
+// @Success 200
+// @Router /emulator/rooms/{room}/snapshot [get]
+func SnapshotHandle(ctx *gin.Context) {
+	roomID := ctx.Param("room")
+	img, err := handler.Snapshot(roomID)
+	if err != nil {
+		abort(ctx, err)
+		return
+	}
+	if img == nil {
+		abort(ctx, cws.NewPacketError(cws.CodeUnavailable, "room %s has no frame yet", roomID))
+		return
+	}
+
+	quality := jpeg.DefaultQuality
+	if v, err := strconv.Atoi(ctx.Query("quality")); err == nil && v >= 1 && v <= 100 {
+		quality = v
+	}
+	ctx.Header("Content-Type", "image/jpeg")
+	ctx.Status(http.StatusOK)
+	if err := jpeg.Encode(ctx.Writer, img, &jpeg.Options{Quality: quality}); err != nil {
+		log.Logger.Errorf("snapshot of room %s encode failed: %v", roomID, err)
+	}
+}
+
+// @tags 模拟器
+// @Summary 所有session的状态
+// @Produce json
+// @Success 200 {array} entity.SessionInfo
+// @Router /emulator/sessions [get]
+func ListSessionsHandle(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, handler.Sessions())
+}
+
+// @tags 模拟器
+// @Summary 删除session, 最后一个离开时room空闲后关闭
+// @Param session path string true "session id"
+// @Success 204
+// @Router /emulator/sessions/{session} [delete]
+func DeleteSessionHandle(ctx *gin.Context) {
+	resp := handler.Call(cws.WSPacket{ID: entity.RoomQuit, SessionID: ctx.Param("session")})
+	if resp.Error != nil {
+		abort(ctx, resp.Error)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
@@ -3,8 +3,11 @@ package ops
 import (
 	"context"
 	"github.com/gin-gonic/gin"
+	"net/http"
 	"strconv"
+	"time"
 	"xmediaEmu/pkg/config"
+	"xmediaEmu/pkg/emulator/worker"
 	"xmediaEmu/pkg/log"
 )
 
@@ -33,4 +36,27 @@ func LogHandle(ctx *gin.Context) {
 
 	log.SetLevel(level)
 	log.Logger.Infof("log level change to:%d", level)
-}
\ No newline at end of file
+}
+
+// @tags 系统操作
+// @Summary 媒体端口使用情况和泄漏的分配
+// @Produce json
+// @Param leak query int false "占用超过该秒数视为泄漏, 默认取配置"
+// @Success 200
+// @Router /ops/ports [get]
+func PortsHandle(ctx *gin.Context) {
+	leakAfter := config.AppConf.Ims.Ports.LeakAfter
+	if v, err := strconv.Atoi(ctx.Query("leak")); err == nil && v >= 0 {
+		leakAfter = v
+	}
+
+	helper := worker.GetPortSuiteHelper()
+	leaks := helper.Leaks(time.Duration(leakAfter) * time.Second)
+	if len(leaks) > 0 {
+		log.Logger.Warnf("%d port allocations held over %ds", len(leaks), leakAfter)
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"pools": helper.Stats(),
+		"leaks": leaks,
+	})
+}
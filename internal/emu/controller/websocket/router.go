@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"xmediaEmu/internal/emu/controller/websocket/emulator"
 	"xmediaEmu/internal/emu/controller/websocket/ops"
 )
 
@@ -38,11 +39,22 @@ func Init(ver string) {
 	opsGroup := Handlers.Router.Group("/ops")
 	{
 		opsGroup.GET("/log", ops.LogHandle)
+		opsGroup.GET("/ports", ops.PortsHandle)
 	}
 
-	// Asr命令.
-	Handlers.Router.POST("/asr", asr.WsAsrHandler)
-
-	// TODO: emulator命令.
+	// Asr命令, websocket升级只支持GET.
+	Handlers.Router.GET("/asr", asr.WsAsrHandler)
 
+	// emulator命令, 不需要ws coordinator.
+	emulator.Init()
+	emuGroup := Handlers.Router.Group("/emulator")
+	{
+		emuGroup.POST("/rooms", emulator.CreateRoomHandle)
+		emuGroup.GET("/rooms", emulator.ListRoomsHandle)
+		emuGroup.GET("/rooms/:room", emulator.GetRoomHandle)
+		emuGroup.GET("/rooms/:room/snapshot", emulator.SnapshotHandle)
+		emuGroup.DELETE("/rooms/:room", emulator.DeleteRoomHandle)
+		emuGroup.GET("/sessions", emulator.ListSessionsHandle)
+		emuGroup.DELETE("/sessions/:session", emulator.DeleteSessionHandle)
+	}
 }
\ No newline at end of file
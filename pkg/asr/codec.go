@@ -0,0 +1,38 @@
+package asr
+
+import (
+	"strings"
+	"xmediaEmu/pkg/audio/g711"
+)
+
+// 支持的rtp音频编码.
+const (
+	CodecPCMU = "PCMU"
+	CodecPCMA = "PCMA"
+	CodecL16  = "L16"
+)
+
+// rtp负载解码成16bit小端pcm.
+type decodeFunc func(payload []byte) []byte
+
+func newDecoder(codec string) decodeFunc {
+	switch strings.ToUpper(codec) {
+	case "", CodecPCMU, "G711":
+		return g711.Ulaw.Decode
+	case CodecPCMA:
+		return g711.Alaw.Decode
+	case CodecL16, "PCM":
+		return decodeL16
+	default:
+		return nil
+	}
+}
+
+// L16 网络字节序.
+func decodeL16(payload []byte) []byte {
+	pcm := make([]byte, len(payload)&^1)
+	for i := 0; i < len(pcm); i += 2 {
+		pcm[i], pcm[i+1] = payload[i+1], payload[i]
+	}
+	return pcm
+}
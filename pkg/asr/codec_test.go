@@ -0,0 +1,61 @@
+package asr
+
+import (
+	"bytes"
+	"testing"
+	"xmediaEmu/pkg/audio/g711"
+)
+
+func TestNewDecoder(t *testing.T) {
+	payload := []byte{0x00, 0x7F, 0x80, 0xFF}
+	tests := []struct {
+		codec string
+		want  []byte // nil为不支持.
+	}{
+		{"", g711.Ulaw.Decode(payload)},
+		{"PCMU", g711.Ulaw.Decode(payload)},
+		{"pcmu", g711.Ulaw.Decode(payload)},
+		{"G711", g711.Ulaw.Decode(payload)},
+		{"PCMA", g711.Alaw.Decode(payload)},
+		{"L16", []byte{0x7F, 0x00, 0xFF, 0x80}},
+		{"pcm", []byte{0x7F, 0x00, 0xFF, 0x80}},
+		{"G729", nil},
+		{"AMR", nil},
+		{"opus", nil},
+	}
+	for _, tt := range tests {
+		decode := newDecoder(tt.codec)
+		if tt.want == nil {
+			if decode != nil {
+				t.Errorf("codec %q should be unsupported", tt.codec)
+			}
+			continue
+		}
+		if decode == nil {
+			t.Errorf("codec %q unsupported", tt.codec)
+			continue
+		}
+		if got := decode(payload); !bytes.Equal(got, tt.want) {
+			t.Errorf("codec %q got %v, want %v", tt.codec, got, tt.want)
+		}
+	}
+}
+
+// L16网络字节序转小端, 奇数长度时丢掉最后半个采样.
+func TestDecodeL16(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		want    []byte
+	}{
+		{nil, []byte{}},
+		{[]byte{0x12}, []byte{}},
+		{[]byte{0x12, 0x34}, []byte{0x34, 0x12}},
+		{[]byte{0x12, 0x34, 0x56}, []byte{0x34, 0x12}},
+		{[]byte{0x12, 0x34, 0x56, 0x78}, []byte{0x34, 0x12, 0x78, 0x56}},
+	}
+	for _, tt := range tests {
+		if got := decodeL16(tt.payload); !bytes.Equal(got, tt.want) {
+			t.Errorf("payload %v got %v, want %v", tt.payload, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package asr
+
+import (
+	"strings"
+	"time"
+	"xmediaEmu/pkg/config"
+	"xmediaEmu/pkg/cws"
+	"xmediaEmu/pkg/cws/entity"
+	"xmediaEmu/pkg/log"
+)
+
+// 运营商提示音关键字, 按顺序匹配, 先匹配的优先.
+var earlyKeywords = []struct {
+	result   string
+	keywords []string
+}{
+	{entity.EarlyResultInvalid, []string{"空号", "号码不存在", "does not exist", "not in service"}},
+	{entity.EarlyResultPowerOff, []string{"关机", "powered off", "switched off"}},
+	{entity.EarlyResultBusy, []string{"正忙", "正在通话", "忙", "busy"}},
+	{entity.EarlyResultNoAnswer, []string{"无人接听", "暂时无法接听", "no answer", "not answering"}},
+	{entity.EarlyResultVoicemail, []string{"语音信箱", "留言", "voicemail", "voice mail", "leave a message"}},
+	{entity.EarlyResultUnreachable, []string{"无法接通", "不在服务区", "停机", "unreachable", "not reachable", "cannot be connected"}},
+}
+
+// classifyEarly 根据识别文本判断早媒体分类, 无法判断返回空.
+func classifyEarly(text string) string {
+	text = strings.ToLower(text)
+	for _, k := range earlyKeywords {
+		for _, keyword := range k.keywords {
+			if strings.Contains(text, keyword) {
+				return k.result
+			}
+		}
+	}
+	return ""
+}
+
+// 早媒体识别请求, 流程同asr_init, 出口改为EarlyUrl, TEarlyMedia超时后自动拆除.
+func (h *Handler) handleInitEarlyAsr() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Logger.Infof("Received asr_init_early, id:%s data:%s", h.ID, resp.Data)
+		call := entity.AsrInitCall{}
+		if err := call.From(resp.Data); err != nil {
+			log.Logger.Errorf("error: asr_init_early invalid data: %v", err)
+			return cws.ErrorPacket(entity.Answer, cws.CodeBadRequest, "invalid data: %v", err)
+		}
+		decoder, err := prepareInit(&call)
+		if err != nil {
+			log.Logger.Errorf("error: asr_init_early invalid call: %v", err)
+			return cws.ErrorPacket(entity.Answer, cws.CodeBadRequest, "%v", err)
+		}
+
+		answer, err := h.startMedia(&call, decoder, config.AppConf.Http.EarlyUrl, func(out *cws.Client) {
+			out.Receive(entity.EarlyResult, h.handleEarlyResult(resp.SessionID))
+		})
+		if err != nil {
+			log.Logger.Errorf("error: asr_init_early startMedia failed: %v, peer:%s", err, call.Addr)
+			return cws.ErrorPacket(entity.Answer, cws.CodeInternal, "start media failed: %v", err)
+		}
+
+		// 和Close互斥, 已经关闭时不再启动定时器.
+		h.Lock()
+		if h.closed {
+			h.Unlock()
+			return cws.ErrorPacket(entity.Answer, cws.CodeInternal, "%v", errHandlerClosed)
+		}
+		h.earlyDone = false
+		h.earlyTimer = time.AfterFunc(time.Duration(config.AppConf.Timeout.TEarlyMedia), func() {
+			log.Logger.Infof("asr early media timeout, id:%s", h.ID)
+			h.reportEarly(resp.SessionID, entity.EarlyMediaResult{Result: entity.EarlyResultUnknown})
+		})
+		h.Unlock()
+
+		data, _ := answer.To()
+		return cws.WSPacket{ID: entity.Answer, SessionID: resp.SessionID, Data: data}
+	}
+}
+
+// asr服务返回的早媒体结果, 没带分类时按识别文本判断, 判断不出继续等待.
+func (h *Handler) handleEarlyResult(sessionID string) cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		result := entity.EarlyMediaResult{}
+		if err := result.From(resp.Data); err != nil {
+			log.Logger.Errorf("error: early_result invalid data: %v", err)
+			return cws.EmptyPacket
+		}
+		if result.Result == "" {
+			result.Result = classifyEarly(result.Text)
+		}
+		if result.Result == "" {
+			log.Logger.Infof("asr early media unclassified, id:%s text:%s", h.ID, result.Text)
+			return cws.EmptyPacket
+		}
+
+		h.reportEarly(sessionID, result)
+		return cws.EmptyPacket
+	}
+}
+
+// reportEarly 定时器和asr结果先到的上报一次, 上报后通过Close释放媒体.
+func (h *Handler) reportEarly(sessionID string, result entity.EarlyMediaResult) {
+	h.Lock()
+	if h.earlyDone {
+		h.Unlock()
+		return
+	}
+	h.earlyDone = true
+	h.Unlock()
+
+	log.Logger.Infof("asr early media result, id:%s result:%s text:%s", h.ID, result.Result, result.Text)
+	if h.Socket != nil {
+		data, _ := result.To()
+		h.Socket.Send(cws.WSPacket{ID: entity.EarlyResult, SessionID: sessionID, Data: data}, nil)
+	}
+	h.Close()
+}
@@ -0,0 +1,147 @@
+package asr
+
+import (
+	"common/web"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"xmediaEmu/pkg/cws"
+	"xmediaEmu/pkg/cws/entity"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestClassifyEarly(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"您拨打的号码是空号", entity.EarlyResultInvalid},
+		{"The number you dialed does not exist", entity.EarlyResultInvalid},
+		{"您拨打的电话已关机", entity.EarlyResultPowerOff},
+		{"The subscriber is Powered Off", entity.EarlyResultPowerOff},
+		{"您拨打的用户正忙", entity.EarlyResultBusy},
+		{"the line is BUSY", entity.EarlyResultBusy},
+		{"您拨打的电话暂时无法接听", entity.EarlyResultNoAnswer},
+		{"no answer", entity.EarlyResultNoAnswer},
+		{"请在提示音后留言", entity.EarlyResultVoicemail},
+		{"please leave a message", entity.EarlyResultVoicemail},
+		{"您拨打的电话不在服务区", entity.EarlyResultUnreachable},
+		{"the subscriber cannot be connected", entity.EarlyResultUnreachable},
+		// 先匹配的优先: 空号优先于无法接通.
+		{"您拨打的号码是空号, 无法接通", entity.EarlyResultInvalid},
+		{"", ""},
+		{"嘟嘟嘟", ""},
+		{"hello, this is a ring back tone", ""},
+	}
+	for _, tt := range tests {
+		if got := classifyEarly(tt.text); got != tt.want {
+			t.Errorf("%q got %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+// earlyHandler 入口ws连到测试服务, 收到的early_result放到results.
+func earlyHandler(t *testing.T) (*Handler, chan entity.EarlyMediaResult) {
+	results := make(chan entity.EarlyMediaResult, 8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			packet := cws.WSPacket{}
+			if json.Unmarshal(data, &packet) == nil && packet.ID == entity.EarlyResult {
+				result := entity.EarlyMediaResult{}
+				result.From(packet.Data)
+				results <- result
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	h := &Handler{ID: "test"}
+	h.Socket = cws.NewClient(h.ID, web.New("ws"+strings.TrimPrefix(srv.URL, "http")))
+	h.Socket.SetHeartbeat(cws.HeartbeatConfig{})
+	if err := h.Socket.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Socket.Close)
+	return h, results
+}
+
+// 定时器和asr结果同时到达时只上报一次, 之后handler关闭.
+func TestReportEarlyOnce(t *testing.T) {
+	h, results := earlyHandler(t)
+	h.Lock()
+	h.earlyTimer = time.AfterFunc(time.Millisecond, func() {
+		h.reportEarly("s1", entity.EarlyMediaResult{Result: entity.EarlyResultUnknown})
+	})
+	h.Unlock()
+
+	handle := h.handleEarlyResult("s1")
+	data, _ := (&entity.EarlyMediaResult{Text: "用户正忙"}).To()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handle(cws.WSPacket{ID: entity.EarlyResult, Data: data})
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case result := <-results:
+		if result.Result != entity.EarlyResultBusy && result.Result != entity.EarlyResultUnknown {
+			t.Fatalf("got %+v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no result")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(results) != 0 {
+		t.Fatalf("%d more results", len(results))
+	}
+	h.Lock()
+	closed := h.closed
+	h.Unlock()
+	if !closed {
+		t.Fatal("handler not closed")
+	}
+}
+
+// 没有分类的结果继续等待, 不上报.
+func TestEarlyResultUnclassified(t *testing.T) {
+	h, results := earlyHandler(t)
+	data, _ := (&entity.EarlyMediaResult{Text: "嘟嘟嘟"}).To()
+	h.handleEarlyResult("s1")(cws.WSPacket{ID: entity.EarlyResult, Data: data})
+	time.Sleep(50 * time.Millisecond)
+	if len(results) != 0 || h.earlyDone {
+		t.Fatal("unclassified result reported")
+	}
+}
+
+// Close之后不能再开启媒体, 也不会再有定时器.
+func TestStartMediaAfterClose(t *testing.T) {
+	h := &Handler{ID: "test"}
+	h.Close()
+	h.Close()
+	call := entity.AsrInitCall{Addr: "127.0.0.1:4000"}
+	decoder, err := prepareInit(&call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.startMedia(&call, decoder, "ws://127.0.0.1:1", nil); err != errHandlerClosed {
+		t.Fatalf("got %v, want %v", err, errHandlerClosed)
+	}
+}
@@ -0,0 +1,171 @@
+package asr
+
+import (
+	"common/rtpengine"
+	"common/rtpengine/rtp/codecs"
+	"common/util/process"
+	"common/web"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+	"xmediaEmu/pkg/config"
+	"xmediaEmu/pkg/cws"
+	"xmediaEmu/pkg/cws/entity"
+	"xmediaEmu/pkg/emulator/worker"
+	"xmediaEmu/pkg/log"
+	"xmediaEmu/pkg/media/jitter"
+)
+
+const (
+	defaultSampleRate = 8000
+	defaultFrame      = 20 // ms
+	rtpBufferSize     = 1500
+	readTimeout       = time.Second
+)
+
+// prepareInit 校验asr_init并填充默认值, 返回对应编码的解码.
+func prepareInit(call *entity.AsrInitCall) (decodeFunc, error) {
+	if err := call.Validate(); err != nil {
+		return nil, err
+	}
+	decoder := newDecoder(call.Codec)
+	if decoder == nil {
+		return nil, fmt.Errorf("unsupported codec: %s", call.Codec)
+	}
+	if call.Codec == "" {
+		call.Codec = CodecPCMU
+	}
+	if call.Zone == "" {
+		call.Zone = "udp"
+	}
+	if call.SampleRate == 0 {
+		call.SampleRate = defaultSampleRate
+	}
+	if call.Frame == 0 {
+		call.Frame = defaultFrame
+	}
+	return decoder, nil
+}
+
+// startMedia 分配端口并开启rtp接收，解码后的pcm按帧发送到wsUrl, call已经过prepareInit.
+// outRoutes用于在连接出口ws前注册asr服务下发的命令.
+func (h *Handler) startMedia(call *entity.AsrInitCall, decoder decodeFunc, wsUrl string, outRoutes func(out *cws.Client)) (*entity.AsrAnswer, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.closed {
+		return nil, errHandlerClosed
+	}
+	if h.xmediaTrack != nil {
+		return nil, errors.New("asr media already started")
+	}
+	if wsUrl == "" {
+		return nil, errors.New("asr ws url not configured")
+	}
+	codec, zone, sampleRate, frame := call.Codec, call.Zone, call.SampleRate, call.Frame
+
+	portSuite, err := worker.GetPortSuiteHelper().AllotPort(h.ID)
+	if err != nil {
+		return nil, err
+	}
+	localAddr := portSuite.RtpAddr(config.AppConf.Ims.Ip)
+
+	// 只接收, 绑定对端地址用于回送.
+	track := rtpengine.NewTrackLocal(zone, localAddr)
+	track.Bind(rtpengine.SenderBinding{RightAddr: call.Addr, PayloadType: rtpengine.PayloadType(call.PayloadType), Payloader: &codecs.G711Payloader{}})
+	track.SetSamples(sampleRate)
+	if err := track.StartSession(rtpengine.Config{}); err != nil {
+		worker.GetPortSuiteHelper().ReleasePort(portSuite)
+		return nil, err
+	}
+
+	// 出口asr ws.
+	out := cws.NewClient(h.ID, web.New(wsUrl))
+	if outRoutes != nil {
+		outRoutes(out)
+	}
+	if err := out.Connect(); err != nil {
+		_ = track.Close()
+		worker.GetPortSuiteHelper().ReleasePort(portSuite)
+		return nil, err
+	}
+
+	h.xmediaTrack = track
+	h.portSuite = portSuite
+	h.OutSocket = out
+	h.exit = make(chan struct{})
+
+	// 乱序、抖动和丢包在jitter buffer里处理, 按帧输出.
+	buffer := jitter.New(jitter.Config{SampleRate: sampleRate, Frame: time.Duration(frame) * time.Millisecond})
+	go h.receive(track, buffer, decoder, uint8(call.PayloadType), h.exit)
+	go h.playout(buffer, out, time.Duration(frame)*time.Millisecond, h.exit)
+
+	log.Logger.Infof("asr media started, id:%s local:%s peer:%s codec:%s", h.ID, localAddr, call.Addr, codec)
+	return &entity.AsrAnswer{Addr: localAddr, PayloadType: call.PayloadType, Codec: codec, SampleRate: sampleRate}, nil
+}
+
+// receive 接收IMS侧rtp, 解码成pcm后放入jitter buffer.
+func (h *Handler) receive(track *rtpengine.TrackLocal, buffer *jitter.Buffer, decode decodeFunc, payloadType uint8, exit chan struct{}) {
+	defer func() {
+		if v := recover(); v != nil {
+			process.DefaultPanicReport.RecoverFromPanic(h.ID, "asr.Handler.receive", v)
+		}
+	}()
+
+	stream, ssrc, err := track.AcceptStream()
+	if err != nil {
+		log.Logger.Errorf("asr AcceptStream failed: %v, id:%s", err, h.ID)
+		return
+	}
+	log.Logger.Infof("asr AcceptStream, id:%s ssrc:%d", h.ID, ssrc)
+
+	var temp [rtpBufferSize]byte
+	for {
+		select {
+		case <-exit:
+			return
+		default:
+		}
+
+		_ = stream.SetReadDeadline(time.Now().Add(readTimeout))
+		packet, err := stream.ReadRTP(temp[0:])
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			log.Logger.Errorf("asr ReadRTP failed: %v, id:%s", err, h.ID)
+			return
+		}
+		// 舒适噪声、dtmf等其他负载忽略.
+		if packet.PayloadType != payloadType {
+			continue
+		}
+
+		buffer.Push(packet.SequenceNumber, packet.Timestamp, decode(packet.Payload), time.Now())
+	}
+}
+
+// playout 按帧间隔从jitter buffer取pcm写入asr.
+func (h *Handler) playout(buffer *jitter.Buffer, out *cws.Client, frame time.Duration, exit chan struct{}) {
+	defer func() {
+		if v := recover(); v != nil {
+			process.DefaultPanicReport.RecoverFromPanic(h.ID, "asr.Handler.playout", v)
+		}
+	}()
+
+	t := time.NewTicker(frame)
+	defer t.Stop()
+	for {
+		select {
+		case <-exit:
+			stats := buffer.Stats()
+			log.Logger.Infof("asr jitter buffer, id:%s stats:%+v", h.ID, stats)
+			return
+		case <-t.C:
+			if f, ok := buffer.Pop(); ok {
+				out.SendBinary(f.PCM)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package asr
+
+import (
+	"testing"
+	"xmediaEmu/pkg/cws/entity"
+)
+
+func TestPrepareInit(t *testing.T) {
+	tests := []struct {
+		name string
+		call entity.AsrInitCall
+		want entity.AsrInitCall // 填充默认值之后.
+		err  bool
+	}{
+		{
+			name: "defaults",
+			call: entity.AsrInitCall{Addr: "10.0.0.1:4000"},
+			want: entity.AsrInitCall{Zone: "udp", Addr: "10.0.0.1:4000", Codec: CodecPCMU, SampleRate: 8000, Frame: 20},
+		},
+		{
+			name: "keep",
+			call: entity.AsrInitCall{Zone: "udp4", Addr: "10.0.0.1:4000", PayloadType: 96, Codec: "L16", SampleRate: 16000, Frame: 40},
+			want: entity.AsrInitCall{Zone: "udp4", Addr: "10.0.0.1:4000", PayloadType: 96, Codec: "L16", SampleRate: 16000, Frame: 40},
+		},
+		{name: "no addr", call: entity.AsrInitCall{}, err: true},
+		{name: "no port", call: entity.AsrInitCall{Addr: "10.0.0.1"}, err: true},
+		{name: "payload type", call: entity.AsrInitCall{Addr: "10.0.0.1:4000", PayloadType: 128}, err: true},
+		{name: "negative payload type", call: entity.AsrInitCall{Addr: "10.0.0.1:4000", PayloadType: -1}, err: true},
+		{name: "sample rate", call: entity.AsrInitCall{Addr: "10.0.0.1:4000", SampleRate: -8000}, err: true},
+		{name: "frame", call: entity.AsrInitCall{Addr: "10.0.0.1:4000", Frame: -20}, err: true},
+		{name: "codec", call: entity.AsrInitCall{Addr: "10.0.0.1:4000", Codec: "G729"}, err: true},
+	}
+	for _, tt := range tests {
+		call := tt.call
+		decoder, err := prepareInit(&call)
+		if tt.err {
+			if err == nil || decoder != nil {
+				t.Errorf("%s: should fail", tt.name)
+			}
+			continue
+		}
+		if err != nil || decoder == nil {
+			t.Errorf("%s: got %v", tt.name, err)
+			continue
+		}
+		if call != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, call, tt.want)
+		}
+	}
+}
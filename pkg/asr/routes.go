@@ -9,4 +9,5 @@ func (h *Handler) routes() {
 
 	//
 	h.Socket.Receive(entity.InitAsr, h.handleInitAsr())
+	h.Socket.Receive(entity.InitEarlyAsr, h.handleInitEarlyAsr())
 }
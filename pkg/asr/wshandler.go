@@ -2,40 +2,126 @@ package asr
 
 import (
 	"common/rtpengine"
+	"common/web"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"net/http"
 	"sync"
+	"time"
+	"xmediaEmu/pkg/config"
 	"xmediaEmu/pkg/cws"
+	"xmediaEmu/pkg/cws/entity"
+	"xmediaEmu/pkg/emulator/worker"
 	"xmediaEmu/pkg/log"
 )
 
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
 // Client is a websocket client
 type Handler struct {
-	ID        string          // taskID
+	ID string // taskID
 	// Socket    *websocket.Conn // xaudiobusiness
 	// OutSocket *websocket.Conn // 出口的socket
-	Socket    *cws.Client
+	Socket *cws.Client
 
 	// xmedia方向进来的rtp流.
 	xmediaTrack *rtpengine.TrackLocal
+	portSuite   *worker.PortSuite
 
 	OutSocket *cws.Client
-	// exit      chan bool
-	sync.Mutex
+	exit      chan struct{}
+
+	// 早媒体模式, 超时或有结果后自动拆除.
+	earlyTimer *time.Timer
+	earlyDone  bool
 
-	// rtp
+	closed    bool // Close之后不能再开启媒体.
+	closeOnce sync.Once
+	sync.Mutex
 }
 
-//
-// WsAsrHandler负责处理asr相关,
+var errHandlerClosed = errors.New("asr handler closed")
+
+// WsAsrHandler负责处理asr相关, 一个ws连接对应一路asr.
 func WsAsrHandler(c *gin.Context) {
-	id  := c.GetHeader("id")
+	id := c.GetHeader("id")
 	log.Logger.Info("WsAsrHandler id:", id)
-	handlers := &Handler{ID: id}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Logger.Errorf("WsAsrHandler upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	h := &Handler{ID: id}
+	h.Socket = cws.NewClient(id, web.NewWSocket(conn))
+	h.routes()
 
-	// 处理逻辑.
+	// block here.
+	h.Socket.Listen()
+	h.Close()
+	log.Logger.Infof("WsAsrHandler id:%s closed", id)
 }
 
-// Asr建立连接请求.
+// Asr建立连接请求, 分配端口后返回本端rtp地址.
 func (h *Handler) handleInitAsr() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Logger.Infof("Received asr_init, id:%s data:%s", h.ID, resp.Data)
+		call := entity.AsrInitCall{}
+		if err := call.From(resp.Data); err != nil {
+			log.Logger.Errorf("error: asr_init invalid data: %v", err)
+			return cws.ErrorPacket(entity.Answer, cws.CodeBadRequest, "invalid data: %v", err)
+		}
+		decoder, err := prepareInit(&call)
+		if err != nil {
+			log.Logger.Errorf("error: asr_init invalid call: %v", err)
+			return cws.ErrorPacket(entity.Answer, cws.CodeBadRequest, "%v", err)
+		}
 
-}
\ No newline at end of file
+		answer, err := h.startMedia(&call, decoder, config.AppConf.Http.WsUrl, nil)
+		if err != nil {
+			log.Logger.Errorf("error: asr_init startMedia failed: %v, peer:%s", err, call.Addr)
+			return cws.ErrorPacket(entity.Answer, cws.CodeInternal, "start media failed: %v", err)
+		}
+
+		data, _ := answer.To()
+		return cws.WSPacket{ID: entity.Answer, SessionID: resp.SessionID, Data: data}
+	}
+}
+
+// Close 释放rtp和出口ws, 入口ws断开和早媒体上报都走这里, 只执行一次.
+func (h *Handler) Close() {
+	h.closeOnce.Do(h.close)
+}
+
+func (h *Handler) close() {
+	h.Lock()
+	defer h.Unlock()
+
+	h.closed = true
+	if h.earlyTimer != nil {
+		h.earlyTimer.Stop()
+		h.earlyTimer = nil
+	}
+	if h.exit != nil {
+		close(h.exit)
+		h.exit = nil
+	}
+	if h.xmediaTrack != nil {
+		if err := h.xmediaTrack.Close(); err != nil {
+			log.Logger.Errorf("error: couldn't close asr track, %v", err)
+		}
+		h.xmediaTrack = nil
+	}
+	if h.portSuite != nil {
+		worker.GetPortSuiteHelper().ReleasePort(h.portSuite)
+		h.portSuite = nil
+	}
+	if h.OutSocket != nil {
+		h.OutSocket.Close()
+		h.OutSocket = nil
+	}
+}
@@ -0,0 +1,145 @@
+// Package g711 provides ITU-T G.711 u-law (PCMU) and a-law (PCMA) codec.
+//
+// 算法参考Sun Microsystems的g711.c, pcm统一为16bit小端.
+package g711
+
+import "encoding/binary"
+
+// Law is a G.711 companding law.
+type Law int
+
+const (
+	Ulaw Law = iota // PCMU, rtp payload 0.
+	Alaw            // PCMA, rtp payload 8.
+)
+
+const (
+	signBit   = 0x80
+	quantMask = 0x0f
+	segShift  = 4
+	segMask   = 0x70
+
+	ulawBias = 0x84
+	ulawClip = 8159
+)
+
+var (
+	segUend = [8]int{0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF, 0x1FFF}
+	segAend = [8]int{0x1F, 0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF}
+)
+
+func search(val int, table *[8]int) int {
+	for i, end := range table {
+		if val <= end {
+			return i
+		}
+	}
+	return len(table)
+}
+
+// EncodeUlaw converts a 16bit linear sample to u-law, 14bit quantization.
+func EncodeUlaw(sample int16) byte {
+	pcm := int(sample) >> 2
+	mask := 0xFF
+	if pcm < 0 {
+		pcm = -pcm
+		mask = 0x7F
+	}
+	if pcm > ulawClip {
+		pcm = ulawClip
+	}
+	pcm += ulawBias >> 2
+
+	seg := search(pcm, &segUend)
+	if seg >= 8 {
+		return byte(0x7F ^ mask)
+	}
+	return byte(((seg << segShift) | ((pcm >> (seg + 1)) & quantMask)) ^ mask)
+}
+
+// DecodeUlaw converts a u-law value to 16bit linear sample.
+func DecodeUlaw(u byte) int16 {
+	u = ^u
+	t := (int(u&quantMask) << 3) + ulawBias
+	t <<= (u & segMask) >> segShift
+	if u&signBit != 0 {
+		return int16(ulawBias - t)
+	}
+	return int16(t - ulawBias)
+}
+
+// EncodeAlaw converts a 16bit linear sample to a-law, 13bit quantization.
+func EncodeAlaw(sample int16) byte {
+	pcm := int(sample) >> 3
+	mask := 0xD5
+	if pcm < 0 {
+		mask = 0x55
+		pcm = -pcm - 1
+	}
+
+	seg := search(pcm, &segAend)
+	if seg >= 8 {
+		return byte(0x7F ^ mask)
+	}
+	aval := seg << segShift
+	if seg < 2 {
+		aval |= (pcm >> 1) & quantMask
+	} else {
+		aval |= (pcm >> seg) & quantMask
+	}
+	return byte(aval ^ mask)
+}
+
+// DecodeAlaw converts an a-law value to 16bit linear sample.
+func DecodeAlaw(a byte) int16 {
+	a ^= 0x55
+	t := int(a&quantMask) << 4
+	switch seg := (a & segMask) >> segShift; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&signBit != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
+
+// EncodeSample converts a 16bit linear sample with the law.
+func (l Law) EncodeSample(sample int16) byte {
+	if l == Alaw {
+		return EncodeAlaw(sample)
+	}
+	return EncodeUlaw(sample)
+}
+
+// DecodeSample converts a G.711 value to 16bit linear sample with the law.
+func (l Law) DecodeSample(v byte) int16 {
+	if l == Alaw {
+		return DecodeAlaw(v)
+	}
+	return DecodeUlaw(v)
+}
+
+// Encode converts 16bit little endian pcm to G.711, one byte per sample.
+// A trailing odd byte is ignored.
+func (l Law) Encode(pcm []byte) []byte {
+	out := make([]byte, len(pcm)/2)
+	for i := range out {
+		out[i] = l.EncodeSample(int16(binary.LittleEndian.Uint16(pcm[2*i:])))
+	}
+	return out
+}
+
+// Decode converts G.711 to 16bit little endian pcm.
+func (l Law) Decode(data []byte) []byte {
+	out := make([]byte, len(data)*2)
+	for i, v := range data {
+		binary.LittleEndian.PutUint16(out[2*i:], uint16(l.DecodeSample(v)))
+	}
+	return out
+}
@@ -0,0 +1,127 @@
+package g711_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"xmediaEmu/pkg/audio/g711"
+)
+
+// 参考值来自Sun g711.c(同python audioop).
+func TestEncode(t *testing.T) {
+	cases := []struct {
+		in   int16
+		ulaw byte
+		alaw byte
+	}{
+		{0, 0xFF, 0xD5},
+		{1, 0xFF, 0xD5},
+		{-1, 0x7E, 0x55},
+		{8, 0xFE, 0xD5},
+		{-8, 0x7E, 0x55},
+		{100, 0xF2, 0xD3},
+		{-100, 0x72, 0x53},
+		{1000, 0xCE, 0xFA},
+		{-1000, 0x4E, 0x7A},
+		{4000, 0xAF, 0x9A},
+		{-4000, 0x2F, 0x1A},
+		{32767, 0x80, 0xAA},
+		{-32768, 0x00, 0x2A},
+	}
+	for _, c := range cases {
+		if got := g711.EncodeUlaw(c.in); got != c.ulaw {
+			t.Errorf("EncodeUlaw(%d): got %#02x, want %#02x", c.in, got, c.ulaw)
+		}
+		if got := g711.EncodeAlaw(c.in); got != c.alaw {
+			t.Errorf("EncodeAlaw(%d): got %#02x, want %#02x", c.in, got, c.alaw)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	cases := []struct {
+		in   byte
+		ulaw int16
+		alaw int16
+	}{
+		{0x00, -32124, -5504},
+		{0x2A, -5372, -32256},
+		{0x55, -716, -8},
+		{0x7F, 0, -848},
+		{0x80, 32124, 5504},
+		{0xAA, 5372, 32256},
+		{0xCE, 988, 440},
+		{0xD5, 716, 8},
+		{0xFA, 40, 1008},
+		{0xFF, 0, 848},
+	}
+	for _, c := range cases {
+		if got := g711.DecodeUlaw(c.in); got != c.ulaw {
+			t.Errorf("DecodeUlaw(%#02x): got %d, want %d", c.in, got, c.ulaw)
+		}
+		if got := g711.DecodeAlaw(c.in); got != c.alaw {
+			t.Errorf("DecodeAlaw(%#02x): got %d, want %d", c.in, got, c.alaw)
+		}
+	}
+}
+
+// 解码后的值再编码必须还原.
+func TestRoundTrip(t *testing.T) {
+	for _, law := range []g711.Law{g711.Ulaw, g711.Alaw} {
+		for i := 0; i < 256; i++ {
+			v := byte(i)
+			// u-law的0x7F(-0)编码回0xFF(+0).
+			if law == g711.Ulaw && v == 0x7F {
+				continue
+			}
+			if got := law.EncodeSample(law.DecodeSample(v)); got != v {
+				t.Errorf("law %d: round trip %#02x got %#02x", law, v, got)
+			}
+		}
+	}
+}
+
+func pcmBytes(samples ...int16) []byte {
+	b := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(b[2*i:], uint16(s))
+	}
+	return b
+}
+
+// 每次只返回一个字节, 检查奇数字节的拼接.
+type oneByteReader struct{ r io.Reader }
+
+func (o *oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return o.r.Read(p[:1])
+}
+
+func TestStream(t *testing.T) {
+	samples := []int16{0, 100, -100, 1000, -1000, 32767, -32768}
+	pcm := pcmBytes(samples...)
+
+	for _, law := range []g711.Law{g711.Ulaw, g711.Alaw} {
+		want := law.Encode(pcm)
+		got, err := ioutil.ReadAll(g711.Encode(law, &oneByteReader{bytes.NewReader(pcm)}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("law %d: Encode stream got %x, want %x", law, got, want)
+		}
+
+		decoded, err := ioutil.ReadAll(g711.Decode(law, bytes.NewReader(want)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded, law.Decode(want)) {
+			t.Errorf("law %d: Decode stream got %x, want %x", law, decoded, law.Decode(want))
+		}
+	}
+}
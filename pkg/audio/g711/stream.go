@@ -0,0 +1,75 @@
+package g711
+
+import "io"
+
+// Stream is a G.711 decoded or encoded audio stream.
+type Stream struct {
+	src    io.Reader
+	law    Law
+	encode bool
+
+	buf  []byte
+	tail []byte // encode时不足一个采样的字节.
+}
+
+// Decode returns a stream reading 16bit little endian pcm from G.711 src.
+//
+// A Stream doesn't close src even if src implements io.Closer.
+// Closing the source is src owner's responsibility.
+func Decode(law Law, src io.Reader) *Stream {
+	return &Stream{src: src, law: law}
+}
+
+// Encode returns a stream reading G.711 from 16bit little endian pcm src.
+//
+// A Stream doesn't close src even if src implements io.Closer.
+// Closing the source is src owner's responsibility.
+func Encode(law Law, src io.Reader) *Stream {
+	return &Stream{src: src, law: law, encode: true}
+}
+
+// Read is implementation of io.Reader's Read.
+func (s *Stream) Read(p []byte) (int, error) {
+	if s.encode {
+		return s.readEncode(p)
+	}
+	return s.readDecode(p)
+}
+
+func (s *Stream) readDecode(p []byte) (int, error) {
+	size := len(p) / 2
+	if size == 0 {
+		return 0, nil
+	}
+	s.grow(size)
+	n, err := s.src.Read(s.buf[:size])
+	copy(p, s.law.Decode(s.buf[:n]))
+	return 2 * n, err
+}
+
+func (s *Stream) readEncode(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	size := 2 * len(p)
+	s.grow(size)
+	t := copy(s.buf, s.tail)
+	s.tail = s.tail[:0]
+	n, err := s.src.Read(s.buf[t:size])
+	n += t
+	if n%2 == 1 {
+		s.tail = append(s.tail, s.buf[n-1])
+		n--
+	}
+	if n == 0 && err == nil {
+		return 0, nil
+	}
+	return copy(p, s.law.Encode(s.buf[:n])), err
+}
+
+func (s *Stream) grow(size int) {
+	if cap(s.buf) < size {
+		s.buf = make([]byte, size)
+	}
+	s.buf = s.buf[:size]
+}
@@ -19,12 +19,14 @@ var AppConf struct {
 	Api     service.Api
 	Ims     service.Ims
 	Timeout struct {
-		T1           int
-		T2           int
+		T1           int // 没有收到rtp/rtcp的秒数.
+		T2           int // 最长通话秒数.
+		TRoomIdle    int // room空闲保留的秒数.
 		TEarlyMedia  int64
 		TRecordMedia int64
 	}
 	Registry middleware.Registry
+	Emulator service.Emulator // http接口创建room的编码配置.
 
 	Logger struct {
 		LogLevel int
@@ -68,6 +70,13 @@ func InitConfig(filepath string) {
 	}
 	AppConf.Timeout.TEarlyMedia = AppConf.Timeout.TEarlyMedia * int64(time.Second)
 
+	if 0 == AppConf.Ims.Ports.Quarantine {
+		AppConf.Ims.Ports.Quarantine = 5
+	}
+	if 0 == AppConf.Ims.Ports.LeakAfter {
+		AppConf.Ims.Ports.LeakAfter = 4 * 3600
+	}
+
 	// get version file.
 	versionFile, err2 := ioutil.ReadFile(filepath)
 	if err2 == nil {
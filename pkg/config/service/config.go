@@ -18,8 +18,27 @@ type Api struct {
 // d对接媒体rtp的ip地址和端口.
 type Ims struct {
 	Ip    string
+	Ips   []string // 多个媒体ip, 每个ip一个端口池, 为空时只用Ip.
 	Ports struct {
-		Start int
-		End   int
+		Start      int
+		End        int
+		Quarantine int // 释放后冷却的秒数.
+		LeakAfter  int // 占用超过该秒数视为泄漏.
 	}
 }
+
+// MediaIps 所有媒体ip.
+func (i *Ims) MediaIps() []string {
+	if len(i.Ips) > 0 {
+		return i.Ips
+	}
+	return []string{i.Ip}
+}
+
+// Emulator http接口创建room的编码配置.
+type Emulator struct {
+	Width  int
+	Height int
+	Video  string // h264
+	Audio  string // g711/g711a/AmrNb/Amrwb/PCM, 为空时没有音频.
+}
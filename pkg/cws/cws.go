@@ -3,10 +3,13 @@ package cws
 import (
 	"common/util/process"
 	"common/web"
+	"context"
 	"encoding/json"
-	"github.com/pterm/pterm"
+	"errors"
+	"fmt"
 	uuid "github.com/satori/go.uuid"
 	"sync"
+	"sync/atomic"
 	"time"
 	"xmediaEmu/pkg/log"
 )
@@ -26,36 +29,118 @@ type (
 
 		// sessions n->1 with one room
 		RoomID string `json:"room_id"`
+
+		// 处理失败时带上错误, 成功时为空.
+		Error *PacketError `json:"error,omitempty"`
+	}
+
+	// PacketError 响应里的结构化错误, Code参照http状态码.
+	PacketError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
 	}
 
 	// 一个client代表一段连接，全双工.
 	Client struct {
-		id   string // = sessionid
-		conn *web.WSocket
+		id       string // = sessionid
+		conn     *web.WSocket
+		connLock sync.RWMutex // 重连时替换conn.
 
 		// sendCallback is callback based on packetID
 		// 根据消息类型进行分发.
-		sendCallback     map[string]func(req WSPacket)
+		sendCallback     map[string]func(req WSPacket, err error)
 		sendCallbackLock sync.Mutex
 		// recvCallback is callback when receive based on ID of the packet
-		recvCallback map[string]func(req WSPacket)
-		//Done chan struct{}
+		recvCallback     map[string]func(req WSPacket)
+		recvCallbackLock sync.RWMutex
+		// 没有注册的命令, 为空时忽略.
+		unknownCallback func(req WSPacket)
+		// SyncSend等待响应的超时时间, 0为一直等待.
+		sendTimeout time.Duration
+
+		heartbeat HeartbeatConfig
+		backoff   BackoffConfig
+		// Connect时记录, 断开后按url重连, Listen的一端不重连.
+		url         string
+		reconnect   bool
+		onReconnect []func()
+
+		lastRecv      int64 // unix nano, 收到任何消息都算.
+		peerHeartbeat int32 // 收到过对端的心跳应答, 之后才按丢失次数判断断开.
+		reconnecting  int32
+
+		startOnce sync.Once
+		closeOnce sync.Once
+		done      chan struct{} // Close后不再心跳和重连.
 	}
 
 	PacketHandler func(resp WSPacket) (req WSPacket)
+
+	// HeartbeatConfig Interval为0时不发心跳, 连续Miss个间隔没有收到消息认为断开.
+	HeartbeatConfig struct {
+		Interval time.Duration
+		Miss     int
+	}
+
+	// BackoffConfig 重连间隔从Min开始翻倍, 最大Max.
+	BackoffConfig struct {
+		Min time.Duration
+		Max time.Duration
+	}
+)
+
+const (
+	HeartbeatID    = "heartbeat"
+	HeartbeatAckID = "heartbeat_ack"
+)
+
+// PacketError.Code
+const (
+	CodeBadRequest    = 400 // 数据格式错误.
+	CodeNotFound      = 404 // session或room不存在.
+	CodeNotAcceptable = 406 // 没有可用的编码.
+	CodeInternal      = 500
+	CodeUnknown       = 501 // 不支持的命令.
+	CodeUnavailable   = 503 // 资源(端口等)不足.
+	CodeVersion       = 505 // 协议版本不支持.
 )
 
 var (
-	EmptyPacket = WSPacket{}
-	// HeartbeatPacket = WSPacket{ID: "heartbeat"} // 心跳后续加.
+	EmptyPacket     = WSPacket{}
+	HeartbeatPacket = WSPacket{ID: HeartbeatID}
+
+	DefaultHeartbeat = HeartbeatConfig{Interval: 10 * time.Second, Miss: 3}
+	DefaultBackoff   = BackoffConfig{Min: 500 * time.Millisecond, Max: 30 * time.Second}
+
+	ErrDisconnected     = errors.New("cws: disconnected")
+	ErrClosed           = errors.New("cws: client closed")
+	ErrHeartbeatTimeout = errors.New("cws: heartbeat timeout")
+)
+
+const (
+	WSWait = 20 * time.Second
+	// DefaultSendTimeout SyncSend默认等待响应的时间.
+	DefaultSendTimeout = 30 * time.Second
 )
 
-const WSWait = 20 * time.Second
+func (e *PacketError) Error() string {
+	return fmt.Sprintf("cws: code %d: %s", e.Code, e.Message)
+}
+
+// NewPacketError 生成失败响应的错误.
+func NewPacketError(code int, format string, args ...interface{}) *PacketError {
+	return &PacketError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrorPacket 命令id为id的失败响应.
+func ErrorPacket(id string, code int, format string, args ...interface{}) WSPacket {
+	return WSPacket{ID: id, Error: NewPacketError(code, format, args...)}
+}
 
 // 基于gin框架
 func NewClient(serverId string, conn *web.WSocket) *Client {
 	id := serverId
-	sendCallback := map[string]func(WSPacket){}
+	sendCallback := map[string]func(WSPacket, error){}
 	recvCallback := map[string]func(WSPacket){}
 
 	return &Client{
@@ -63,14 +148,57 @@ func NewClient(serverId string, conn *web.WSocket) *Client {
 		conn:         conn,
 		sendCallback: sendCallback,
 		recvCallback: recvCallback,
-		//Done: make(chan struct{}),
+		sendTimeout:  DefaultSendTimeout,
+		heartbeat:    DefaultHeartbeat,
+		backoff:      DefaultBackoff,
+		done:         make(chan struct{}),
 	}
 }
 
+// SetHeartbeat 在Listen或Connect之前调用.
+func (c *Client) SetHeartbeat(cfg HeartbeatConfig) {
+	c.heartbeat = cfg
+}
+
+// SetSendTimeout 设置SyncSend的超时时间, 0为一直等待.
+func (c *Client) SetSendTimeout(timeout time.Duration) {
+	c.sendTimeout = timeout
+}
+
+// SetBackoff 在Connect之前调用.
+func (c *Client) SetBackoff(cfg BackoffConfig) {
+	c.backoff = cfg
+}
+
+// OnReconnect 重连成功后回调, 用于重新订阅等, 在Connect之前调用.
+func (c *Client) OnReconnect(f func()) {
+	c.onReconnect = append(c.onReconnect, f)
+}
+
+func (c *Client) socket() *web.WSocket {
+	c.connLock.RLock()
+	defer c.connLock.RUnlock()
+	return c.conn
+}
+
 // 设置注册接收处理.
 // Receive receive and response back
 func (c *Client) Receive(id string, f PacketHandler) {
-	c.recvCallback[id] = func(response WSPacket) {
+	c.recvCallbackLock.Lock()
+	defer c.recvCallbackLock.Unlock()
+	c.recvCallback[id] = c.wrapHandler(f)
+}
+
+// ReceiveUnknown 处理没有注册的命令, 用于回复错误.
+// 没有命令id的和带Error的包不会交给f, 避免双方互相回复.
+func (c *Client) ReceiveUnknown(f PacketHandler) {
+	c.recvCallbackLock.Lock()
+	defer c.recvCallbackLock.Unlock()
+	c.unknownCallback = c.wrapHandler(f)
+}
+
+func (c *Client) wrapHandler(f PacketHandler) func(WSPacket) {
+	return func(response WSPacket) {
 		defer func() {
 			if v := recover(); v != nil {
 				process.DefaultPanicReport.RecoverFromPanic(c.id, "CWS.Client.Receive", v)
@@ -78,36 +206,52 @@ func (c *Client) Receive(id string, f PacketHandler) {
 		}()
 
 		req := f(response)
+		// 没有PacketID的请求不需要回复, 有PacketID时空的响应也要回, 否则SendContext一直等到超时.
+		if response.PacketID == "" {
+			return
+		}
 		// Add Meta data
 		req.PacketID = response.PacketID
 		req.SessionID = response.SessionID
-
-		// Skip response if it is EmptyPacket
-		if response == EmptyPacket {
-			return
-		}
 		resp, err := json.Marshal(req)
 		if err != nil {
 			log.Logger.Errorf("[!] json marshal error:%v", err)
 		}
 
 		// 发送
-		c.conn.SendTextWithDeadLine(string(resp), WSWait)
+		c.sendText(string(resp))
+	}
+}
+
+func (c *Client) sendText(text string) bool {
+	conn := c.socket()
+	if conn == nil {
+		return false
 	}
+	conn.SendTextWithDeadLine(text, WSWait)
+	return true
 }
 
 // Send sends a packet and trigger callback when the packet comes back
-func (c *Client) Send(request WSPacket, callback func(response WSPacket)) {
+// 连接断开或关闭时callback收到错误, 不会一直等待.
+func (c *Client) Send(request WSPacket, callback func(response WSPacket, err error)) {
 	request.PacketID = uuid.NewV4().String()
+	c.send(request, callback)
+}
+
+func (c *Client) send(request WSPacket, callback func(response WSPacket, err error)) {
 	data, err := json.Marshal(request)
 	if err != nil {
+		if callback != nil {
+			callback(EmptyPacket, err)
+		}
 		return
 	}
 
 	// TODO: Consider using lock free
 	// Wrap callback with sessionID and packetID
 	if callback != nil {
-		wrapperCallback := func(resp WSPacket) {
+		wrapperCallback := func(resp WSPacket, err error) {
 			defer func() {
 				if v := recover(); v != nil {
 					process.DefaultPanicReport.RecoverFromPanic(c.id, "CWS.Client.Send", v)
@@ -116,34 +260,117 @@ func (c *Client) Send(request WSPacket, callback func(response WSPacket)) {
 
 			resp.PacketID = request.PacketID
 			resp.SessionID = request.SessionID
-			callback(resp)
+			callback(resp, err)
 		}
 		c.sendCallbackLock.Lock()
 		c.sendCallback[request.PacketID] = wrapperCallback
 		c.sendCallbackLock.Unlock()
 	}
 
-	c.conn.SendTextWithDeadLine(string(data), WSWait)
+	if !c.sendText(string(data)) {
+		if callback := c.takeCallback(request.PacketID); callback != nil {
+			go callback(EmptyPacket, ErrDisconnected)
+		}
+	}
+}
+
+func (c *Client) takeCallback(packetID string) func(WSPacket, error) {
+	c.sendCallbackLock.Lock()
+	defer c.sendCallbackLock.Unlock()
+
+	callback, ok := c.sendCallback[packetID]
+	if !ok {
+		return nil
+	}
+	delete(c.sendCallback, packetID)
+	return callback
+}
+
+// failPending 连接断开时等待响应的都返回错误.
+func (c *Client) failPending(err error) {
+	c.sendCallbackLock.Lock()
+	pending := c.sendCallback
+	c.sendCallback = map[string]func(WSPacket, error){}
+	c.sendCallbackLock.Unlock()
+
+	for _, callback := range pending {
+		go callback(EmptyPacket, err)
+	}
 }
 
 // 没注册成功?..
+// 被连接的一端, 断开后不重连, 阻塞到连接结束.
 func (c *Client) Listen() {
-	c.conn.OnTextMessage = c.OnTextMessage
-	c.conn.OnBinaryMessage = c.OnBinaryMessage
-	c.conn.OnDisconnected = c.Dispose
-	c.conn.OnConnectError = c.Dispose
+	conn := c.socket()
+	c.register(conn)
+	c.start()
 
-	c.conn.Start()
+	conn.Start()
 }
 
-// 没注册成功?..
+// 主动连接的一端, 断开或心跳超时后按退避间隔重连.
 func (c *Client) Connect() error {
-	c.conn.OnTextMessage = c.OnTextMessage
-	c.conn.OnBinaryMessage = c.OnBinaryMessage
-	// c.conn.OnDisconnected = c.Dispose
-	c.conn.OnConnectError = c.Dispose
+	conn := c.socket()
+	c.url = conn.Url
+	c.reconnect = true
+	c.register(conn)
+	if err := conn.Connect(); err != nil {
+		return err
+	}
+	c.start()
+	return nil
+}
+
+// register 新连接上注册回调, 重连后recvCallback继续有效.
+func (c *Client) register(conn *web.WSocket) {
+	lost := func(err error, socket web.WSocket) {
+		c.lost(conn, err)
+	}
+	conn.OnTextMessage = c.OnTextMessage
+	conn.OnBinaryMessage = c.OnBinaryMessage
+	conn.OnDisconnected = lost
+	conn.OnConnectError = lost
+}
 
-	return c.conn.Connect()
+func (c *Client) start() {
+	atomic.StoreInt64(&c.lastRecv, time.Now().UnixNano())
+	c.startOnce.Do(func() {
+		if c.heartbeat.Interval > 0 {
+			go c.keepalive()
+		}
+	})
+}
+
+// keepalive 定时发心跳, 对端支持心跳时连续Miss个间隔没有消息认为断开.
+func (c *Client) keepalive() {
+	defer func() {
+		if v := recover(); v != nil {
+			process.DefaultPanicReport.RecoverFromPanic(c.id, "CWS.Client.keepalive", v)
+		}
+	}()
+
+	t := time.NewTicker(c.heartbeat.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-t.C:
+			if atomic.LoadInt32(&c.reconnecting) != 0 {
+				continue
+			}
+			last := time.Unix(0, atomic.LoadInt64(&c.lastRecv))
+			if atomic.LoadInt32(&c.peerHeartbeat) != 0 && now.Sub(last) > time.Duration(c.heartbeat.Miss)*c.heartbeat.Interval {
+				log.Logger.Warnf("cws heartbeat timeout, id:%s last:%v", c.id, last)
+				c.lost(c.socket(), ErrHeartbeatTimeout)
+				continue
+			}
+			packet := HeartbeatPacket
+			packet.PacketID = uuid.NewV4().String()
+			data, _ := json.Marshal(packet)
+			c.sendText(string(data))
+		}
+	}
 }
 
 func (c *Client) OnTextMessage(message string, socket web.WSocket) {
@@ -152,47 +379,183 @@ func (c *Client) OnTextMessage(message string, socket web.WSocket) {
 
 // 二进制流也当做string类型处理.
 func (c *Client) OnBinaryMessage(data []byte, socket web.WSocket) {
-	pterm.FgWhite.Println("OnBinaryMessage enter")
+	atomic.StoreInt64(&c.lastRecv, time.Now().UnixNano())
 	wspacket := WSPacket{}
 	err := json.Unmarshal(data, &wspacket)
 	if err != nil {
 		log.Logger.Error("Warn: error decoding", string(data))
 		return
 	}
-	pterm.FgWhite.Printfln("OnBinaryMessage message is:%v c.recvCallback:%v", wspacket, c.recvCallback)
 
-	callback, ok := c.sendCallback[wspacket.PacketID]
-	//c.sendCallbackLock.Unlock()
-	if ok {
-		pterm.FgWhite.Println("OnBinaryMessage sendCallback")
-		go callback(wspacket)
-		//c.sendCallbackLock.Lock()
-		delete(c.sendCallback, wspacket.PacketID)
-		//c.sendCallbackLock.Unlock()
+	// 心跳直接应答, 不交给上层.
+	switch wspacket.ID {
+	case HeartbeatID:
+		ack, _ := json.Marshal(WSPacket{ID: HeartbeatAckID, PacketID: wspacket.PacketID})
+		c.sendText(string(ack))
+		return
+	case HeartbeatAckID:
+		atomic.StoreInt32(&c.peerHeartbeat, 1)
+		return
+	}
+	log.Logger.Debugf("cws receive id:%s packet:%s session:%s, client:%s", wspacket.ID, wspacket.PacketID, wspacket.SessionID, c.id)
+
+	if callback := c.takeCallback(wspacket.PacketID); callback != nil {
+		go callback(wspacket, nil)
 		// Skip receiveCallback to avoid duplication
 		return
 	}
 
 	// Check if some receiver with the ID is registered
-	if callback, ok := c.recvCallback[wspacket.ID]; ok {
+	c.recvCallbackLock.RLock()
+	callback, ok := c.recvCallback[wspacket.ID]
+	if !ok && wspacket.ID != "" && wspacket.Error == nil {
+		callback = c.unknownCallback
+	}
+	c.recvCallbackLock.RUnlock()
+	if callback != nil {
 		go callback(wspacket)
 	}
 }
 
+// SendBinary 直接发送二进制流(如pcm音频帧)，不走WSPacket封装.
+func (c *Client) SendBinary(data []byte) {
+	conn := c.socket()
+	if conn == nil {
+		return
+	}
+	conn.SendBinary(data)
+}
+
+// Close 主动关闭连接, 不再重连.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.connLock.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.connLock.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	c.failPending(ErrClosed)
+}
+
+// Dispose 当前连接断开, 主动连接的一端开始重连.
 func (c *Client) Dispose(err error, socket web.WSocket) {
-	log.Logger.Infof("CloseSocket from:%v %v", socket.Url, err)
-	if c.conn != nil {
-		c.conn.Close()
-		c.conn = nil
+	c.lost(c.socket(), err)
+}
+
+// lost 只处理当前的连接, 重连前旧连接迟到的断开回调忽略.
+func (c *Client) lost(conn *web.WSocket, err error) {
+	if conn == nil {
+		return
+	}
+	c.connLock.Lock()
+	if c.conn != conn {
+		c.connLock.Unlock()
+		return
+	}
+	c.conn = nil
+	c.connLock.Unlock()
+	log.Logger.Infof("CloseSocket from:%v %v, id:%s", conn.Url, err, c.id)
+	conn.Close()
+	c.failPending(ErrDisconnected)
+
+	if !c.reconnect {
+		c.closeOnce.Do(func() {
+			close(c.done)
+		})
+		return
+	}
+	if atomic.CompareAndSwapInt32(&c.reconnecting, 0, 1) {
+		go c.redial()
 	}
 }
 
-// 同步调用知道有响应.
-func (c *Client) SyncSend(request WSPacket) (response WSPacket) {
-	res := make(chan WSPacket)
-	f := func(resp WSPacket) {
-		res <- resp
+// redial 按退避间隔重连, 直到成功或Close.
+func (c *Client) redial() {
+	defer func() {
+		if v := recover(); v != nil {
+			process.DefaultPanicReport.RecoverFromPanic(c.id, "CWS.Client.redial", v)
+		}
+	}()
+	defer atomic.StoreInt32(&c.reconnecting, 0)
+
+	delay := c.backoff.Min
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(delay):
+		}
+
+		conn := web.New(c.url)
+		c.register(conn)
+		err := conn.Connect()
+		if err == nil {
+			c.connLock.Lock()
+			closed := false
+			select {
+			case <-c.done:
+				closed = true
+			default:
+				c.conn = conn
+			}
+			c.connLock.Unlock()
+			if closed {
+				conn.Close()
+				return
+			}
+
+			log.Logger.Infof("cws reconnected, id:%s url:%s", c.id, c.url)
+			atomic.StoreInt64(&c.lastRecv, time.Now().UnixNano())
+			for _, f := range c.onReconnect {
+				f()
+			}
+			return
+		}
+
+		log.Logger.Warnf("cws reconnect failed: %v, id:%s url:%s retry in %v", err, c.id, c.url, delay)
+		if delay *= 2; delay > c.backoff.Max {
+			delay = c.backoff.Max
+		}
+	}
+}
+
+// SyncSend 同步调用直到有响应, 超过sendTimeout或连接断开时返回错误.
+// 响应带Error时同时返回该错误.
+func (c *Client) SyncSend(request WSPacket) (WSPacket, error) {
+	ctx := context.Background()
+	if c.sendTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.sendTimeout)
+		defer cancel()
+	}
+	return c.SendContext(ctx, request)
+}
+
+// SendContext 同步调用, ctx结束时不再等待, 迟到的响应丢弃.
+func (c *Client) SendContext(ctx context.Context, request WSPacket) (WSPacket, error) {
+	type result struct {
+		resp WSPacket
+		err  error
+	}
+	res := make(chan result, 1)
+	packetID := uuid.NewV4().String()
+	request.PacketID = packetID
+	c.send(request, func(resp WSPacket, err error) {
+		res <- result{resp, err}
+	})
+
+	select {
+	case r := <-res:
+		if r.err == nil && r.resp.Error != nil {
+			return r.resp, r.resp.Error
+		}
+		return r.resp, r.err
+	case <-ctx.Done():
+		c.takeCallback(packetID)
+		return EmptyPacket, ctx.Err()
 	}
-	c.Send(request, f)
-	return <-res
 }
@@ -0,0 +1,362 @@
+package cws
+
+import (
+	"common/web"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newWsServer 每个连接交给handle, n为第几次连接, 从0开始.
+func newWsServer(t *testing.T, handle func(n int, w http.ResponseWriter, r *http.Request)) string {
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle(int(atomic.AddInt32(&count, 1)-1), w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func upgrade(t *testing.T, w http.ResponseWriter, r *http.Request) *websocket.Conn {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	return conn
+}
+
+func readPacket(conn *websocket.Conn) (WSPacket, error) {
+	packet := WSPacket{}
+	_, data, err := conn.ReadMessage()
+	if err == nil {
+		err = json.Unmarshal(data, &packet)
+	}
+	return packet, err
+}
+
+// connectClient 连接url的client, 重连间隔10ms开始.
+func connectClient(url string, heartbeat HeartbeatConfig) *Client {
+	c := NewClient("test", web.New(url))
+	c.SetHeartbeat(heartbeat)
+	c.SetBackoff(BackoffConfig{Min: 10 * time.Millisecond, Max: 40 * time.Millisecond})
+	return c
+}
+
+// start 连接, 测试结束时关闭.
+func start(t *testing.T, c *Client) {
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+}
+
+// 对端不再应答心跳时断开, 等待中的SyncSend返回ErrDisconnected, 之后重连.
+func TestHeartbeatMiss(t *testing.T) {
+	url := newWsServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		conn := upgrade(t, w, r)
+		if conn == nil {
+			return
+		}
+		defer conn.Close()
+		acked := false
+		for {
+			packet, err := readPacket(conn)
+			if err != nil {
+				return
+			}
+			// 第一个连接只应答一次心跳, 请求也不回复.
+			if packet.ID == HeartbeatID && (n > 0 || !acked) {
+				acked = true
+				conn.WriteJSON(WSPacket{ID: HeartbeatAckID, PacketID: packet.PacketID})
+			}
+		}
+	})
+
+	c := connectClient(url, HeartbeatConfig{Interval: 20 * time.Millisecond, Miss: 2})
+	reconnected := make(chan struct{}, 1)
+	c.OnReconnect(func() { reconnected <- struct{}{} })
+	c.SetSendTimeout(0)
+	start(t, c)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := c.SyncSend(WSPacket{ID: "hold"})
+		errs <- err
+	}()
+	select {
+	case err := <-errs:
+		if err != ErrDisconnected {
+			t.Fatalf("got %v, want %v", err, ErrDisconnected)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending send not failed")
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("not reconnected")
+	}
+}
+
+// 重连失败时间隔从Min开始翻倍, 到Max为止.
+func TestRedialBackoff(t *testing.T) {
+	attempts := make(chan time.Time, 8)
+	url := newWsServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		attempts <- time.Now()
+		switch {
+		case n == 0:
+			// 连上后马上断开.
+			if conn := upgrade(t, w, r); conn != nil {
+				conn.Close()
+			}
+		case n < 4:
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		default:
+			if conn := upgrade(t, w, r); conn != nil {
+				defer conn.Close()
+				for {
+					if _, err := readPacket(conn); err != nil {
+						return
+					}
+				}
+			}
+		}
+	})
+
+	c := connectClient(url, HeartbeatConfig{})
+	reconnected := make(chan struct{}, 1)
+	c.OnReconnect(func() { reconnected <- struct{}{} })
+	start(t, c)
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("not reconnected")
+	}
+
+	var times []time.Time
+	for i := 0; i < 5; i++ {
+		times = append(times, <-attempts)
+	}
+	// 断开后依次等10ms, 20ms, 40ms, 40ms, 第一次包括断开的时间不检查.
+	const slack = 5 * time.Millisecond
+	for i, want := range []time.Duration{20, 40, 40} {
+		if gap := times[i+2].Sub(times[i+1]); gap < want*time.Millisecond-slack {
+			t.Fatalf("attempt %d after %v, want at least %vms", i+2, gap, want)
+		}
+	}
+}
+
+// 重连后已注册的Receive继续处理, 新连接上的SyncSend正常返回.
+func TestReconnectKeepsHandlers(t *testing.T) {
+	pong := make(chan WSPacket, 1)
+	url := newWsServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		conn := upgrade(t, w, r)
+		if conn == nil {
+			return
+		}
+		defer conn.Close()
+		if n == 0 {
+			return
+		}
+		conn.WriteJSON(WSPacket{ID: "ping", PacketID: "p1"})
+		for {
+			packet, err := readPacket(conn)
+			if err != nil {
+				return
+			}
+			switch packet.ID {
+			case "pong":
+				pong <- packet
+			case "echo":
+				conn.WriteJSON(packet)
+			}
+		}
+	})
+
+	c := connectClient(url, HeartbeatConfig{})
+	c.Receive("ping", func(req WSPacket) WSPacket {
+		return WSPacket{ID: "pong", Data: req.Data}
+	})
+	reconnected := make(chan struct{}, 1)
+	c.OnReconnect(func() { reconnected <- struct{}{} })
+	start(t, c)
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("not reconnected")
+	}
+
+	select {
+	case packet := <-pong:
+		if packet.PacketID != "p1" {
+			t.Fatalf("got %+v", packet)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler not called after reconnect")
+	}
+	resp, err := c.SyncSend(WSPacket{ID: "echo", Data: "x"})
+	if err != nil || resp.Data != "x" {
+		t.Fatalf("got %+v %v", resp, err)
+	}
+}
+
+// Close后等待中的SyncSend返回ErrClosed, 之后的发送返回ErrDisconnected.
+func TestClosePending(t *testing.T) {
+	received := make(chan struct{}, 1)
+	url := newWsServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if conn := upgrade(t, w, r); conn != nil {
+			defer conn.Close()
+			for {
+				if _, err := readPacket(conn); err != nil {
+					return
+				}
+				received <- struct{}{}
+			}
+		}
+	})
+
+	c := connectClient(url, HeartbeatConfig{})
+	c.SetSendTimeout(0)
+	start(t, c)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := c.SyncSend(WSPacket{ID: "hold"})
+		errs <- err
+	}()
+	<-received
+	c.Close()
+	select {
+	case err := <-errs:
+		if err != ErrClosed {
+			t.Fatalf("got %v, want %v", err, ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pending send not failed")
+	}
+	if _, err := c.SyncSend(WSPacket{ID: "hold"}); err != ErrDisconnected {
+		t.Fatalf("got %v, want %v", err, ErrDisconnected)
+	}
+}
+
+// newServerClient 每个连接由一个Listen的Client处理, register注册命令.
+func newServerClient(t *testing.T, register func(c *Client)) string {
+	return newWsServer(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if conn := upgrade(t, w, r); conn != nil {
+			server := NewClient("server", web.NewWSocket(conn))
+			server.SetHeartbeat(HeartbeatConfig{})
+			register(server)
+			server.Listen()
+		}
+	})
+}
+
+// SendContext超时和取消时返回ctx的错误, 迟到的响应丢弃, 之后的请求不受影响.
+func TestSendContext(t *testing.T) {
+	release := make(chan struct{})
+	url := newServerClient(t, func(server *Client) {
+		server.Receive("slow", func(req WSPacket) WSPacket {
+			<-release
+			return WSPacket{ID: "slow", Data: req.Data}
+		})
+		server.Receive("echo", func(req WSPacket) WSPacket {
+			return WSPacket{ID: "echo", Data: req.Data}
+		})
+	})
+	defer close(release)
+
+	c := connectClient(url, HeartbeatConfig{})
+	start(t, c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.SendContext(ctx, WSPacket{ID: "slow", Data: "1"}); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := c.SendContext(ctx, WSPacket{ID: "slow", Data: "2"}); err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	c.SetSendTimeout(20 * time.Millisecond)
+	if _, err := c.SyncSend(WSPacket{ID: "slow", Data: "3"}); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	c.sendCallbackLock.Lock()
+	pending := len(c.sendCallback)
+	c.sendCallbackLock.Unlock()
+	if pending != 0 {
+		t.Fatalf("%d callbacks left", pending)
+	}
+
+	c.SetSendTimeout(time.Second)
+	release <- struct{}{}
+	resp, err := c.SyncSend(WSPacket{ID: "echo", Data: "4"})
+	if err != nil || resp.Data != "4" {
+		t.Fatalf("got %+v %v", resp, err)
+	}
+}
+
+// 失败响应的PacketError经过json后由SyncSend返回.
+func TestSyncSendPacketError(t *testing.T) {
+	url := newServerClient(t, func(server *Client) {
+		server.Receive("join", func(req WSPacket) WSPacket {
+			return ErrorPacket("join", CodeNotFound, "room %s not found", req.RoomID)
+		})
+	})
+	c := connectClient(url, HeartbeatConfig{})
+	start(t, c)
+
+	resp, err := c.SyncSend(WSPacket{ID: "join", RoomID: "r1", SessionID: "s1"})
+	perr, ok := err.(*PacketError)
+	if !ok {
+		t.Fatalf("got %v, want PacketError", err)
+	}
+	if perr.Code != CodeNotFound || perr.Message != "room r1 not found" || resp.Error != perr {
+		t.Fatalf("got %+v, resp %+v", perr, resp)
+	}
+	if resp.ID != "join" || resp.SessionID != "s1" {
+		t.Fatalf("got %+v", resp)
+	}
+}
+
+// 处理返回EmptyPacket时带PacketID的请求也收到响应, 没有PacketID的不回复.
+func TestEmptyResponse(t *testing.T) {
+	url := newServerClient(t, func(server *Client) {
+		server.Receive("ack", func(req WSPacket) WSPacket {
+			return EmptyPacket
+		})
+	})
+	c := connectClient(url, HeartbeatConfig{})
+	c.SetSendTimeout(time.Second)
+	start(t, c)
+	resp, err := c.SyncSend(WSPacket{ID: "ack", SessionID: "s1"})
+	if err != nil || resp.ID != "" || resp.SessionID != "s1" {
+		t.Fatalf("got %+v %v", resp, err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(WSPacket{ID: "ack"}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if packet, err := readPacket(conn); err == nil {
+		t.Fatalf("fire-and-forget request got %+v", packet)
+	}
+}
@@ -1,10 +1,73 @@
 package entity
 
+import (
+	"fmt"
+	"net"
+)
+
 const (
 	// 共用吧.
 	NoData = ""
 
-	InitAsr = "asr_init"
-	Answer     = "answer"
+	InitAsr      = "asr_init"
+	InitEarlyAsr = "asr_init_early" // 早媒体识别, 振铃/运营商提示音.
+	Answer       = "answer"
+	EarlyResult  = "early_result"
+)
 
+// 早媒体识别结果分类.
+const (
+	EarlyResultBusy        = "busy"
+	EarlyResultUnreachable = "unreachable"
+	EarlyResultPowerOff    = "poweroff"
+	EarlyResultInvalid     = "invalid" // 空号.
+	EarlyResultNoAnswer    = "noanswer"
+	EarlyResultVoicemail   = "voicemail"
+	EarlyResultUnknown     = "unknown" // 超时未识别.
 )
+
+// asr_init对应的命令, IMS侧的rtp地址和编码.
+type AsrInitCall struct {
+	Zone        string `json:"zone,omitempty"` // default: udp
+	Addr        string `json:"addr,omitempty"` // IMS侧rtp地址, ip:port
+	PayloadType int    `json:"payload"`
+	Codec       string `json:"codec,omitempty"`      // PCMU/PCMA/L16, default: PCMU
+	SampleRate  int    `json:"sampleRate,omitempty"` // default: 8000
+	Frame       int    `json:"frame,omitempty"`      // 每帧发给asr的时长ms, default: 20
+}
+
+func (packet *AsrInitCall) From(data string) error { return from(packet, data) }
+func (packet *AsrInitCall) To() (string, error)    { return to(packet) }
+
+func (packet *AsrInitCall) Validate() error {
+	if _, _, err := net.SplitHostPort(packet.Addr); err != nil {
+		return fmt.Errorf("invalid addr %q: %v", packet.Addr, err)
+	}
+	if packet.PayloadType < 0 || packet.PayloadType > 127 {
+		return fmt.Errorf("invalid payload type %d", packet.PayloadType)
+	}
+	if packet.SampleRate < 0 || packet.Frame < 0 {
+		return fmt.Errorf("invalid sample rate %d or frame %d", packet.SampleRate, packet.Frame)
+	}
+	return nil
+}
+
+// asr_init对应的响应, 本端接收rtp的地址.
+type AsrAnswer struct {
+	Addr        string `json:"addr"` // ip:port
+	PayloadType int    `json:"payload"`
+	Codec       string `json:"codec"`
+	SampleRate  int    `json:"sampleRate"`
+}
+
+func (packet *AsrAnswer) From(data string) error { return from(packet, data) }
+func (packet *AsrAnswer) To() (string, error)    { return to(packet) }
+
+// early_result, asr服务返回识别文本或直接返回分类, 同样格式回给调用方.
+type EarlyMediaResult struct {
+	Result string `json:"result,omitempty"`
+	Text   string `json:"text,omitempty"`
+}
+
+func (packet *EarlyMediaResult) From(data string) error { return from(packet, data) }
+func (packet *EarlyMediaResult) To() (string, error)    { return to(packet) }
@@ -0,0 +1,52 @@
+package entity
+
+import "errors"
+
+// 协议版本, 连接后coordinator先发hello协商, 没有协商时按版本1处理(只有start/quit).
+const (
+	ProtocolVersion    = 2
+	MinProtocolVersion = 1
+
+	Hello = "hello"
+)
+
+// Command 带校验的命令数据, worker解码后先校验再处理.
+type Command interface {
+	From(data string) error
+	Validate() error
+}
+
+// hello对应的命令, coordinator支持的所有版本.
+type HelloCall struct {
+	Versions []int `json:"versions"`
+}
+
+func (packet *HelloCall) From(data string) error { return from(packet, data) }
+func (packet *HelloCall) To() (string, error)    { return to(packet) }
+
+func (packet *HelloCall) Validate() error {
+	if len(packet.Versions) == 0 {
+		return errors.New("versions required")
+	}
+	return nil
+}
+
+// hello对应的响应, 协商的版本和该版本可用的命令.
+type HelloRsp struct {
+	Version  int      `json:"version"`
+	Commands []string `json:"commands"`
+}
+
+func (packet *HelloRsp) From(data string) error { return from(packet, data) }
+func (packet *HelloRsp) To() (string, error)    { return to(packet) }
+
+// NegotiateVersion 双方都支持的最高版本, 没有时返回false.
+func NegotiateVersion(versions []int) (int, bool) {
+	version := 0
+	for _, v := range versions {
+		if v >= MinProtocolVersion && v <= ProtocolVersion && v > version {
+			version = v
+		}
+	}
+	return version, version != 0
+}
@@ -1,6 +1,11 @@
 package entity
 
-import "xmediaEmu/pkg/cws"
+import (
+	"errors"
+	"fmt"
+	"net"
+	"xmediaEmu/pkg/cws"
+)
 
 const (
 	// 视频增强处理.
@@ -11,6 +16,38 @@ const (
 	RoomStart   = "start"
 	RoomStarted = "started"
 	RoomQuit    = "quit"
+
+	// 协议版本2, 响应和命令同一个id.
+	ListRooms  = "list_rooms"
+	PauseRoom  = "pause"  // 暂停发送音视频, 游戏继续运行.
+	ResumeRoom = "resume" // 恢复发送, 从关键帧开始.
+	Resolution = "resolution"
+	Keyframe   = "keyframe"
+
+	// 协议版本2, worker主动上报游戏事件, 如菜单选中.
+	GameEvent = "game_event"
+)
+
+// 分辨率范围, I420要求宽高为偶数.
+const (
+	MinResolution = 16
+	MaxResolution = 4096
+)
+
+// close_room的原因.
+const (
+	CloseReasonEmpty     = "empty"        // 最后一个session离开.
+	CloseReasonIdle      = "idle"         // 空闲超时没有session加入.
+	CloseReasonNoMedia   = "no_media"     // 对端没有rtp/rtcp.
+	CloseReasonMaxCall   = "max_duration" // 超过最长通话时长.
+	CloseReasonDeleted   = "deleted"      // http接口删除.
+	CloseReasonGameError = "game_error"   // 游戏创建失败或异常结束.
+)
+
+// session状态.
+const (
+	SessionStarting = "starting"
+	SessionRunning  = "running"
 )
 
 // RoomStart对应的命令.
@@ -23,27 +60,155 @@ type RoomStartCall struct {
 	// TODO: 定义ip 和port直接传送.
 	Zone string `json:"zone,omitempty"` // default: udp
 	Addr string `json:"addr,omitempty"` // ip:port string
+	// 音频对端地址, 为空时和视频同一个地址.
+	AudioAddr string `json:"audioAddr,omitempty"`
+
+	// 对端sdp offer, 带上时忽略上面的地址和负载类型.
+	Sdp string `json:"sdp,omitempty"`
+
+	// 创建游戏的参数, 各个游戏按需使用.
+	Url    string            `json:"url,omitempty"`  // 网页地址.
+	Dir    string            `json:"dir,omitempty"`  // 素材目录.
+	Text   string            `json:"text,omitempty"` // 显示的文字.
+	Params map[string]string `json:"params,omitempty"`
 }
 
 func (packet *RoomStartCall) From(data string) error { return from(packet, data) }
 func (packet *RoomStartCall) To() (string, error)    { return to(packet) }
 
+func (packet *RoomStartCall) Validate() error {
+	if packet.Sdp == "" && packet.Addr == "" {
+		return errors.New("sdp or addr required")
+	}
+	for _, addr := range []string{packet.Addr, packet.AudioAddr} {
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid addr %q: %v", addr, err)
+		}
+	}
+	for _, pt := range []int{packet.AudioPayloadType, packet.VideoPayloadType} {
+		if pt < 0 || pt > 127 {
+			return fmt.Errorf("invalid payload type %d", pt)
+		}
+	}
+	return nil
+}
+
 // RoomStart对应的响应.
 type RoomStartRsp struct {
 	RoomId string `json:"room"`
-	Sdp    string `json:"sdp,omitempty"` // SdpOffer结构体.
+	Sdp    string `json:"sdp,omitempty"` // sdp answer.
 }
 
 func (packet *RoomStartRsp) From(data string) error { return from(packet, data) }
 func (packet *RoomStartRsp) To() (string, error)    { return to(packet) }
 
+// get_room, pause, resume, keyframe对应的命令.
+type RoomCall struct {
+	RoomId string `json:"room"`
+}
+
+func (packet *RoomCall) From(data string) error { return from(packet, data) }
+func (packet *RoomCall) To() (string, error)    { return to(packet) }
+
+func (packet *RoomCall) Validate() error {
+	if packet.RoomId == "" {
+		return errors.New("room required")
+	}
+	return nil
+}
+
+// resolution对应的命令, 下一帧生效.
+type ResolutionCall struct {
+	RoomId string `json:"room"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+func (packet *ResolutionCall) From(data string) error { return from(packet, data) }
+func (packet *ResolutionCall) To() (string, error)    { return to(packet) }
+
+func (packet *ResolutionCall) Validate() error {
+	if packet.RoomId == "" {
+		return errors.New("room required")
+	}
+	for _, v := range []int{packet.Width, packet.Height} {
+		if v < MinResolution || v > MaxResolution || v%2 != 0 {
+			return fmt.Errorf("invalid resolution %dx%d", packet.Width, packet.Height)
+		}
+	}
+	return nil
+}
+
+// room的状态, get_room等命令的响应.
+type RoomInfo struct {
+	RoomId   string   `json:"room"`
+	Game     string   `json:"game"`
+	Sessions []string `json:"sessions"`
+	Paused   bool     `json:"paused"`
+	Width    int      `json:"width"` // 当前编码的分辨率, 还没有输出时为0.
+	Height   int      `json:"height"`
+}
+
+func (packet *RoomInfo) From(data string) error { return from(packet, data) }
+func (packet *RoomInfo) To() (string, error)    { return to(packet) }
+
+// session的状态, http接口查询.
+type SessionInfo struct {
+	SessionId    string `json:"session"`
+	RoomId       string `json:"room"`
+	State        string `json:"state"`
+	LastReceived int64  `json:"lastReceived,omitempty"` // 最后收到rtp/rtcp的时间, unix毫秒.
+}
+
+// list_rooms对应的响应.
+type RoomListRsp struct {
+	Rooms []RoomInfo `json:"rooms"`
+}
+
+func (packet *RoomListRsp) From(data string) error { return from(packet, data) }
+func (packet *RoomListRsp) To() (string, error)    { return to(packet) }
+
 type ConnectionRequest struct {
 	Zone string `json:"zone,omitempty"` // default: udp
 	Addr string `json:"addr,omitempty"`
 	// IsHTTPS  bool   `json:"is_https,omitempty"`
 }
 
-// close room.data只有roomId.
-func CloseRoomPacket(data string) cws.WSPacket { return cws.WSPacket{ID: CloseRoom, Data: data} }
+// close room, data为CloseRoomRsp, session超时时带上sessionID, room关闭时为空.
+func CloseRoomPacket(roomID, sessionID, reason string) cws.WSPacket {
+	rsp := CloseRoomRsp{RoomId: roomID, SessionId: sessionID, Reason: reason}
+	data, _ := rsp.To()
+	return cws.WSPacket{ID: CloseRoom, RoomID: roomID, SessionID: sessionID, Data: data}
+}
 
 // func RegisterRoomPacket(data string) cws.WSPacket { return cws.WSPacket{ID: RegisterRoom, Data: data} }
+
+// close_room, worker主动关闭room或session.
+type CloseRoomRsp struct {
+	RoomId    string `json:"room"`
+	SessionId string `json:"session,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+func (packet *CloseRoomRsp) From(data string) error { return from(packet, data) }
+func (packet *CloseRoomRsp) To() (string, error)    { return to(packet) }
+
+// game_event, 游戏上报的事件, data为各游戏定义的json.
+type GameEventRsp struct {
+	RoomId string      `json:"room"`
+	Event  string      `json:"event"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+func (packet *GameEventRsp) From(data string) error { return from(packet, data) }
+func (packet *GameEventRsp) To() (string, error)    { return to(packet) }
+
+// GameEventPacket room里游戏上报的事件.
+func GameEventPacket(roomID, event string, data interface{}) cws.WSPacket {
+	rsp := GameEventRsp{RoomId: roomID, Event: event, Data: data}
+	body, _ := rsp.To()
+	return cws.WSPacket{ID: GameEvent, RoomID: roomID, Data: body}
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // 以下信息从没配置文件读取.
 type Config struct {
 	Encoder EncoderConfig
@@ -7,6 +9,18 @@ type Config struct {
 	Height  int
 
 	LocalMediaIp string
+	// 只接受RTP/SAVP的offer, 跨不可信网络时打开.
+	SrtpRequired bool
+	// 对端不支持telephone-event时, 在语音里检测dtmf.
+	InbandDtmf bool
+	// 超时, 为0时不检测.
+	Timeout TimeoutConfig
+}
+
+type TimeoutConfig struct {
+	NoMedia  time.Duration // 没有收到对端rtp/rtcp, 对应T1.
+	MaxCall  time.Duration // 最长通话时长, 对应T2.
+	RoomIdle time.Duration // 最后一个session离开后room保留的时长, 为0时立即关闭.
 }
 
 type EncoderConfig struct {
@@ -50,7 +64,8 @@ const (
 	// TODO:支持vpx.
 
 	// 音频.
-	G711  AudioCodec = "h264"
+	G711  AudioCodec = "g711"  // PCMU.
+	G711A AudioCodec = "g711a" // PCMA.
 	AMRNB AudioCodec = "AmrNb"
 	AMRWB AudioCodec = "Amrwb"
 	PCM   AudioCodec = "PCM" // pcm原始码流.
@@ -18,7 +18,8 @@ type Game interface {
 
 // run context.
 type contextImpl struct {
-	game Game
+	game  Game
+	input *inpututil.InputManager
 
 	// The following members must be protected by the mutex m.
 	// 支持手机旋转.
@@ -33,9 +34,10 @@ type contextImpl struct {
 	m sync.Mutex
 }
 
-func newContextImpl(game Game) *contextImpl {
+func newContextImpl(game Game, input *inpututil.InputManager) *contextImpl {
 	return &contextImpl{
-		game: game,
+		game:  game,
+		input: input,
 		// cl: clock.NewClock(),
 		globalState: newGlobalState(),
 	}
@@ -85,7 +87,7 @@ func (c *contextImpl) updateFrameImpl(outsideWidth, outsideHeight int, screen *i
 	if err := c.game.Update(); err != nil {
 		return err
 	}
-	Get().resetForTick()
+	c.input.GetInput().ResetForTick()
 	//}
 
 	// Draw the game.
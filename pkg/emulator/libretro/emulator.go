@@ -32,6 +32,7 @@ type NaEmulator struct {
 	roomID          string
 	gameName        string
 	isSavingLoading bool
+	params          games.Params // 创建游戏的参数.
 
 	// 每次电话都是无状态的.
 	// storage         Storage
@@ -138,16 +139,28 @@ func New(roomID string, withImageChannel bool, inputChannel <-chan InputEvent, u
 	return emu, imageChannel, audioChannel
 }
 
-// 重新调整窗口大小..
+// SetGameParams 设置创建游戏的参数, 在Start之前调用.
+func (na *NaEmulator) SetGameParams(params games.Params) {
+	na.params = params
+}
+
+// 重新调整窗口大小, 窗口创建后在下一帧生效.
 func (na *NaEmulator) SetViewport(width int, height int) {
 	// outputImg is tmp img used for decoding and reuse in encoding flow
-	// TODO: 暂时不支持运行中调增大小.
-	na.game.SetWindowSize(width, height)
+	if !na.game.SetWindowSize(width, height) {
+		na.game.Resize(width, height)
+	}
 	// outputImg = image.NewRGBA(image.Rect(0, 0, width, height))
 }
 
 // 模拟器开始.暂时不支持游戏保存功能.
+// 游戏结束后关闭输出channel, 渲染线程结束前不能关闭.
 func (na *NaEmulator) Start() error {
+	defer func() {
+		close(na.imageChannel)
+		close(na.audioChannel)
+	}()
+
 	gameLogic, err := na.LoadGame()
 	if err != nil {
 		log.Logger.Errorf("error: couldn't load a save, %v", err)
@@ -160,30 +173,22 @@ func (na *NaEmulator) Start() error {
 		log.Logger.Errorf("Run game failed: %v.\n ", err)
 		return err
 	}
-	na.Close()
 	log.Logger.Info("Closed Director")
 	return nil
 }
 
-// 所有游戏根据名字在此增加入口.
+// LoadGame 按名字创建games里注册的游戏, 没有注册时返回错误.
 func (na *NaEmulator) LoadGame() (*GameForUI, error) {
-	switch na.game.GetGameName() {
-	case "text":
-		return NewGameForUI(&games.Game{}), nil
-	case "image":
-		return NewGameForUI(&games.GameImage{Index: 0}), nil
-	case "chromedp": // chromedp应用.
-		return NewGameForUI(games.NewGameChromeDp()), nil
-	default: // 演示用的.
-		return NewGameForUI(&games.Game{}), nil
+	game, err := games.New(na.game.GetGameName(), na.params)
+	if err != nil {
+		return nil, err
 	}
-	// return nil, errors.New("")
+	return NewGameForUI(game), nil
 }
 
+// Close 停止游戏, 输出channel在Start返回时关闭.
 func (na *NaEmulator) Close() {
-	na.game.SetRunning(false)
-	close(na.imageChannel)
-	close(na.audioChannel)
+	na.game.Close()
 }
 
 // 获取当前显示图像内容.
@@ -16,3 +16,9 @@ type VideoExporter struct {
 	sock         net.Conn
 	imageChannel chan<- GameFrame
 }
+
+// audioChannel输出的pcm格式, 16bit交错立体声.
+const (
+	AudioSampleRate = 44100
+	AudioChannels   = 2
+)
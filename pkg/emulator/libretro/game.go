@@ -1,6 +1,7 @@
 package libretro
 
 import (
+	"io"
 	"sync/atomic"
 	iImage "xmediaEmu/pkg/image"
 	"xmediaEmu/pkg/inpututil"
@@ -30,6 +31,11 @@ type GameUser interface {
 	Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeight int)
 }
 
+// InputReceiver 游戏需要按键或语音输入时实现, 运行前注入所在UserInterface的InputManager.
+type InputReceiver interface {
+	SetInputMgr(input *inpututil.InputManager)
+}
+
 // 简单的视频逻辑展示.
 type GameForUI struct {
 	game GameUser
@@ -144,6 +150,13 @@ func (c *GameForUI) IsRunGameEnded() bool {
 func (c *GameForUI) RunGame(ui *UserInterface) error {
 	defer atomic.StoreInt32(&c.isRunGameEnded, 1)
 
+	if receiver, ok := c.game.(InputReceiver); ok {
+		receiver.SetInputMgr(ui.GetInputMgr())
+	}
+	// 占用外部资源的游戏(如浏览器)实现io.Closer, 结束时释放.
+	if closer, ok := c.game.(io.Closer); ok {
+		defer closer.Close()
+	}
 	if err := ui.Run(c); err != nil {
 		return err
 	}
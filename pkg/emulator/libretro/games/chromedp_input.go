@@ -0,0 +1,177 @@
+package games
+
+import (
+	"github.com/chromedp/cdproto/input"
+	"github.com/chromedp/chromedp"
+	"github.com/chromedp/chromedp/kb"
+	"runtime"
+	"unicode"
+	"xmediaEmu/pkg/inpututil"
+)
+
+// 滚动一格对应的像素.
+const wheelDelta = 100
+
+// inpututil按键对应kb里的按键, 修饰键只作为modifiers发送.
+var chromeKeys = map[inpututil.Key]string{
+	inpututil.KeyArrowDown:  kb.ArrowDown,
+	inpututil.KeyArrowLeft:  kb.ArrowLeft,
+	inpututil.KeyArrowRight: kb.ArrowRight,
+	inpututil.KeyArrowUp:    kb.ArrowUp,
+	inpututil.KeyBackspace:  kb.Backspace,
+	inpututil.KeyDelete:     kb.Delete,
+	inpututil.KeyEnd:        kb.End,
+	inpututil.KeyEnter:      kb.Enter,
+	inpututil.KeyEscape:     kb.Escape,
+	inpututil.KeyHome:       kb.Home,
+	inpututil.KeyInsert:     kb.Insert,
+	inpututil.KeyPageDown:   kb.PageDown,
+	inpututil.KeyPageUp:     kb.PageUp,
+	inpututil.KeySpace:      " ",
+	inpututil.KeyTab:        kb.Tab,
+
+	inpututil.KeyBackquote:    "`",
+	inpututil.KeyBackslash:    kb.Backslash,
+	inpututil.KeyBracketLeft:  "[",
+	inpututil.KeyBracketRight: "]",
+	inpututil.KeyComma:        ",",
+	inpututil.KeyEqual:        "=",
+	inpututil.KeyMinus:        "-",
+	inpututil.KeyPeriod:       ".",
+	inpututil.KeyQuote:        kb.Quote,
+	inpututil.KeySemicolon:    ";",
+	inpututil.KeySlash:        "/",
+
+	inpututil.KeyNumpadAdd:      "+",
+	inpututil.KeyNumpadDecimal:  ".",
+	inpututil.KeyNumpadDivide:   "/",
+	inpututil.KeyNumpadEnter:    kb.Enter,
+	inpututil.KeyNumpadEqual:    "=",
+	inpututil.KeyNumpadMultiply: "*",
+	inpututil.KeyNumpadSubtract: "-",
+
+	inpututil.KeyF1:  kb.F1,
+	inpututil.KeyF2:  kb.F2,
+	inpututil.KeyF3:  kb.F3,
+	inpututil.KeyF4:  kb.F4,
+	inpututil.KeyF5:  kb.F5,
+	inpututil.KeyF6:  kb.F6,
+	inpututil.KeyF7:  kb.F7,
+	inpututil.KeyF8:  kb.F8,
+	inpututil.KeyF9:  kb.F9,
+	inpututil.KeyF10: kb.F10,
+	inpututil.KeyF11: kb.F11,
+	inpututil.KeyF12: kb.F12,
+}
+
+func init() {
+	for k := inpututil.KeyA; k <= inpututil.KeyZ; k++ {
+		chromeKeys[k] = string(rune('a' + int(k-inpututil.KeyA)))
+	}
+	for k := inpututil.KeyDigit0; k <= inpututil.KeyDigit9; k++ {
+		chromeKeys[k] = string(rune('0' + int(k-inpututil.KeyDigit0)))
+	}
+	for k := inpututil.KeyNumpad0; k <= inpututil.KeyNumpad9; k++ {
+		chromeKeys[k] = string(rune('0' + int(k-inpututil.KeyNumpad0)))
+	}
+}
+
+// 当前按下的修饰键.
+func (g *GameChromeDp) modifiers() input.Modifier {
+	var m input.Modifier
+	if g.input.KeyPressDuration(inpututil.KeyAlt) > 0 {
+		m |= input.ModifierAlt
+	}
+	if g.input.KeyPressDuration(inpututil.KeyControl) > 0 {
+		m |= input.ModifierCtrl
+	}
+	if g.input.KeyPressDuration(inpututil.KeyMeta) > 0 {
+		m |= input.ModifierMeta
+	}
+	if g.input.KeyPressDuration(inpututil.KeyShift) > 0 {
+		m |= input.ModifierShift
+	}
+	return m
+}
+
+// keyEvents 按键在这个tick的按下和松开事件, 可打印的按键按下时带char事件.
+func keyEvents(key inpututil.Key, pressed bool, modifiers input.Modifier) []*input.DispatchKeyEventParams {
+	name, ok := chromeKeys[key]
+	if !ok {
+		return nil
+	}
+	r := []rune(name)[0]
+	if modifiers&input.ModifierShift != 0 && key >= inpututil.KeyA && key <= inpututil.KeyZ {
+		r = unicode.ToUpper(r)
+	}
+	v, ok := kb.Keys[r]
+	if !ok {
+		return nil
+	}
+
+	event := input.DispatchKeyEventParams{
+		Modifiers:             modifiers,
+		Key:                   v.Key,
+		Code:                  v.Code,
+		NativeVirtualKeyCode:  v.Native,
+		WindowsVirtualKeyCode: v.Windows,
+	}
+	if runtime.GOOS == "darwin" {
+		event.NativeVirtualKeyCode = 0
+	}
+	// 小键盘的code和主键盘不同.
+	if key >= inpututil.KeyNumpad0 && key <= inpututil.KeyNumpadSubtract {
+		event.Code = key.String()
+		event.Location = 3
+	}
+
+	if !pressed {
+		event.Type = input.KeyUp
+		return []*input.DispatchKeyEventParams{&event}
+	}
+	event.Type = input.KeyDown
+	events := []*input.DispatchKeyEventParams{&event}
+	// ctrl/alt/meta组合键不输入文字.
+	if v.Print && modifiers&^input.ModifierShift == 0 {
+		char := event
+		char.Type = input.KeyChar
+		char.Text = v.Text
+		char.UnmodifiedText = v.Unmodified
+		events = append(events, &char)
+	}
+	return events
+}
+
+// inputActions 上一个tick以来的按键, 鼠标移动和滚动转换成CDP输入事件.
+func (g *GameChromeDp) inputActions() []chromedp.Action {
+	var actions []chromedp.Action
+	modifiers := g.modifiers()
+	// 按键值顺序发送, 同一个tick里的按键顺序固定.
+	for key := inpututil.Key(0); key < inpututil.KeyMax; key++ {
+		var events []*input.DispatchKeyEventParams
+		if g.input.IsKeyJustPressed(key) {
+			events = keyEvents(key, true, modifiers)
+		} else if g.input.IsKeyJustReleased(key) {
+			events = keyEvents(key, false, modifiers)
+		}
+		for _, event := range events {
+			actions = append(actions, event)
+		}
+	}
+
+	in := g.input.GetInput()
+	x, y := in.CursorPosition()
+	if x != g.cursorX || y != g.cursorY {
+		g.cursorX, g.cursorY = x, y
+		actions = append(actions, input.DispatchMouseEvent(input.MouseMoved, float64(x), float64(y)).
+			WithModifiers(modifiers))
+	}
+	// 和网页的方向相反, 向上滚动时deltaY为负.
+	if xoff, yoff := in.Wheel(); xoff != 0 || yoff != 0 {
+		actions = append(actions, input.DispatchMouseEvent(input.MouseWheel, float64(x), float64(y)).
+			WithModifiers(modifiers).
+			WithDeltaX(-xoff*wheelDelta).
+			WithDeltaY(-yoff*wheelDelta))
+	}
+	return actions
+}
@@ -0,0 +1,199 @@
+package games
+
+import (
+	"bytes"
+	"common/util/process"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"image"
+	"image/jpeg"
+	"strconv"
+	"sync"
+	"xmediaEmu/pkg/log"
+)
+
+// chromedp游戏在Params.Extra里的参数.
+const (
+	ParamFps        = "fps"         // 每秒帧数, 1-60, 默认timeFPS.
+	ParamQuality    = "quality"     // jpeg质量, 1-100, 默认90.
+	ParamDropFrames = "drop_frames" // true时编码跟不上时丢掉中间的帧, 只显示最新的.
+)
+
+// 浏览器合成的帧率, 按everyNthFrame降到要求的帧率.
+const chromeFPS = 60
+
+// screencastOptions 每个room的截屏参数.
+type screencastOptions struct {
+	fps        int
+	quality    int
+	dropFrames bool
+}
+
+func parseScreencastOptions(extra map[string]string) (screencastOptions, error) {
+	opts := screencastOptions{fps: timeFPS, quality: 90}
+	if v, ok := extra[ParamFps]; ok {
+		fps, err := strconv.Atoi(v)
+		if err != nil || fps < 1 || fps > chromeFPS {
+			return opts, fmt.Errorf("chromedp: invalid %s %q, must be 1-%d", ParamFps, v, chromeFPS)
+		}
+		opts.fps = fps
+	}
+	if v, ok := extra[ParamQuality]; ok {
+		quality, err := strconv.Atoi(v)
+		if err != nil || quality < 1 || quality > 100 {
+			return opts, fmt.Errorf("chromedp: invalid %s %q, must be 1-100", ParamQuality, v)
+		}
+		opts.quality = quality
+	}
+	if v, ok := extra[ParamDropFrames]; ok {
+		drop, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("chromedp: invalid %s %q", ParamDropFrames, v)
+		}
+		opts.dropFrames = drop
+	}
+	return opts, nil
+}
+
+// screencast 用Page.startScreencast代替每帧截图, 后台goroutine解码, Draw只取最新的帧.
+// 不丢帧时每一帧被Draw取走后才ack, 浏览器按渲染的速度出帧;
+// 丢帧时收到就ack, 来不及解码的帧直接丢掉.
+type screencast struct {
+	ctx  context.Context
+	opts screencastOptions
+
+	frames   chan *page.EventScreencastFrame
+	consumed chan struct{} // Draw取走了最新的帧.
+
+	started bool
+
+	m      sync.Mutex
+	latest image.Image
+	fresh  bool // latest还没有被Draw取走.
+	err    error
+}
+
+func newScreencast(ctx context.Context, opts screencastOptions) *screencast {
+	s := &screencast{
+		ctx:      ctx,
+		opts:     opts,
+		frames:   make(chan *page.EventScreencastFrame, 2),
+		consumed: make(chan struct{}, 1),
+	}
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		frame, ok := ev.(*page.EventScreencastFrame)
+		if !ok {
+			return
+		}
+		// 不能阻塞事件goroutine, 满了丢掉.
+		select {
+		case s.frames <- frame:
+		default:
+			go s.ack(frame)
+		}
+	})
+	go s.decode()
+	return s
+}
+
+// start 按viewport大小开始截屏, 大小变化时重新调用.
+func (s *screencast) start(width, height int) error {
+	if s.started {
+		if err := chromedp.Run(s.ctx, page.StopScreencast()); err != nil {
+			return err
+		}
+	}
+	s.started = true
+	everyNth := chromeFPS / s.opts.fps
+	return chromedp.Run(s.ctx,
+		page.StartScreencast().
+			WithFormat(page.ScreencastFormatJpeg).
+			WithQuality(int64(s.opts.quality)).
+			WithMaxWidth(int64(width)).
+			WithMaxHeight(int64(height)).
+			WithEveryNthFrame(int64(everyNth)))
+}
+
+func (s *screencast) ack(frame *page.EventScreencastFrame) {
+	if err := chromedp.Run(s.ctx, page.ScreencastFrameAck(frame.SessionID)); err != nil && s.ctx.Err() == nil {
+		s.fail(fmt.Errorf("chromedp: screencast ack: %w", err))
+	}
+}
+
+// failed 解码或ack失败的错误.
+func (s *screencast) failed() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.err
+}
+
+func (s *screencast) fail(err error) {
+	s.m.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.m.Unlock()
+}
+
+// 后台解码, 浏览器关闭时退出.
+func (s *screencast) decode() {
+	defer func() {
+		if v := recover(); v != nil {
+			process.DefaultPanicReport.RecoverFromPanic("chromedp", "screencast:decode", v)
+		}
+	}()
+	for {
+		var frame *page.EventScreencastFrame
+		select {
+		case <-s.ctx.Done():
+			return
+		case frame = <-s.frames:
+		}
+		if s.opts.dropFrames {
+			s.ack(frame)
+		}
+
+		data, err := base64.StdEncoding.DecodeString(frame.Data)
+		if err != nil {
+			s.fail(fmt.Errorf("chromedp: screencast frame: %w", err))
+			return
+		}
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			s.fail(fmt.Errorf("chromedp: decode screencast frame: %w", err))
+			return
+		}
+		s.m.Lock()
+		s.latest, s.fresh = img, true
+		s.m.Unlock()
+		log.Logger.Debugf("screencast frame %d decoded, %dx%d", frame.SessionID, img.Bounds().Dx(), img.Bounds().Dy())
+
+		if s.opts.dropFrames {
+			continue
+		}
+		// 等Draw取走再要下一帧.
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.consumed:
+		}
+		s.ack(frame)
+	}
+}
+
+// frame 最新解码的帧, 还没有帧时为nil.
+func (s *screencast) frame() (image.Image, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.fresh {
+		s.fresh = false
+		select {
+		case s.consumed <- struct{}{}:
+		default:
+		}
+	}
+	return s.latest, s.err
+}
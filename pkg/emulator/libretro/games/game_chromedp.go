@@ -1,30 +1,71 @@
 package games
 
 import (
-	"bytes"
 	"context"
+	"fmt"
 	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
+	"time"
 
-	"image/jpeg"
 	// "image/png"
 	iImage "xmediaEmu/pkg/image"
+	"xmediaEmu/pkg/inpututil"
+	"xmediaEmu/pkg/log"
 )
 
 const timeFPS = 20 // 20 frames per second.
+
+// 打开网页的超时, 超时后作为游戏错误关闭room.
+const navigateTimeout = 30 * time.Second
+
 type GameChromeDp struct {
 	width  int
 	height int
 
+	// Layout传入的大小, 和width/height不同时在Update里调整viewport.
+	outsideWidth  int
+	outsideHeight int
+
 	chromeContext context.Context
 	cancel        context.CancelFunc
 
+	// 转发给网页的输入.
+	input   *inpututil.InputManager
+	cursorX int
+	cursorY int
+
+	// 浏览器推送的画面.
+	screencast *screencast
+
 	fpsCounter int
 	// isInit    bool
 }
 
-func NewGameChromeDp() *GameChromeDp {
-	game := &GameChromeDp{width: screenWidth, height: screenHeight}
+// 默认打开的网页.
+const defaultChromeUrl = `http://htmlpreview.github.io/?https://github.com/Syske/printer/blob/master/textPrinter.html`
+
+func init() {
+	Register("chromedp", func(params Params) (App, error) {
+		return NewGameChromeDp(params)
+	})
+}
+
+// NewGameChromeDp 启动浏览器按room的画面大小打开params.Url, url为空时用defaultChromeUrl.
+// 帧率, 质量和是否丢帧由params.Extra设置, 打开失败时关闭浏览器返回错误.
+func NewGameChromeDp(params Params) (*GameChromeDp, error) {
+	opts, err := parseScreencastOptions(params.Extra)
+	if err != nil {
+		return nil, err
+	}
+	url := params.Url
+	if url == "" {
+		url = defaultChromeUrl
+	}
+	width, height := params.Width, params.Height
+	if width <= 0 || height <= 0 {
+		width, height = screenWidth, screenHeight
+	}
+	game := &GameChromeDp{width: width, height: height, outsideWidth: width, outsideHeight: height}
 	game.chromeContext, game.cancel = chromedp.NewContext(
 		context.Background(),
 		// chromedp.WithDebugf(log.Printf),
@@ -32,57 +73,84 @@ func NewGameChromeDp() *GameChromeDp {
 	//if err := chromedp.Run(game.chromeContext, chromedp.Navigate(`https://lab.hakim.se/particles/02/`)); err != nil {
 	//	panic(err)
 	//}
-	// chromedp.EmulateViewport(1920, 2000),  //adjust size and scale, 使用EmulateViewportOption.
-	if err := chromedp.Run(game.chromeContext, // chromedp.Emulate(device.IPhone7landscape),
-		chromedp.Navigate(`http://htmlpreview.github.io/?https://github.com/Syske/printer/blob/master/textPrinter.html`)); err != nil {
-		panic(err)
+	// 第一次Run时启动浏览器, 不能用带超时的子context, 否则超时后浏览器也被关闭.
+	if err := chromedp.Run(game.chromeContext, chromedp.EmulateViewport(int64(width), int64(height))); err != nil {
+		game.cancel()
+		return nil, fmt.Errorf("chromedp: start browser: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(game.chromeContext, navigateTimeout)
+	defer cancel()
+	if err := chromedp.Run(ctx, chromedp.Navigate(url)); err != nil {
+		game.cancel()
+		return nil, fmt.Errorf("chromedp: navigate to %s: %w", url, err)
+	}
+	game.screencast = newScreencast(game.chromeContext, opts)
+	if err := game.screencast.start(width, height); err != nil {
+		game.cancel()
+		return nil, fmt.Errorf("chromedp: start screencast: %w", err)
 	}
+	log.Logger.Infof("chromedp game opened %s, viewport %dx%d, fps:%d, quality:%d, drop frames:%t",
+		url, width, height, opts.fps, opts.quality, opts.dropFrames)
 
-	return game
+	return game, nil
+}
+
+// SetInputMgr 每个tick把按键, 以及Input.SetCursorPosition/SetScrollOffSet设置的鼠标位置和滚动转发给网页.
+func (g *GameChromeDp) SetInputMgr(input *inpututil.InputManager) {
+	g.input = input
+}
+
+// Close 关闭浏览器.
+func (g *GameChromeDp) Close() error {
+	g.cancel()
+	return nil
 }
 
 func (g *GameChromeDp) Layout(outsideWidth, outsideHeight int) (int, int) {
 	// return screenWidth, screenHeight
+	g.outsideWidth, g.outsideHeight = outsideWidth, outsideHeight
 	return g.width, g.height
 }
 
 // 更新位置之类的.
 func (g *GameChromeDp) Update() error {
-	// TODO: 滚动网页.
+	if err := g.screencast.failed(); err != nil {
+		return err
+	}
 
+	// 画面大小变化时调整viewport, 下一帧按新的大小截图.
+	if g.outsideWidth != g.width || g.outsideHeight != g.height {
+		if err := chromedp.Run(g.chromeContext, chromedp.EmulateViewport(int64(g.outsideWidth), int64(g.outsideHeight))); err != nil {
+			return fmt.Errorf("chromedp: emulate viewport %dx%d: %w", g.outsideWidth, g.outsideHeight, err)
+		}
+		if err := g.screencast.start(g.outsideWidth, g.outsideHeight); err != nil {
+			return fmt.Errorf("chromedp: restart screencast: %w", err)
+		}
+		g.width, g.height = g.outsideWidth, g.outsideHeight
+	}
+
+	if g.input == nil {
+		return nil
+	}
+	if actions := g.inputActions(); len(actions) > 0 {
+		if err := chromedp.Run(g.chromeContext, actions...); err != nil {
+			return fmt.Errorf("chromedp: dispatch input: %w", err)
+		}
+	}
 	return nil
 }
 
 // 输出到本地检验是否成功.
+// 只画最新解码的帧, 截图在screencast的goroutine里完成.
 func (g *GameChromeDp) Draw(dc *iImage.Context) {
 	// 测试性能打开.
 	// dc.Clear()
 
-	// 离屏渲染.
-	var buf []byte
-	// navigate
-	//if g.isInit == false {
-	//	if err := chromedp.Run(g.chromeContext, chromedp.Navigate(`https://lab.hakim.se/particles/02/`)); err != nil {
-	//		panic(err)
-	//	}
-	//	g.isInit = true
-	//}
-
-	// 页面截图.
-	if err := chromedp.Run(g.chromeContext, HighQualityScreenShot(90, &buf)); err != nil {
-		panic(err)
+	// 还没有帧或者出错时保持上一帧, 错误在Update里返回.
+	img, _ := g.screencast.frame()
+	if img == nil {
+		return
 	}
-
-	// capture entire browser viewport, returning png with quality=90
-	//if err := chromedp.Run(g.chromeContext, fullScreenshot(`https://brank.as/`, 90, &buf)); err != nil {
-	//	panic(err)
-	//}
-	reader := bytes.NewReader(buf)
-	img, err := jpeg.Decode(reader)
-	if err != nil {
-		panic(err)
-	}
-
 	dc.DrawImage(img, 0, 0)
 }
 
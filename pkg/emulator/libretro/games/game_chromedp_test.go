@@ -0,0 +1,152 @@
+package games
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/input"
+	"github.com/chromedp/chromedp"
+	iImage "xmediaEmu/pkg/image"
+	"xmediaEmu/pkg/inpututil"
+)
+
+func TestKeyEvents(t *testing.T) {
+	events := keyEvents(inpututil.KeyA, true, input.ModifierShift)
+	if len(events) != 2 || events[0].Type != input.KeyDown || events[1].Type != input.KeyChar || events[1].Text != "A" || events[0].Code != "KeyA" {
+		t.Fatalf("got %+v", events)
+	}
+	events = keyEvents(inpututil.KeyA, true, input.ModifierCtrl)
+	if len(events) != 1 || events[0].Key != "a" {
+		t.Fatalf("ctrl+a got %+v", events)
+	}
+	events = keyEvents(inpututil.KeyNumpad1, false, 0)
+	if len(events) != 1 || events[0].Type != input.KeyUp || events[0].Code != "Numpad1" || events[0].Key != "1" {
+		t.Fatalf("got %+v", events)
+	}
+	if events := keyEvents(inpututil.KeyEnter, true, 0); len(events) != 2 || events[0].WindowsVirtualKeyCode != 13 {
+		t.Fatalf("got %+v", events)
+	}
+	if events := keyEvents(inpututil.KeyShiftLeft, true, 0); events != nil {
+		t.Fatalf("got %+v", events)
+	}
+}
+
+func TestParseScreencastOptions(t *testing.T) {
+	opts, err := parseScreencastOptions(nil)
+	if err != nil || opts.fps != timeFPS || opts.quality != 90 || opts.dropFrames {
+		t.Fatalf("got %+v %v", opts, err)
+	}
+	opts, err = parseScreencastOptions(map[string]string{ParamFps: "30", ParamQuality: "60", ParamDropFrames: "true"})
+	if err != nil || opts.fps != 30 || opts.quality != 60 || !opts.dropFrames {
+		t.Fatalf("got %+v %v", opts, err)
+	}
+	for _, extra := range []map[string]string{{ParamFps: "0"}, {ParamFps: "61"}, {ParamQuality: "101"}, {ParamDropFrames: "maybe"}} {
+		if _, err := parseScreencastOptions(extra); err == nil {
+			t.Fatalf("%v should be invalid", extra)
+		}
+	}
+}
+
+// 没有安装chrome时跳过.
+func skipWithoutChrome(t *testing.T) {
+	for _, name := range []string{"headless_shell", "chromium", "chromium-browser", "google-chrome", "google-chrome-stable"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return
+		}
+	}
+	t.Skip("chrome not installed")
+}
+
+const testPage = `<html><body style="height:5000px;background:#ff0000">
+<script>
+document.title = window.innerWidth + "x" + window.innerHeight;
+document.addEventListener("keydown", function(e) { document.title = "key:" + e.key; });
+</script></body></html>`
+
+func TestGameChromeDp(t *testing.T) {
+	skipWithoutChrome(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testPage)
+	}))
+	defer srv.Close()
+
+	game, err := NewGameChromeDp(Params{Url: srv.URL, Width: 320, Height: 240})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer game.Close()
+
+	title := func() string {
+		var title string
+		if err := chromedp.Run(game.chromeContext, chromedp.Title(&title)); err != nil {
+			t.Fatal(err)
+		}
+		return title
+	}
+	if got := title(); got != "320x240" {
+		t.Fatalf("viewport got %s", got)
+	}
+	if w, h := game.Layout(320, 240); w != 320 || h != 240 {
+		t.Fatalf("layout got %dx%d", w, h)
+	}
+
+	// 等screencast的第一帧.
+	dc := iImage.NewContext(320, 240)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if err := game.Update(); err != nil {
+			t.Fatal(err)
+		}
+		game.Draw(dc)
+		if r, g, b, _ := dc.Image().At(160, 120).RGBA(); r>>8 > 200 && g>>8 < 50 && b>>8 < 50 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no screencast frame")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	mgr := inpututil.NewInputMgr()
+	game.SetInputMgr(mgr)
+	mgr.SendInput(inpututil.KeyDigit5)
+	if err := mgr.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if err := game.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if got := title(); got != "key:5" {
+		t.Fatalf("key got %s", got)
+	}
+
+	mgr.GetInput().SetScrollOffSet(0, -3)
+	if err := game.Update(); err != nil {
+		t.Fatal(err)
+	}
+	var scrollY float64
+	if err := chromedp.Run(game.chromeContext, chromedp.Evaluate(`window.scrollY`, &scrollY)); err != nil {
+		t.Fatal(err)
+	}
+	if scrollY <= 0 {
+		t.Fatalf("page not scrolled")
+	}
+}
+
+func TestGameChromeDpNavigateError(t *testing.T) {
+	skipWithoutChrome(t)
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	if game, err := NewGameChromeDp(Params{Url: url}); err == nil {
+		game.Close()
+		t.Fatal("navigate to closed server should fail")
+	}
+}
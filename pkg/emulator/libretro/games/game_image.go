@@ -2,59 +2,182 @@ package games
 
 import (
 	"fmt"
-	"github.com/pterm/pterm"
+	"image"
+	"image/color"
+	"image/draw"
+	"time"
 	iImage "xmediaEmu/pkg/image"
+	"xmediaEmu/pkg/inpututil"
+	"xmediaEmu/pkg/log"
 )
 
-// 实现一个text的游戏逻辑.
-// TODO:
-// 启动过程ebiten..
+// 默认的图片目录.
+const defaultImageDir = "outdir"
+
+// 控制幻灯片的按键, dtmf的#对应Enter, *对应小键盘乘号.
+var (
+	slideNextKeys  = []inpututil.Key{inpututil.KeyArrowRight, inpututil.KeyPageDown, inpututil.KeyDigit6, inpututil.KeyEnter}
+	slidePrevKeys  = []inpututil.Key{inpututil.KeyArrowLeft, inpututil.KeyPageUp, inpututil.KeyDigit4, inpututil.KeyNumpadMultiply}
+	slidePauseKeys = []inpututil.Key{inpututil.KeySpace, inpututil.KeyP, inpututil.KeyDigit5}
+)
+
+func init() {
+	Register("image", func(params Params) (App, error) {
+		return NewGameImage(params)
+	})
+}
+
+// GameImage 幻灯片, 按清单或目录顺序播放图片, 支持转场和按键翻页暂停.
 type GameImage struct {
-	weight int
+	Dir string // 图片目录, 为空时用defaultImageDir.
+
+	opts   slideOptions
+	slides []slide
+	input  *inpututil.InputManager
+	now    func() time.Time
+
+	width  int
 	height int
-	// text   string
+	resize bool // 画面大小变化, 重新缩放当前图片.
+
+	Index    int         // 当前显示的图片.
+	current  *image.RGBA // 缩放到画面大小的当前图片.
+	previous *image.RGBA // 转场时的上一张.
+	elapsed  time.Duration
+	last     time.Time
+	paused   bool
+	ended    bool // 不循环时播完停在最后一张.
+}
 
-	//
-	Index     int
-	loopCount int
-	//counter        int
-	//kanjiText      []rune
-	//kanjiTextColor color.RGBA
-	//glyphs         []text.Glyph
+// NewGameImage 按params.Dir和params.Extra创建幻灯片, 没有可播放的图片时返回错误.
+func NewGameImage(params Params) (*GameImage, error) {
+	opts, err := parseSlideOptions(params.Extra)
+	if err != nil {
+		return nil, err
+	}
+	dir := params.Dir
+	if dir == "" {
+		dir = defaultImageDir
+	}
+	slides, err := loadSlides(dir, params.Extra[ParamManifest], opts.duration)
+	if err != nil {
+		return nil, err
+	}
+	width, height := params.Width, params.Height
+	if width <= 0 || height <= 0 {
+		width, height = screenWidth, screenHeight
+	}
+	return &GameImage{Dir: dir, opts: opts, slides: slides, now: time.Now, width: width, height: height}, nil
+}
+
+// SetInputMgr 按键翻页和暂停.
+func (g *GameImage) SetInputMgr(input *inpututil.InputManager) {
+	g.input = input
 }
 
 func (g *GameImage) Layout(outsideWidth, outsideHeight int) (int, int) {
-	return screenWidth, screenHeight
+	if outsideWidth != g.width || outsideHeight != g.height {
+		g.width, g.height = outsideWidth, outsideHeight
+		g.resize = true
+	}
+	return g.width, g.height
 }
 
 // 更新位置之类的.
+// 处理按键, 按时间切换图片, 所有图片都加载失败时返回错误.
 func (g *GameImage) Update() error {
-	//if g.text == "" {
-	//	g.text = "Hello, world,你好世界!"
-	//}
-	g.Index++
-	if g.Index >= 25 {
-		g.Index = 1
-		g.loopCount++
+	now := g.now()
+	if g.last.IsZero() {
+		g.last = now
 	}
+	dt := now.Sub(g.last)
+	g.last = now
 
-	return nil
+	if g.current == nil || g.resize {
+		g.resize = false
+		if err := g.show(g.Index, 1, false); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case g.justPressed(slideNextKeys):
+		g.ended = false
+		return g.show(g.Index+1, 1, true)
+	case g.justPressed(slidePrevKeys):
+		g.ended = false
+		return g.show(g.Index-1, -1, true)
+	case g.justPressed(slidePauseKeys):
+		g.paused = !g.paused
+		log.Logger.Infof("slideshow paused:%t at %s", g.paused, g.slides[g.Index].file)
+	}
+
+	if g.paused || g.ended {
+		return nil
+	}
+	g.elapsed += dt
+	if g.elapsed < g.slides[g.Index].duration {
+		return nil
+	}
+	if !g.opts.loop && g.Index == len(g.slides)-1 {
+		g.ended = true
+		return nil
+	}
+	return g.show(g.Index+1, 1, true)
+}
+
+func (g *GameImage) justPressed(keys []inpututil.Key) bool {
+	if g.input == nil {
+		return false
+	}
+	for _, key := range keys {
+		if g.input.IsKeyJustPressed(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// show 从index开始按step方向找第一张能加载的图片显示, 加载失败的记录日志后跳过.
+func (g *GameImage) show(index, step int, transition bool) error {
+	n := len(g.slides)
+	for i := 0; i < n; i++ {
+		index = ((index % n) + n) % n
+		s := g.slides[index]
+		im, err := iImage.LoadImage(s.file)
+		if err != nil {
+			log.Logger.Errorf("slideshow: load %s failed, skipped: %v", s.file, err)
+			index += step
+			continue
+		}
+
+		g.previous = nil
+		if transition && g.opts.transition > 0 {
+			g.previous = g.current
+		}
+		g.current = scaleImage(im, g.width, g.height, g.opts.scale)
+		g.Index = index
+		g.elapsed = 0
+		return nil
+	}
+	return fmt.Errorf("slideshow: none of %d images in %s can be loaded", n, g.Dir)
 }
 
 // 输出到本地检验是否成功.
+// 转场时上一张上面按进度叠加当前图片.
 func (g *GameImage) Draw(dc *iImage.Context) {
-	//if g.loopCount >= 3 {
-	//	return
-	//}
-	// dc.Clear()
-	filename := "outdir/" + fmt.Sprintf("%05d.jpg", g.Index)
-	im, err := iImage.LoadJPG(filename)
-	if err != nil {
-		pterm.FgLightRed.Printf("load file failed:%s\n. err:%v", filename, err)
+	if g.current == nil {
+		return
+	}
+	dst := dc.ImageRgba()
+	r := dst.Bounds().Intersect(g.current.Bounds())
 
-		// TODO:正式代码中逻辑不能出现panic.
-		panic(err)
+	if g.previous == nil || g.elapsed >= g.opts.transition || !g.previous.Bounds().Eq(g.current.Bounds()) {
+		g.previous = nil
+		draw.Draw(dst, r, g.current, r.Min, draw.Src)
+		return
 	}
-	dc.DrawImage(im, 0, 0)
-	pterm.FgWhite.Printf("put image index:%s done. \n", filename)
+	alpha := uint8(255 * g.elapsed / g.opts.transition)
+	draw.Draw(dst, r, g.previous, r.Min, draw.Src)
+	draw.DrawMask(dst, r, g.current, r.Min, image.NewUniform(color.Alpha{A: alpha}), image.Point{}, draw.Over)
 }
@@ -0,0 +1,138 @@
+package games
+
+import (
+	"image"
+	"image/color"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	iImage "xmediaEmu/pkg/image"
+	"xmediaEmu/pkg/inpututil"
+)
+
+func writeSlide(t *testing.T, dir, name string, w, h int, c color.Color) {
+	im := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(im.Pix); i += 4 {
+		r, g, b, _ := c.RGBA()
+		im.Pix[i], im.Pix[i+1], im.Pix[i+2], im.Pix[i+3] = uint8(r>>8), uint8(g>>8), uint8(b>>8), 255
+	}
+	if err := iImage.SavePNG(filepath.Join(dir, name), im); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScaleImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for i := range src.Pix {
+		src.Pix[i] = 255
+	}
+	// 2:1的图片放到4:3的画面, 上下黑边.
+	dst := scaleImage(src, 80, 60, ScaleLetterbox)
+	if r, _, _, _ := dst.At(40, 5).RGBA(); r != 0 {
+		t.Fatal("letterbox should have black bars")
+	}
+	if r, _, _, _ := dst.At(40, 30).RGBA(); r>>8 != 255 {
+		t.Fatal("letterbox center should be image")
+	}
+	for _, scale := range []string{ScaleFit, ScaleFill} {
+		dst := scaleImage(src, 80, 60, scale)
+		if r, _, _, _ := dst.At(40, 1).RGBA(); r>>8 != 255 {
+			t.Fatalf("%s should cover the viewport", scale)
+		}
+	}
+}
+
+func TestGameImage(t *testing.T) {
+	dir := t.TempDir()
+	writeSlide(t, dir, "a.png", 8, 8, color.RGBA{R: 255, A: 255})
+	writeSlide(t, dir, "c.png", 8, 8, color.RGBA{B: 255, A: 255})
+	manifest := `{"slides":[{"file":"a.png","duration":1000},{"file":"missing.png"},{"file":"c.png","duration":2000}]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "show.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	game, err := NewGameImage(Params{Dir: dir, Width: 16, Height: 16,
+		Extra: map[string]string{ParamManifest: "show.json", ParamDuration: "5s", ParamTransition: "100ms"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 0)
+	game.now = func() time.Time { return now }
+	mgr := inpututil.NewInputMgr()
+	game.SetInputMgr(mgr)
+	dc := iImage.NewContext(16, 16)
+	tick := func(d time.Duration) {
+		now = now.Add(d)
+		if err := mgr.Update(); err != nil {
+			t.Fatal(err)
+		}
+		game.Layout(16, 16)
+		if err := game.Update(); err != nil {
+			t.Fatal(err)
+		}
+		game.Draw(dc)
+	}
+	pixel := func() color.RGBA { return dc.ImageRgba().RGBAAt(8, 8) }
+
+	tick(0)
+	if game.Index != 0 || pixel().R != 255 {
+		t.Fatalf("first slide got %d %v", game.Index, pixel())
+	}
+	// 1s后跳过不存在的文件.
+	tick(time.Second)
+	if game.Index != 2 {
+		t.Fatalf("missing file not skipped, index %d", game.Index)
+	}
+	// 转场中两张混合.
+	tick(50 * time.Millisecond)
+	if p := pixel(); p.R == 0 || p.B == 0 {
+		t.Fatalf("cross fade got %v", p)
+	}
+	tick(100 * time.Millisecond)
+	if p := pixel(); p.R != 0 || p.B != 255 {
+		t.Fatalf("after fade got %v", p)
+	}
+
+	// 暂停后不切换.
+	mgr.SendInput(inpututil.KeyDigit5)
+	tick(0)
+	tick(10 * time.Second)
+	if game.Index != 2 || !game.paused {
+		t.Fatalf("paused slideshow moved to %d", game.Index)
+	}
+	// 上一张, 跳过不存在的文件.
+	mgr.SendInput(inpututil.KeyDigit4)
+	tick(0)
+	if game.Index != 0 {
+		t.Fatalf("previous got %d", game.Index)
+	}
+	mgr.SendInput(inpututil.KeyEnter)
+	tick(0)
+	if game.Index != 2 {
+		t.Fatalf("next got %d", game.Index)
+	}
+}
+
+func TestGameImageErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewGameImage(Params{Dir: dir}); err == nil {
+		t.Fatal("empty dir should fail")
+	}
+	if _, err := NewGameImage(Params{Dir: dir, Extra: map[string]string{ParamScale: "zoom"}}); err == nil {
+		t.Fatal("invalid scale should fail")
+	}
+
+	// 所有图片都加载失败时Update返回错误.
+	if err := ioutil.WriteFile(filepath.Join(dir, "broken.jpg"), []byte("nope"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	game, err := NewGameImage(Params{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := game.Update(); err == nil {
+		t.Fatal("no loadable image should fail")
+	}
+}
@@ -1,53 +1,303 @@
 package games
 
 import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strconv"
+	"strings"
 	iImage "xmediaEmu/pkg/image"
+	"xmediaEmu/pkg/inpututil"
+	"xmediaEmu/pkg/log"
+
+	"golang.org/x/image/font"
 )
 
 const (
 	screenWidth  = 640
 	screenHeight = 480
+
+	defaultText = "Hello, world,你好世界!"
+)
+
+// text游戏在Params.Extra里的参数.
+const (
+	ParamMenu        = "menu"         // 菜单文件, .json或.yaml, 相对路径按Dir.
+	ParamFont        = "font"         // 字体文件.
+	ParamFontSize    = "font_size"    // 字号.
+	ParamMargin      = "margin"       // 四周留白的像素.
+	ParamLineSpacing = "line_spacing" // 行距倍数.
+	ParamAlign       = "align"        // left/center/right.
+	ParamColor       = "color"        // 文字颜色, 如#000000.
+	ParamBackground  = "background"   // 背景颜色.
+	ParamHighlight   = "highlight"    // 选中项的背景颜色.
+)
+
+const (
+	defaultFont      = "resources/msyh.ttc"
+	defaultFontSize  = 32
+	defaultMargin    = 24
+	defaultLineSpace = 1.5
+)
+
+// 菜单按键, 数字键直接选中对应的选项, dtmf的#对应Enter, *对应小键盘乘号.
+var (
+	menuUpKeys     = []inpututil.Key{inpututil.KeyArrowUp}
+	menuDownKeys   = []inpututil.Key{inpututil.KeyArrowDown}
+	menuSelectKeys = []inpututil.Key{inpututil.KeyEnter, inpututil.KeyNumpadEnter, inpututil.KeySpace}
+	menuBackKeys   = []inpututil.Key{inpututil.KeyEscape, inpututil.KeyBackspace, inpututil.KeyNumpadMultiply, inpututil.KeyDigit0}
 )
 
+func init() {
+	Register("text", func(params Params) (App, error) {
+		return NewGame(params)
+	})
+}
+
+// textStyle 每个room的字体和排版.
+type textStyle struct {
+	face        font.Face // 每个room加载一次.
+	margin      float64
+	lineSpacing float64
+	align       iImage.Align
+	color       string
+	background  string
+	highlight   string
+}
+
+func parseTextStyle(extra map[string]string) (textStyle, error) {
+	style := textStyle{margin: defaultMargin, lineSpacing: defaultLineSpace, align: iImage.AlignLeft,
+		color: "#000000", background: "#FFFFFF", highlight: "#FFD54F"}
+	size := float64(defaultFontSize)
+	for _, p := range []struct {
+		name string
+		dst  *float64
+		min  float64
+	}{{ParamFontSize, &size, 1}, {ParamMargin, &style.margin, 0}, {ParamLineSpacing, &style.lineSpacing, 1}} {
+		v, ok := extra[p.name]
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < p.min {
+			return style, fmt.Errorf("text: invalid %s %q", p.name, v)
+		}
+		*p.dst = f
+	}
+	switch v := extra[ParamAlign]; v {
+	case "", "left":
+	case "center":
+		style.align = iImage.AlignCenter
+	case "right":
+		style.align = iImage.AlignRight
+	default:
+		return style, fmt.Errorf("text: invalid %s %q, must be left, center or right", ParamAlign, v)
+	}
+	for name, dst := range map[string]*string{ParamColor: &style.color, ParamBackground: &style.background, ParamHighlight: &style.highlight} {
+		if v, ok := extra[name]; ok {
+			if !strings.HasPrefix(v, "#") || (len(v) != 4 && len(v) != 7 && len(v) != 9) {
+				return style, fmt.Errorf("text: invalid %s %q", name, v)
+			}
+			*dst = v
+		}
+	}
+
+	file := extra[ParamFont]
+	if file == "" {
+		file = defaultFont
+	}
+	face, err := iImage.LoadFontFace(file, size)
+	if err != nil {
+		return style, fmt.Errorf("text: load font %s: %w", file, err)
+	}
+	style.face = face
+	return style, nil
+}
+
 // 实现一个text的游戏逻辑.
-// TODO:
-// 启动过程ebiten..
+// Game 文字菜单, 显示当前菜单的标题和选项, 按键选择, 选中没有下一级的选项时上报.
 type Game struct {
-	weight int
+	style  textStyle
+	report Reporter
+	input  *inpututil.InputManager
+
+	root     *MenuItem
+	path     []*MenuItem // 从根到当前菜单.
+	selected int         // 当前菜单中高亮的选项.
+
+	width  int
 	height int
-	text   string
-	index  int
+	canvas *iImage.Context // 画好的菜单, 屏幕每帧会清空, 每帧拷贝.
+	dirty  bool            // 菜单变化, 需要重画canvas.
+}
+
+// NewGame 按params加载菜单和字体, 失败时返回错误.
+func NewGame(params Params) (*Game, error) {
+	root, err := loadMenu(params.Dir, params.Extra[ParamMenu], params.Text)
+	if err != nil {
+		return nil, err
+	}
+	style, err := parseTextStyle(params.Extra)
+	if err != nil {
+		return nil, err
+	}
+	width, height := params.Width, params.Height
+	if width <= 0 || height <= 0 {
+		width, height = screenWidth, screenHeight
+	}
+	return &Game{style: style, report: params.Report, root: root, path: []*MenuItem{root}, width: width, height: height, dirty: true}, nil
+}
 
-	// bFontLoaded bool
+// SetInputMgr 按键选择菜单.
+func (g *Game) SetInputMgr(input *inpututil.InputManager) {
+	g.input = input
 }
 
 func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
-	return screenWidth, screenHeight
+	if outsideWidth != g.width || outsideHeight != g.height {
+		g.width, g.height = outsideWidth, outsideHeight
+		g.dirty = true
+	}
+	return g.width, g.height
+}
+
+func (g *Game) current() *MenuItem {
+	return g.path[len(g.path)-1]
+}
+
+func (g *Game) justPressed(keys []inpututil.Key) bool {
+	for _, key := range keys {
+		if g.input.IsKeyJustPressed(key) {
+			return true
+		}
+	}
+	return false
 }
 
 // 更新位置之类的.
+// 处理按键, 每个tick最多一个操作.
 func (g *Game) Update() error {
-	if g.text == "" {
-		g.text = "Hello, world,你好世界!"
+	if g.input == nil {
+		return nil
+	}
+	menu := g.current()
+	for i := range menu.Options {
+		if g.input.IsKeyJustPressed(inpututil.KeyDigit1+inpututil.Key(i)) || g.input.IsKeyJustPressed(inpututil.KeyNumpad1+inpututil.Key(i)) {
+			g.choose(i)
+			return nil
+		}
 	}
-	g.index++
 
+	switch {
+	case g.justPressed(menuUpKeys):
+		if len(menu.Options) > 0 {
+			g.selected = (g.selected + len(menu.Options) - 1) % len(menu.Options)
+			g.dirty = true
+		}
+	case g.justPressed(menuDownKeys):
+		if len(menu.Options) > 0 {
+			g.selected = (g.selected + 1) % len(menu.Options)
+			g.dirty = true
+		}
+	case g.justPressed(menuSelectKeys):
+		if len(menu.Options) > 0 {
+			g.choose(g.selected)
+		}
+	case g.justPressed(menuBackKeys):
+		g.back()
+	}
 	return nil
 }
 
+// choose 进入选项, 没有下一级时上报选中的路径.
+func (g *Game) choose(index int) {
+	option := g.current().Options[index]
+	g.path = append(g.path, option)
+	g.selected = 0
+	g.dirty = true
+
+	if len(option.Options) > 0 {
+		return
+	}
+	selection := MenuSelection{}
+	for _, item := range g.path[1:] {
+		selection.Path = append(selection.Path, item.Id)
+		selection.Labels = append(selection.Labels, item.label())
+	}
+	log.Logger.Infof("menu selected: %v %v", selection.Path, selection.Labels)
+	if g.report != nil {
+		g.report(EventMenuSelected, selection)
+	}
+}
+
+// back 返回上一级, 高亮进入时的选项.
+func (g *Game) back() {
+	if len(g.path) <= 1 {
+		return
+	}
+	leaving := g.current()
+	g.path = g.path[:len(g.path)-1]
+	g.selected = 0
+	for i, option := range g.current().Options {
+		if option == leaving {
+			g.selected = i
+		}
+	}
+	g.dirty = true
+}
+
 // 输出到本地检验是否成功.
+// 菜单变化时重画canvas, 每帧拷贝到屏幕.
 func (g *Game) Draw(dc *iImage.Context) {
-	// 文字需要clear..
-	dc.Clear()
-	dc.SetRGB(1, 1, 1)
+	if g.canvas == nil || g.canvas.Width() != dc.Width() || g.canvas.Height() != dc.Height() {
+		g.canvas = iImage.NewContext(dc.Width(), dc.Height())
+		g.dirty = true
+	}
+	if g.dirty {
+		g.dirty = false
+		g.render(g.canvas)
+	}
+	dst := dc.ImageRgba()
+	draw.Draw(dst, dst.Bounds(), g.canvas.ImageRgba(), image.Point{}, draw.Src)
+}
+
+// render 标题在上, 选项按序号排列, 高亮当前选项.
+func (g *Game) render(dc *iImage.Context) {
+	style := g.style
+	dc.SetFontFace(style.face)
+	dc.SetHexColor(style.background)
 	dc.Clear()
-	dc.SetRGB(0, 0, 0)
-	if err := dc.LoadFontFace("resources/msyh.ttc", 48); err != nil {
-		panic(err)
+
+	width := float64(dc.Width()) - 2*style.margin
+	y := style.margin
+	// 和DrawStringWrapped的高度计算一致.
+	height := func(s string) float64 {
+		lines := float64(len(dc.WordWrap(s, width)))
+		return lines*dc.FontHeight()*style.lineSpacing - (style.lineSpacing-1)*dc.FontHeight()
+	}
+
+	menu := g.current()
+	// 选中的叶子节点没有标题时显示选项文字.
+	if title := menu.Title; title != "" || menu.Label != "" {
+		if title == "" {
+			title = menu.Label
+		}
+		dc.SetHexColor(style.color)
+		dc.DrawStringWrapped(title, style.margin, y, 0, 0, width, style.lineSpacing, style.align)
+		y += height(title) + dc.FontHeight()*style.lineSpacing
 	}
-	dc.DrawStringAnchored("Hello, world,你好世界!", float64(dc.Width()/2), float64(dc.Height()/2), 0.5, 0.5)
 
-	if g.index < 10 {
-		dc.SavePNG("out.png")
+	gap := dc.FontHeight() * (style.lineSpacing - 1)
+	for i, option := range menu.Options {
+		text := fmt.Sprintf("%d. %s", i+1, option.label())
+		h := height(text)
+		if i == g.selected {
+			dc.SetHexColor(style.highlight)
+			dc.DrawRectangle(style.margin/2, y-gap/2, width+style.margin, h+gap)
+			dc.Fill()
+		}
+		dc.SetHexColor(style.color)
+		dc.DrawStringWrapped(text, style.margin, y, 0, 0, width, style.lineSpacing, style.align)
+		y += h + gap
 	}
 }
@@ -0,0 +1,128 @@
+package games
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+	iImage "xmediaEmu/pkg/image"
+	"xmediaEmu/pkg/inpututil"
+)
+
+const testMenu = `
+title: 欢迎致电, 请选择业务
+options:
+  - label: 查询余额
+    id: balance
+  - label: 办理业务
+    title: 请选择要办理的业务
+    options:
+      - label: 充值
+        id: recharge
+      - label: 挂失
+        id: lost
+`
+
+func testFont(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "goregular.ttf")
+	if err := ioutil.WriteFile(file, goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadMenu(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "menu.yaml"), []byte(testMenu), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root, err := loadMenu(dir, "menu.yaml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Options) != 2 || root.Options[1].Id != "2" || root.Options[1].Options[0].Id != "recharge" {
+		t.Fatalf("got %+v", root)
+	}
+
+	root, err = loadMenu("", "", `{"title":"hi","options":[{"label":"a"},{"title":"b"}]}`)
+	if err != nil || len(root.Options) != 2 || root.Options[1].label() != "b" {
+		t.Fatalf("got %+v %v", root, err)
+	}
+	if root, err := loadMenu("", "", "plain text"); err != nil || root.Title != "plain text" || len(root.Options) != 0 {
+		t.Fatalf("got %+v %v", root, err)
+	}
+	if _, err := loadMenu("", "", `{"options":[{"id":"x"}]}`); err == nil {
+		t.Fatal("option without label should fail")
+	}
+}
+
+func TestGameMenu(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "menu.yaml"), []byte(testMenu), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var events []MenuSelection
+	game, err := NewGame(Params{Dir: dir, Width: 320, Height: 240,
+		Extra:  map[string]string{ParamMenu: "menu.yaml", ParamFont: testFont(t), ParamFontSize: "16", ParamBackground: "#FFFFFF"},
+		Report: func(event string, data interface{}) { events = append(events, data.(MenuSelection)) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := inpututil.NewInputMgr()
+	game.SetInputMgr(mgr)
+	dc := iImage.NewContext(320, 240)
+	press := func(key inpututil.Key) {
+		mgr.SendInput(key)
+		for i := 0; i < 2; i++ {
+			if err := mgr.Update(); err != nil {
+				t.Fatal(err)
+			}
+			if err := game.Update(); err != nil {
+				t.Fatal(err)
+			}
+			dc.Clear()
+			game.Draw(dc)
+		}
+	}
+
+	game.Draw(dc)
+	if c := dc.ImageRgba().RGBAAt(1, 1); c.R != 255 || c.G != 255 || c.B != 255 {
+		t.Fatalf("background got %v", c)
+	}
+	// 方向键移到第二项, 回车进入下一级, 数字键选中叶子.
+	press(inpututil.KeyArrowDown)
+	if game.selected != 1 {
+		t.Fatalf("selected %d", game.selected)
+	}
+	press(inpututil.KeyEnter)
+	if game.current().Title != "请选择要办理的业务" || len(events) != 0 {
+		t.Fatalf("got %+v %v", game.current(), events)
+	}
+	press(inpututil.KeyDigit2)
+	want := MenuSelection{Path: []string{"2", "lost"}, Labels: []string{"办理业务", "挂失"}}
+	if len(events) != 1 || !reflect.DeepEqual(events[0], want) {
+		t.Fatalf("got %+v", events)
+	}
+
+	// *返回上一级, 高亮进入时的选项.
+	press(inpututil.KeyNumpadMultiply)
+	press(inpututil.KeyNumpadMultiply)
+	if len(game.path) != 1 || game.selected != 1 {
+		t.Fatalf("back got path %d selected %d", len(game.path), game.selected)
+	}
+	press(inpututil.KeyDigit1)
+	if len(events) != 2 || events[1].Path[0] != "balance" {
+		t.Fatalf("got %+v", events)
+	}
+}
+
+func TestGameErrors(t *testing.T) {
+	if _, err := NewGame(Params{Extra: map[string]string{ParamFont: filepath.Join(t.TempDir(), "missing.ttf")}}); err == nil {
+		t.Fatal("missing font should fail")
+	}
+	if _, err := NewGame(Params{Extra: map[string]string{ParamFont: testFont(t), ParamAlign: "top"}}); err == nil {
+		t.Fatal("invalid align should fail")
+	}
+}
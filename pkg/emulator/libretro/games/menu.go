@@ -0,0 +1,95 @@
+package games
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EventMenuSelected 选中没有下一级的选项时上报, 数据为MenuSelection.
+const EventMenuSelected = "menu_selected"
+
+// MenuItem 菜单树的一个节点, 有Options时选中后进入下一级.
+type MenuItem struct {
+	Id      string      `json:"id,omitempty" yaml:"id,omitempty"`       // 上报的选项id, 为空时用在上一级中的序号.
+	Label   string      `json:"label,omitempty" yaml:"label,omitempty"` // 在上一级中显示的文字, 为空时用Title.
+	Title   string      `json:"title" yaml:"title"`                     // 进入后显示的标题或提示.
+	Options []*MenuItem `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// MenuSelection EventMenuSelected的数据, 从第一级到选中的选项.
+type MenuSelection struct {
+	Path   []string `json:"path"`
+	Labels []string `json:"labels"`
+}
+
+func (item *MenuItem) label() string {
+	if item.Label != "" {
+		return item.Label
+	}
+	return item.Title
+}
+
+// normalize 检查菜单树并填上默认的id, 最多9个选项, 和数字键一一对应.
+func (item *MenuItem) normalize() error {
+	if len(item.Options) > 9 {
+		return fmt.Errorf("menu: %q has %d options, at most 9", item.Title, len(item.Options))
+	}
+	for i, option := range item.Options {
+		if option == nil || option.label() == "" {
+			return fmt.Errorf("menu: option %d of %q has no label or title", i+1, item.Title)
+		}
+		if option.Id == "" {
+			option.Id = strconv.Itoa(i + 1)
+		}
+		if err := option.normalize(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseMenu 解析json或yaml格式的菜单树.
+func parseMenu(data []byte, isJSON bool) (*MenuItem, error) {
+	root := &MenuItem{}
+	var err error
+	if isJSON {
+		err = json.Unmarshal(data, root)
+	} else {
+		err = yaml.Unmarshal(data, root)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("menu: %w", err)
+	}
+	if err := root.normalize(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// loadMenu 菜单文件按扩展名解析, 相对路径按dir.
+// 没有菜单文件时text为json则作为菜单, 否则只显示text.
+func loadMenu(dir, file, text string) (*MenuItem, error) {
+	if file != "" {
+		if !filepath.IsAbs(file) && dir != "" {
+			file = filepath.Join(dir, file)
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("menu: %w", err)
+		}
+		return parseMenu(data, strings.ToLower(filepath.Ext(file)) == ".json")
+	}
+	if strings.HasPrefix(strings.TrimSpace(text), "{") {
+		return parseMenu([]byte(text), true)
+	}
+	if text == "" {
+		text = defaultText
+	}
+	return &MenuItem{Title: text}, nil
+}
@@ -0,0 +1,85 @@
+package games
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	iImage "xmediaEmu/pkg/image"
+)
+
+// App 注册的游戏逻辑, 和libretro.GameUser一致.
+type App interface {
+	Update() error
+	Draw(dc *iImage.Context)
+	Layout(outsideWidth, outsideHeight int) (int, int)
+}
+
+// Params 每个room的启动参数, 来自RoomStartCall, 各个游戏按需使用.
+type Params struct {
+	Url   string            // 网页地址.
+	Dir   string            // 素材目录.
+	Text  string            // 显示的文字.
+	Extra map[string]string // 游戏自定义的参数.
+
+	Width  int // room的画面大小, 和Config.Width/Height一致.
+	Height int
+
+	Report Reporter // 上报游戏事件, 可能为nil.
+}
+
+// Reporter 游戏上报事件, 由worker转发给coordinator, data需要能编码成json.
+type Reporter func(event string, data interface{})
+
+// Factory 按参数创建游戏, 参数不对时返回错误.
+type Factory func(params Params) (App, error)
+
+var (
+	factoriesLock sync.RWMutex
+	factories     = map[string]Factory{}
+)
+
+// Register 注册游戏, 一般在游戏所在包的init里调用, 重名时panic.
+func Register(name string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	if factory == nil {
+		panic("games: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("games: Register called twice for " + name)
+	}
+	factories[name] = factory
+}
+
+// Registered 是否注册了该游戏.
+func Registered(name string) bool {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+	_, ok := factories[name]
+	return ok
+}
+
+// Names 注册的所有游戏, 按名字排序.
+func Names() []string {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New 创建注册的游戏, 没有注册时返回错误.
+func New(name string, params Params) (App, error) {
+	factoriesLock.RLock()
+	factory, ok := factories[name]
+	factoriesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("games: unknown game %q", name)
+	}
+	return factory(params)
+}
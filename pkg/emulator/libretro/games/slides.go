@@ -0,0 +1,202 @@
+package games
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// image游戏在Params.Extra里的参数.
+const (
+	ParamManifest   = "manifest"   // 幻灯片清单, 相对路径按Dir, 为空时用Dir下的manifest.json, 没有时按文件名顺序播放Dir下的图片.
+	ParamDuration   = "duration"   // 每张默认显示时长, 如3s.
+	ParamTransition = "transition" // 淡入淡出时长, 0不转场.
+	ParamScale      = "scale"      // 缩放方式, fit/fill/letterbox.
+	ParamLoop       = "loop"       // 播完后是否从头开始, 默认true.
+)
+
+// 缩放到画面大小的方式.
+const (
+	ScaleFit       = "fit"       // 拉伸到画面大小, 不保持比例.
+	ScaleFill      = "fill"      // 保持比例铺满画面, 裁掉多出的部分.
+	ScaleLetterbox = "letterbox" // 保持比例完整显示, 空白处填黑边.
+)
+
+const (
+	defaultManifest   = "manifest.json"
+	defaultDuration   = 3 * time.Second
+	defaultTransition = 500 * time.Millisecond
+)
+
+// Slide 清单里的一张图片, Duration单位为毫秒, 0时用默认时长.
+type Slide struct {
+	File     string `json:"file"`
+	Duration int    `json:"duration"`
+}
+
+// SlideManifest 幻灯片清单文件的格式.
+type SlideManifest struct {
+	Slides []Slide `json:"slides"`
+}
+
+type slide struct {
+	file     string
+	duration time.Duration
+}
+
+// slideOptions 每个room的幻灯片参数.
+type slideOptions struct {
+	duration   time.Duration
+	transition time.Duration
+	scale      string
+	loop       bool
+}
+
+func parseSlideOptions(extra map[string]string) (slideOptions, error) {
+	opts := slideOptions{duration: defaultDuration, transition: defaultTransition, scale: ScaleLetterbox, loop: true}
+	if v, ok := extra[ParamDuration]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return opts, fmt.Errorf("slideshow: invalid %s %q", ParamDuration, v)
+		}
+		opts.duration = d
+	}
+	if v, ok := extra[ParamTransition]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return opts, fmt.Errorf("slideshow: invalid %s %q", ParamTransition, v)
+		}
+		opts.transition = d
+	}
+	if v, ok := extra[ParamScale]; ok {
+		switch v {
+		case ScaleFit, ScaleFill, ScaleLetterbox:
+			opts.scale = v
+		default:
+			return opts, fmt.Errorf("slideshow: invalid %s %q, must be fit, fill or letterbox", ParamScale, v)
+		}
+	}
+	if v, ok := extra[ParamLoop]; ok {
+		loop, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("slideshow: invalid %s %q", ParamLoop, v)
+		}
+		opts.loop = loop
+	}
+	return opts, nil
+}
+
+// loadSlides 按清单或目录里的图片文件生成幻灯片列表, 文件是否存在在显示时检查.
+func loadSlides(dir, manifest string, duration time.Duration) ([]slide, error) {
+	if manifest == "" {
+		if _, err := os.Stat(filepath.Join(dir, defaultManifest)); err == nil {
+			manifest = defaultManifest
+		}
+	}
+	if manifest != "" {
+		return loadManifest(dir, manifest, duration)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("slideshow: %w", err)
+	}
+	slides := []slide{}
+	for _, info := range infos {
+		switch strings.ToLower(filepath.Ext(info.Name())) {
+		case ".jpg", ".jpeg", ".png":
+		default:
+			continue
+		}
+		if !info.IsDir() {
+			slides = append(slides, slide{file: filepath.Join(dir, info.Name()), duration: duration})
+		}
+	}
+	if len(slides) == 0 {
+		return nil, fmt.Errorf("slideshow: no jpeg or png image in %s", dir)
+	}
+	sort.Slice(slides, func(i, j int) bool { return slides[i].file < slides[j].file })
+	return slides, nil
+}
+
+func loadManifest(dir, manifest string, duration time.Duration) ([]slide, error) {
+	if !filepath.IsAbs(manifest) {
+		manifest = filepath.Join(dir, manifest)
+	}
+	data, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("slideshow: %w", err)
+	}
+	m := SlideManifest{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("slideshow: invalid manifest %s: %w", manifest, err)
+	}
+	if len(m.Slides) == 0 {
+		return nil, fmt.Errorf("slideshow: no slide in manifest %s", manifest)
+	}
+
+	// 清单里的相对路径按清单所在目录.
+	base := filepath.Dir(manifest)
+	slides := make([]slide, 0, len(m.Slides))
+	for _, s := range m.Slides {
+		if s.File == "" || s.Duration < 0 {
+			return nil, fmt.Errorf("slideshow: invalid slide %+v in manifest %s", s, manifest)
+		}
+		file := s.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(base, file)
+		}
+		d := duration
+		if s.Duration > 0 {
+			d = time.Duration(s.Duration) * time.Millisecond
+		}
+		slides = append(slides, slide{file: file, duration: d})
+	}
+	return slides, nil
+}
+
+// scaleImage 按缩放方式把图片缩放到width*height, 空白处为黑色.
+func scaleImage(src image.Image, width, height int, scale string) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.Draw(dst, dst.Bounds(), image.NewUniform(color.Black), image.Point{}, xdraw.Src)
+
+	sr := src.Bounds()
+	sw, sh := float64(sr.Dx()), float64(sr.Dy())
+	if sw == 0 || sh == 0 {
+		return dst
+	}
+	dr := dst.Bounds()
+	switch scale {
+	case ScaleFill:
+		// 按画面比例裁剪原图的中间部分.
+		if sw*float64(height) > sh*float64(width) {
+			cw := int(sh * float64(width) / float64(height))
+			x := sr.Min.X + (sr.Dx()-cw)/2
+			sr = image.Rect(x, sr.Min.Y, x+cw, sr.Max.Y)
+		} else {
+			ch := int(sw * float64(height) / float64(width))
+			y := sr.Min.Y + (sr.Dy()-ch)/2
+			sr = image.Rect(sr.Min.X, y, sr.Max.X, y+ch)
+		}
+	case ScaleLetterbox:
+		s := float64(width) / sw
+		if hs := float64(height) / sh; hs < s {
+			s = hs
+		}
+		w, h := int(sw*s+0.5), int(sh*s+0.5)
+		x, y := (width-w)/2, (height-h)/2
+		dr = image.Rect(x, y, x+w, y+h)
+	}
+	xdraw.BiLinear.Scale(dst, dr, src, sr, xdraw.Over, nil)
+	return dst
+}
@@ -2,7 +2,7 @@ package libretro
 
 import (
 	"errors"
-	"xmediaEmu/pkg/mainthread"
+	"runtime"
 )
 
 // RegularTermination represents a regular termination.
@@ -11,11 +11,12 @@ import (
 var RegularTermination = errors.New("regular termination")
 
 func (u *UserInterface) Run(game Game) error {
-	u.context = newContextImpl(game)
+	u.context = newContextImpl(game, u.input)
 
-	// Initialize the main thread first so the thread is available at u.run (#809).
-	u.t = mainthread.NewOSThread()
+	// 渲染线程在NewUserInterface中创建, 每个UserInterface一个, Loop占用当前OS线程.
 	// graphicscommand.SetRenderingThread(u.t)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
 
 	ch := make(chan error, 1)
 	go func() {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"xmediaEmu/pkg/emulator/libretro"
 	"xmediaEmu/pkg/emulator/libretro/games"
+	"xmediaEmu/pkg/inpututil"
 )
 
 const (
@@ -24,12 +25,13 @@ const (
 //	dc.SavePNG("out.png")
 //}
 
-// 以默认theUI为例.
+// 以文字游戏为例.
 func gameMain() {
 	// FPS如何定义.
 	ui := libretro.NewGameForUI(&games.Game{})
-	libretro.Get().SetWindowSize(screenWidth, screenHeight)
-	if err := ui.RunGame(libretro.Get()); err != nil {
+	window := libretro.NewUserInterface(inpututil.NewInputMgr())
+	window.SetWindowSize(screenWidth, screenHeight)
+	if err := ui.RunGame(window); err != nil {
 		fmt.Printf("Run game failed: %v.\n ", err)
 	}
 }
@@ -14,19 +14,12 @@ import (
 	"xmediaEmu/pkg/mainthread"
 )
 
-// default single UI Object.
-var (
-	seed  = rand.New(rand.NewSource(time.Now().UnixNano())).Uint32()
-	theUI = NewUserInterface(inpututil.DefaultMgr())
-)
-
-func init() {
-}
+var seed = rand.New(rand.NewSource(time.Now().UnixNano())).Uint32()
 
-func Get() *UserInterface {
-	return theUI
-}
+// snapshotWait GetViewPort等待下一帧的最长时间.
+const snapshotWait = time.Second
 
+// NewUserInterface 每个room一个, 各自的输入、窗口和渲染线程.
 func NewUserInterface(input *inpututil.InputManager) *UserInterface {
 	return &UserInterface{
 		runnableOnUnfocused:   true,
@@ -35,6 +28,8 @@ func NewUserInterface(input *inpututil.InputManager) *UserInterface {
 		initWindowHeightInDIP: 480,
 		fpsMode:               inpututil.FPSIntAndKey, // 默认只接受整数序和字符串输入.
 		input:                 input,
+		t:                     mainthread.NewOSThread(),
+		snapshots:             make(chan chan *image.RGBA),
 	}
 }
 
@@ -56,6 +51,9 @@ type UserInterface struct {
 	// initFullscreenHeightInDIP int
 	windowOutSideWidth  int
 	windowOutSideHeight int
+	// 运行中调整的大小, 下一帧生效, 0表示没有调整.
+	resizeWidth  int
+	resizeHeight int
 
 	// err must be accessed from the main thread.
 	err error
@@ -64,6 +62,7 @@ type UserInterface struct {
 	iwindow *iImage.Context
 
 	running uint32
+	closed  uint32 // Close之后不能再运行.
 
 	// t is the main thread == the rendering thread.
 	t mainthread.Thread
@@ -71,6 +70,8 @@ type UserInterface struct {
 
 	// 输出到channel通道.
 	imageChannel chan<- GameFrame
+	// GetViewPort的请求, swapBuffers时在渲染线程拷贝画面.
+	snapshots chan chan *image.RGBA
 }
 
 func (u *UserInterface) SetRunnableOnUnfocused(runnableOnUnfocused bool) {
@@ -85,8 +86,20 @@ func (u *UserInterface) GetInputMgr() *inpututil.InputManager {
 	return u.input
 }
 
+// GetViewPort 下一帧画面的拷贝, 没有运行或snapshotWait内没有新的帧时返回nil.
 func (u *UserInterface) GetViewPort() image.Image {
-	return u.iwindow.Image()
+	if !u.IsRunning() {
+		return nil
+	}
+	req := make(chan *image.RGBA, 1)
+	timeout := time.NewTimer(snapshotWait)
+	defer timeout.Stop()
+	select {
+	case u.snapshots <- req:
+		return <-req
+	case <-timeout.C:
+		return nil
+	}
 }
 
 // ops only once.
@@ -99,6 +112,33 @@ func (u *UserInterface) SetWindowSize(w, h int) bool {
 	return true
 }
 
+// Resize 运行中调整输出大小, 下一帧生效.
+func (u *UserInterface) Resize(w, h int) {
+	if w <= 0 || h <= 0 {
+		return
+	}
+	u.m.Lock()
+	u.resizeWidth, u.resizeHeight = w, h
+	u.m.Unlock()
+}
+
+// applyResize 在loop里每帧开始时调用.
+func (u *UserInterface) applyResize() {
+	u.m.Lock()
+	w, h := u.resizeWidth, u.resizeHeight
+	u.resizeWidth, u.resizeHeight = 0, 0
+	u.m.Unlock()
+	if w == 0 || h == 0 {
+		return
+	}
+	u.t.Call(func() {
+		u.m.Lock()
+		defer u.m.Unlock()
+		u.windowOutSideWidth, u.windowOutSideHeight = w, h
+		u.iwindow = iImage.NewContext(w, h)
+	})
+}
+
 // TODO: 常规尺寸设定函数: 480*640. 根据目标尺寸进行对应调整.
 func (u *UserInterface) AdjustSize(winWidth, winHeight int) {
 
@@ -153,7 +193,13 @@ func (u *UserInterface) SetFPSMode(mode inpututil.FPSModeType) {
 }
 
 func (u *UserInterface) IsRunning() bool {
-	return atomic.LoadUint32(&u.running) != 0
+	return atomic.LoadUint32(&u.running) != 0 && atomic.LoadUint32(&u.closed) == 0
+}
+
+// Close 结束游戏循环, Run之前调用时Run立即结束.
+func (u *UserInterface) Close() {
+	atomic.StoreUint32(&u.closed, 1)
+	u.SetRunning(false)
 }
 
 func (u *UserInterface) SetRunning(running bool) {
@@ -201,10 +247,7 @@ func (u *UserInterface) update() (int, int, error) {
 	}
 
 	// events callback.
-	// inputs call back
-	if err := u.input.Update(); err != nil {
-		return 0, 0, err
-	}
+	// inputs call back: 按键和语音在loop里每个tick更新一次, 这里不能再更新.
 
 	// focus失效，静音处理.
 	// image1 unchanged.
@@ -240,10 +283,17 @@ func (u *UserInterface) loop() error {
 
 	// fps 设置问题.
 	ticker := time.NewTicker(time.Second / time.Duration(u.context.MaxTPS()))
+	defer ticker.Stop()
 	for range ticker.C {
 		if u.IsRunning() == false {
 			return errors.New("Game end. ")
 		}
+		u.applyResize()
+
+		// 每个tick更新一次按键和语音输入, 游戏Update里读取.
+		if err := u.input.Update(); err != nil {
+			return err
+		}
 
 		// TODO:
 		//var outsideWidth, outsideHeight int
@@ -270,13 +320,26 @@ func (u *UserInterface) loop() error {
 	return nil
 }
 
-func (u *UserInterface) resetForTick() {
-	u.input.GetInput().ResetForTick()
-}
-
 // swapBuffers must be called from the main thread.
 func (u *UserInterface) swapBuffers() {
+	u.serveSnapshots(u.iwindow.ImageRgba())
 	// Timestamp = current?.
 	u.imageChannel <- GameFrame{Image: u.iwindow.ImageRgba(), Timestamp: uint32(time.Now().UnixNano()/8333) + seed}
 	log.Logger.Debugf("swapBuffers write pixels length: %d, width:%d, length:%d\n", len(u.iwindow.ImageRgba().Pix), u.windowOutSideWidth, u.windowOutSideHeight)
 }
+
+// serveSnapshots 给等待中的GetViewPort拷贝当前帧, 之后的绘制不影响拷贝.
+func (u *UserInterface) serveSnapshots(frame *image.RGBA) {
+	var snapshot *image.RGBA
+	for {
+		select {
+		case req := <-u.snapshots:
+			if snapshot == nil {
+				snapshot = &image.RGBA{Pix: append([]uint8(nil), frame.Pix...), Stride: frame.Stride, Rect: frame.Rect}
+			}
+			req <- snapshot
+		default:
+			return
+		}
+	}
+}
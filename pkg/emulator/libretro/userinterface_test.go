@@ -0,0 +1,161 @@
+package libretro
+
+import (
+	"bytes"
+	"image"
+	"testing"
+	"time"
+
+	iImage "xmediaEmu/pkg/image"
+	"xmediaEmu/pkg/inpututil"
+)
+
+// inputGame 每个tick把刚按下的键和收到的语音发出去.
+type inputGame struct {
+	input  *inpututil.InputManager
+	keys   chan inpututil.Key
+	voices chan inpututil.Voice
+}
+
+func newInputGame() *inputGame {
+	return &inputGame{keys: make(chan inpututil.Key, 16), voices: make(chan inpututil.Voice, 16)}
+}
+
+func (g *inputGame) SetInputMgr(input *inpututil.InputManager) { g.input = input }
+
+func (g *inputGame) Update() error {
+	for _, voice := range g.input.VoiceFrames() {
+		g.voices <- voice
+	}
+	for key := inpututil.Key(0); key < inpututil.KeyMax; key++ {
+		if g.input.IsKeyJustPressed(key) {
+			g.keys <- key
+		}
+	}
+	return nil
+}
+
+func (g *inputGame) Draw(*iImage.Context) {}
+
+func (g *inputGame) Layout(w, h int) (int, int) { return w, h }
+
+// runGame 在新的UserInterface里运行game, 测试结束时关闭.
+func runGame(t *testing.T, game GameUser) *UserInterface {
+	ui := NewUserInterface(inpututil.NewInputMgr())
+	ui.SetWindowSize(32, 32)
+	ui.SetWindowTitle("test")
+	frames := make(chan GameFrame, 1)
+	ui.SetImageChannel(frames)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewGameForUI(game).RunGame(ui)
+	}()
+	go func() {
+		for {
+			select {
+			case <-frames:
+			case <-done:
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		ui.Close()
+		<-done
+	})
+	return ui
+}
+
+// 每个tick的Update之前更新输入, 语音和按键只在收到后的一个tick里出现.
+func TestLoopUpdatesInput(t *testing.T) {
+	game := newInputGame()
+	ui := runGame(t, game)
+
+	ui.GetInputMgr().SendInput(inpututil.Voice{PCM: []byte{1, 2}, SampleRate: 8000, Timestamp: 160})
+	select {
+	case voice := <-game.voices:
+		if voice.Timestamp != 160 || len(voice.PCM) != 2 {
+			t.Fatalf("got %+v", voice)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("voice not delivered")
+	}
+
+	ui.GetInputMgr().SendInput(inpututil.KeyDigit5)
+	select {
+	case key := <-game.keys:
+		if key != inpututil.KeyDigit5 {
+			t.Fatalf("got %v", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("key not delivered")
+	}
+
+	time.Sleep(5 * time.Second / DefaultTPS)
+	if len(game.voices) != 0 || len(game.keys) != 0 {
+		t.Fatalf("input repeated: %d voices, %d keys", len(game.voices), len(game.keys))
+	}
+}
+
+// 每个UserInterface各自的输入, 一个room的按键不会出现在另一个room.
+func TestInputPerUserInterface(t *testing.T) {
+	a, b := newInputGame(), newInputGame()
+	uiA, _ := runGame(t, a), runGame(t, b)
+
+	uiA.GetInputMgr().SendInput(inpututil.KeyDigit1)
+	select {
+	case <-a.keys:
+	case <-time.After(time.Second):
+		t.Fatal("key not delivered")
+	}
+	time.Sleep(3 * time.Second / DefaultTPS)
+	if len(b.keys) != 0 {
+		t.Fatal("key leaked to another user interface")
+	}
+}
+
+// colorGame 每帧换一个颜色.
+type colorGame struct {
+	frame int
+}
+
+func (g *colorGame) Update() error {
+	g.frame++
+	return nil
+}
+
+func (g *colorGame) Draw(screen *iImage.Context) {
+	screen.SetRGB255(g.frame%256, 0, 0)
+	screen.Clear()
+}
+
+func (g *colorGame) Layout(w, h int) (int, int) { return w, h }
+
+// GetViewPort返回渲染线程拷贝的画面, 之后的帧不会改变它.
+func TestGetViewPort(t *testing.T) {
+	ui := runGame(t, &colorGame{})
+	for !ui.IsRunning() {
+		time.Sleep(time.Millisecond)
+	}
+
+	img, ok := ui.GetViewPort().(*image.RGBA)
+	if !ok || img.Rect.Empty() {
+		t.Fatal("no snapshot")
+	}
+	pix := append([]uint8(nil), img.Pix...)
+	next, ok := ui.GetViewPort().(*image.RGBA)
+	if !ok || next == img {
+		t.Fatal("snapshot reused")
+	}
+	time.Sleep(3 * time.Second / DefaultTPS)
+	if !bytes.Equal(pix, img.Pix) {
+		t.Fatal("snapshot changed by later frames")
+	}
+
+	ui.Close()
+	if ui.GetViewPort() != nil {
+		t.Fatal("snapshot after close")
+	}
+}
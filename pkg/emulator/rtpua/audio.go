@@ -0,0 +1,71 @@
+package rtpua
+
+import (
+	"common/rtpengine/rtp"
+	"common/rtpengine/rtp/codecs"
+	"strings"
+	"xmediaEmu/pkg/emulator/config"
+)
+
+// 静态负载类型, rfc3551.
+const (
+	pcmuPayload = 0
+	pcmaPayload = 8
+)
+
+// amrPayloader rfc4867 octet-aligned, 一个包一帧.
+// 编码器输出storage格式, 首字节即ToC(F=0), 前面补CMR=15不请求码率.
+type amrPayloader struct{}
+
+func (p *amrPayloader) Payload(mtu uint16, payload []byte) [][]byte {
+	if len(payload) == 0 {
+		return nil
+	}
+	out := make([]byte, 1+len(payload))
+	out[0] = 0xF0
+	copy(out[1:], payload)
+	return [][]byte{out}
+}
+
+// 根据编码选择音频负载类型默认值.
+func defaultAudioPayload(codec string) int {
+	switch config.AudioCodec(codec) {
+	case config.G711:
+		return pcmuPayload
+	case config.G711A:
+		return pcmaPayload
+	default:
+		return audioPayload
+	}
+}
+
+// audioPayloader 返回编码对应的打包方式和rtp时钟.
+func audioPayloader(audio config.AudioConfig) (rtp.Payloader, int) {
+	switch config.AudioCodec(audio.Codec) {
+	case config.AMRNB:
+		return &amrPayloader{}, 8000
+	case config.AMRWB:
+		return &amrPayloader{}, 16000
+	case config.PCM:
+		return &codecs.G711Payloader{}, audio.Frequency // L16直接按字节切分.
+	default:
+		return &codecs.G711Payloader{}, 8000
+	}
+}
+
+// audioFrame 每帧毫秒数, amr固定20ms.
+func audioFrame(audio config.AudioConfig) int {
+	switch config.AudioCodec(audio.Codec) {
+	case config.AMRNB, config.AMRWB:
+		return 20
+	}
+	if audio.Frame <= 0 {
+		return 20
+	}
+	return audio.Frame
+}
+
+// 是否配置了音频.
+func hasAudio(audio config.AudioConfig) bool {
+	return strings.TrimSpace(audio.Codec) != ""
+}
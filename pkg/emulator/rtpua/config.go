@@ -4,14 +4,16 @@ import (
 	encoder "xmediaEmu/pkg/emulator/config"
 )
 
-const audioPayload  = 101
-const videoPayload  = 102
+const audioPayload = 101
+const videoPayload = 102
+const telephoneEventPayload = 100
 
 type Config struct {
 	Encoder encoder.EncoderConfig
 	NetWork string
 	// UdpAddr *net.UDPAddr
-	UdpAddr string // "IP:Port"
-	SessionId  string //
+	UdpAddr      string // "IP:Port", 音视频复用.
+	SessionId    string //
+	SrtpRequired bool   // 不接受明文rtp.
+	InbandDtmf   bool   // 语音里检测带内dtmf.
 }
-
@@ -0,0 +1,172 @@
+package rtpua
+
+import (
+	"common/rtpengine"
+	"common/util/process"
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xmediaEmu/pkg/log"
+)
+
+// rtpSession 音视频复用同一个端口(同一个5元组), 各自的ssrc、序号和时间戳.
+// 收到的包先按对端ssrc, 再按负载类型分发到对应的流, rtcp在端口+1.
+type rtpSession struct {
+	id      string
+	network string
+	conn    *net.UDPConn
+	video   *rtpStream
+	audio   *rtpStream
+	rtcp    *rtcpSession
+	done    chan struct{}
+
+	mu    sync.Mutex
+	ssrcs map[uint32]*rtpStream // 对端ssrc到本端流.
+
+	alive *liveness
+}
+
+// liveness 最后收到对端rtp或rtcp的时间, 用于检测对端是否还在.
+type liveness struct {
+	last int64 // unix nano.
+}
+
+func (l *liveness) touch(t time.Time) {
+	atomic.StoreInt64(&l.last, t.UnixNano())
+}
+
+// get 还没有时间时返回零值.
+func (l *liveness) get() time.Time {
+	last := atomic.LoadInt64(&l.last)
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
+
+func newRtpSession(id, network, localAddr string, alive *liveness) (*rtpSession, error) {
+	if network == "" {
+		network = "udp"
+	}
+	laddr, err := net.ResolveUDPAddr(network, localAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	rtcp, err := newRtcpSession(id, network, conn, alive)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &rtpSession{
+		id:      id,
+		network: network,
+		conn:    conn,
+		rtcp:    rtcp,
+		done:    make(chan struct{}),
+		ssrcs:   map[uint32]*rtpStream{},
+		alive:   alive,
+	}, nil
+}
+
+// addStream 增加一路媒体, 音视频各一路.
+func (s *rtpSession) addStream(binding rtpengine.SenderBinding, clockRate, frequence int, isVideo bool) (*rtpStream, error) {
+	media := "audio"
+	if isVideo {
+		media = "video"
+	}
+	stream, err := newRtpStream(s.conn, s.network, media, binding, clockRate, frequence, isVideo)
+	if err != nil {
+		return nil, err
+	}
+	if isVideo {
+		s.video = stream
+	} else {
+		s.audio = stream
+	}
+	s.rtcp.streams = append(s.rtcp.streams, stream)
+	return stream, nil
+}
+
+// start 开始接收, onKeyframeRequest对端PLI/FIR时回调.
+func (s *rtpSession) start(onKeyframeRequest func()) {
+	s.rtcp.onKeyframeRequest = onKeyframeRequest
+	s.rtcp.start()
+	go s.readLoop()
+}
+
+func (s *rtpSession) Close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+	close(s.done)
+
+	s.rtcp.Close()
+	return s.conn.Close()
+}
+
+func (s *rtpSession) readLoop() {
+	defer func() {
+		if v := recover(); v != nil {
+			process.DefaultPanicReport.RecoverFromPanic(s.id, "rtpSession:readLoop", v)
+		}
+	}()
+	defer func() {
+		for _, stream := range s.rtcp.streams {
+			close(stream.incoming)
+		}
+	}()
+
+	buf := make([]byte, rtpBufferSize)
+	for {
+		n, _, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-s.done:
+			default:
+				log.Logger.Errorf("rtp read failed: %v, id:%s", err, s.id)
+			}
+			return
+		}
+		// 只处理rtp v2, rtcp走单独端口, 复用过来的rtcp(rfc5761)忽略.
+		if n < rtpHeaderSize || buf[0]>>6 != 2 || (buf[1] >= 192 && buf[1] <= 223) {
+			continue
+		}
+		arrival := time.Now()
+		s.alive.touch(arrival)
+		stream := s.demux(binary.BigEndian.Uint32(buf[8:]), buf[1]&0x7f)
+		if stream == nil {
+			continue
+		}
+		// 包交给上层异步处理, 不能引用读缓冲.
+		data := append([]byte(nil), buf[:n]...)
+		if err := stream.receive(data, arrival); err != nil {
+			log.Logger.Debugf("rtp receive failed: %v, id:%s media:%s", err, s.id, stream.media)
+		}
+	}
+}
+
+// demux 已知的对端ssrc直接分发, 新的ssrc按负载类型: 视频负载给视频, 其他给音频, 没有音频时都给视频.
+func (s *rtpSession) demux(ssrc uint32, payloadType uint8) *rtpStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stream, ok := s.ssrcs[ssrc]; ok {
+		return stream
+	}
+	stream := s.video
+	if s.audio != nil && (stream == nil || payloadType != uint8(stream.binding.PayloadType)) {
+		stream = s.audio
+	}
+	if stream != nil {
+		s.ssrcs[ssrc] = stream
+	}
+	return stream
+}
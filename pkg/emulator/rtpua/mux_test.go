@@ -0,0 +1,114 @@
+package rtpua
+
+import (
+	"common/rtpengine"
+	"common/rtpengine/rtp"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestSession rtcp占用rtp端口+1, 被占用时换一个端口.
+func newTestSession(t *testing.T, alive *liveness) *rtpSession {
+	var err error
+	for i := 0; i < 5; i++ {
+		var s *rtpSession
+		if s, err = newRtpSession("test", "udp", "127.0.0.1:0", alive); err == nil {
+			return s
+		}
+	}
+	t.Fatal(err)
+	return nil
+}
+
+func nextPacket(t *testing.T, stream *rtpStream) *rtp.Packet {
+	select {
+	case p := <-stream.incoming:
+		return p
+	case <-time.After(time.Second):
+		t.Fatalf("no packet on %s", stream.media)
+		return nil
+	}
+}
+
+// 音视频同一个端口, 新的ssrc按负载类型分发, 之后按ssrc.
+func TestRtpSessionDemux(t *testing.T) {
+	alive := &liveness{}
+	session := newTestSession(t, alive)
+	peer := listenUDP(t)
+	video, err := session.addStream(rtpengine.SenderBinding{RightAddr: peer.LocalAddr().String(), PayloadType: 96, Payloader: splitPayloader{}}, 90000, 30, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio, err := session.addStream(rtpengine.SenderBinding{RightAddr: peer.LocalAddr().String(), PayloadType: 0, Payloader: splitPayloader{}}, 8000, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.start(nil)
+
+	send := func(data []byte) {
+		if _, err := peer.WriteToUDP(data, session.conn.LocalAddr().(*net.UDPAddr)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(marshalPacket(t, 0xA, 96, 1, 0))
+	send(marshalPacket(t, 0xB, 0, 1, 0))
+	if p := nextPacket(t, video); p.SSRC != 0xA {
+		t.Fatalf("video got %x", p.SSRC)
+	}
+	if p := nextPacket(t, audio); p.SSRC != 0xB {
+		t.Fatalf("audio got %x", p.SSRC)
+	}
+
+	// 已知的ssrc不看负载类型, 如音频ssrc上的telephone-event.
+	send(marshalPacket(t, 0xB, 101, 2, 0))
+	send(marshalPacket(t, 0xB, 96, 3, 0))
+	// 复用过来的rtcp和非rtp v2的包忽略.
+	rtcpPacket := marshalPacket(t, 0xA, 0, 2, 0)
+	rtcpPacket[1] = 200
+	send(rtcpPacket)
+	send([]byte{0x40, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xA})
+	send(marshalPacket(t, 0xA, 96, 4, 0))
+
+	for _, seq := range []uint16{2, 3} {
+		if p := nextPacket(t, audio); p.SequenceNumber != seq {
+			t.Fatalf("audio got seq %d", p.SequenceNumber)
+		}
+	}
+	if p := nextPacket(t, video); p.SequenceNumber != 4 {
+		t.Fatalf("video got seq %d", p.SequenceNumber)
+	}
+	if alive.get().IsZero() {
+		t.Fatal("liveness not updated")
+	}
+
+	// 关闭后结束接收, 流的incoming关闭.
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Close(); err != nil {
+		t.Fatal("second close should be ignored")
+	}
+	for _, stream := range []*rtpStream{video, audio} {
+		select {
+		case _, ok := <-stream.incoming:
+			if ok {
+				t.Fatalf("unexpected packet on %s", stream.media)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s incoming not closed", stream.media)
+		}
+	}
+}
+
+// 没有音频时所有的包都给视频.
+func TestDemuxVideoOnly(t *testing.T) {
+	video := &rtpStream{binding: rtpengine.SenderBinding{PayloadType: 96}}
+	s := &rtpSession{video: video, ssrcs: map[uint32]*rtpStream{}}
+	if s.demux(1, 0) != video || s.demux(2, 96) != video {
+		t.Fatal("should go to video")
+	}
+	if (&rtpSession{ssrcs: map[uint32]*rtpStream{}}).demux(1, 96) != nil {
+		t.Fatal("no stream")
+	}
+}
@@ -0,0 +1,213 @@
+package rtpua
+
+import (
+	"net"
+	"strconv"
+	"time"
+	"xmediaEmu/pkg/emulator/config"
+	"xmediaEmu/pkg/log"
+	"xmediaEmu/pkg/media/sdp"
+	"xmediaEmu/pkg/media/srtp"
+)
+
+// baseline level 3.1, 编码器固定baseline.
+const h264Fmtp = "profile-level-id=42e01f;packetization-mode=1"
+
+// mediaAnswer 一路媒体协商结果.
+type mediaAnswer struct {
+	codec     sdp.Codec
+	event     *sdp.Codec // telephone-event, 对端没带时为nil.
+	remote    string     // 对端rtp地址.
+	direction sdp.Direction
+
+	// RTP/SAVP时对端和本端的sdes密钥, 明文时为nil.
+	remoteKey *srtp.Crypto
+	localKey  *srtp.Crypto
+}
+
+// videoCodecs 本端视频能力, 只支持h264.
+func (w *RtpUa) videoCodecs() []sdp.Codec {
+	return []sdp.Codec{{PayloadType: uint8(w.videoPayLoad), Name: sdp.CodecH264, ClockRate: 90000, Fmtp: h264Fmtp}}
+}
+
+// audioCodecs 本端音频能力, 按配置的编码, 再加上telephone-event.
+func (w *RtpUa) audioCodecs() []sdp.Codec {
+	audio := w.cfg.Encoder.Audio
+	if !hasAudio(audio) {
+		return nil
+	}
+	_, clockRate := audioPayloader(audio)
+	if clockRate <= 0 {
+		clockRate = 8000
+	}
+
+	c := sdp.Codec{PayloadType: uint8(w.audioPayLoad), ClockRate: clockRate}
+	switch config.AudioCodec(audio.Codec) {
+	case config.G711:
+		c.Name = sdp.CodecPCMU
+	case config.G711A:
+		c.Name = sdp.CodecPCMA
+	case config.AMRNB:
+		c.Name, c.Fmtp = sdp.CodecAMR, "octet-align=1"
+	case config.AMRWB:
+		c.Name, c.Fmtp = sdp.CodecAMRWB, "octet-align=1"
+	case config.PCM:
+		c.Name, c.Channels = sdp.CodecL16, audio.Channels
+	default:
+		return nil
+	}
+	event := sdp.Codec{PayloadType: telephoneEventPayload, Name: sdp.CodecTelephoneEvent, ClockRate: clockRate, Fmtp: "0-15"}
+	return []sdp.Codec{c, event}
+}
+
+// negotiate 按本端能力匹配一路媒体, 不支持时返回nil.
+func negotiate(offer *sdp.SessionDescription, m *sdp.MediaDescription, local []sdp.Codec, localDir sdp.Direction, srtpRequired bool) *mediaAnswer {
+	if m == nil || m.Port == 0 || len(local) == 0 {
+		return nil
+	}
+	if srtpRequired && m.Proto != sdp.ProtoRtpSavp {
+		log.Logger.Infof("negotiate: srtp required, reject %s %s", m.Type, m.Proto)
+		return nil
+	}
+	codecs := sdp.Negotiate(m.Codecs, local)
+	if len(codecs) == 0 {
+		return nil
+	}
+	remote, err := offer.RemoteAddr(m)
+	if err != nil {
+		return nil
+	}
+
+	answer := &mediaAnswer{codec: codecs[0], remote: remote, direction: localDir.Intersect(offer.MediaDirection(m).Reverse())}
+	if len(codecs) > 1 {
+		answer.event = &codecs[1]
+	}
+	if m.Proto == sdp.ProtoRtpSavp {
+		if answer.remoteKey, answer.localKey, err = negotiateCrypto(m); err != nil {
+			log.Logger.Infof("negotiate: %s srtp failed: %v", m.Type, err)
+			return nil
+		}
+	}
+	return answer
+}
+
+// negotiateCrypto 选第一个支持的a=crypto, 本端生成同tag的密钥.
+func negotiateCrypto(m *sdp.MediaDescription) (*srtp.Crypto, *srtp.Crypto, error) {
+	for _, a := range m.Attributes {
+		if a.Key != "crypto" {
+			continue
+		}
+		remote, err := srtp.ParseCrypto(a.Value)
+		if err != nil || !remote.Supported() {
+			continue
+		}
+		local, err := srtp.NewCrypto(remote.Tag)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &remote, &local, nil
+	}
+	return nil, nil, srtp.ErrBadCrypto
+}
+
+// contexts 发送用本端密钥, 接收用对端密钥.
+func (a *mediaAnswer) contexts() (tx, rx *srtp.Context, err error) {
+	if a.localKey == nil {
+		return nil, nil, nil
+	}
+	if tx, err = a.localKey.Context(); err != nil {
+		return nil, nil, err
+	}
+	if rx, err = a.remoteKey.Context(); err != nil {
+		return nil, nil, err
+	}
+	return tx, rx, nil
+}
+
+// AddrOffer 对端没有sdp时, 按地址和负载类型构造offer, 兼容只带addr的请求.
+func (w *RtpUa) AddrOffer(peerAddr, audioPeerAddr string) (*sdp.SessionDescription, error) {
+	host, port, err := splitAddr(peerAddr)
+	if err != nil {
+		return nil, err
+	}
+	offer := &sdp.SessionDescription{
+		Origin:  sdp.Origin{Address: host},
+		Address: host,
+		Media:   []*sdp.MediaDescription{{Type: sdp.MediaVideo, Port: port, Proto: sdp.ProtoRtpAvp, Codecs: w.videoCodecs()}},
+	}
+
+	if codecs := w.audioCodecs(); len(codecs) > 0 {
+		if audioPeerAddr == "" {
+			audioPeerAddr = peerAddr
+		}
+		audioHost, audioPort, err := splitAddr(audioPeerAddr)
+		if err != nil {
+			return nil, err
+		}
+		offer.Media = append(offer.Media, &sdp.MediaDescription{Type: sdp.MediaAudio, Port: audioPort, Proto: sdp.ProtoRtpAvp, Address: audioHost, Codecs: codecs[:1]})
+	}
+	return offer, nil
+}
+
+// answer 按offer的m=行顺序生成answer, 拒绝的媒体端口为0.
+func (w *RtpUa) answer(offer *sdp.SessionDescription, video, audio *mediaAnswer) (string, error) {
+	host, videoPort, err := splitAddr(w.cfg.UdpAddr)
+	if err != nil {
+		return "", err
+	}
+	now := uint64(time.Now().Unix())
+	answer := &sdp.SessionDescription{
+		Origin:  sdp.Origin{Username: "xmediaEmu", SessionID: now, SessionVersion: now, Address: host},
+		Address: host,
+	}
+
+	for _, m := range offer.Media {
+		media := &sdp.MediaDescription{Type: m.Type, Proto: m.Proto}
+		var accepted *mediaAnswer
+		var port int
+		switch m.Type {
+		case sdp.MediaVideo:
+			if m == offer.MediaOf(sdp.MediaVideo) {
+				accepted, port = video, videoPort
+			}
+		case sdp.MediaAudio:
+			// 音视频复用同一个端口.
+			if m == offer.MediaOf(sdp.MediaAudio) && audio != nil {
+				accepted, port = audio, videoPort
+			}
+		}
+
+		if accepted == nil {
+			// 拒绝, 格式原样带回.
+			media.Formats = m.Formats
+			answer.Media = append(answer.Media, media)
+			continue
+		}
+		media.Port = port
+		media.Direction = accepted.direction
+		media.Codecs = []sdp.Codec{accepted.codec}
+		if accepted.event != nil {
+			media.Codecs = append(media.Codecs, *accepted.event)
+		}
+		if accepted.localKey != nil {
+			media.Attributes = append(media.Attributes, sdp.Attribute{Key: "crypto", Value: accepted.localKey.String()})
+		}
+		if m.Type == sdp.MediaAudio {
+			media.Ptime = audioFrame(w.cfg.Encoder.Audio)
+		}
+		answer.Media = append(answer.Media, media)
+	}
+	return answer.Marshal(), nil
+}
+
+func splitAddr(addr string) (string, int, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, p, nil
+}
@@ -0,0 +1,236 @@
+package rtpua
+
+import (
+	"common/util/process"
+	"net"
+	"time"
+	"xmediaEmu/pkg/log"
+	"xmediaEmu/pkg/media/rtcp"
+	"xmediaEmu/pkg/metric"
+)
+
+// rfc3550建议的最小发送间隔.
+const rtcpInterval = 5 * time.Second
+
+// rtcpSession rtp会话对应的rtcp, 端口为rtp端口+1(同PortSuite), 音视频共用.
+// 定时发送SR+SDES, 解析对端的SR/RR/PLI/FIR.
+type rtcpSession struct {
+	id      string // cname, 用SessionId.
+	streams []*rtpStream
+	conn    *net.UDPConn
+	done    chan struct{}
+	alive   *liveness
+
+	// 对端请求视频关键帧.
+	onKeyframeRequest func()
+}
+
+// rtcpAddr rtp地址端口加1.
+func rtcpAddr(addr *net.UDPAddr) *net.UDPAddr {
+	return &net.UDPAddr{IP: addr.IP, Port: addr.Port + 1, Zone: addr.Zone}
+}
+
+func newRtcpSession(id, network string, rtpConn *net.UDPConn, alive *liveness) (*rtcpSession, error) {
+	if network == "" {
+		network = "udp"
+	}
+	conn, err := net.ListenUDP(network, rtcpAddr(rtpConn.LocalAddr().(*net.UDPAddr)))
+	if err != nil {
+		return nil, err
+	}
+	return &rtcpSession{
+		id:    id,
+		conn:  conn,
+		done:  make(chan struct{}),
+		alive: alive,
+	}, nil
+}
+
+func (s *rtcpSession) start() {
+	go s.sendLoop()
+	go s.readLoop()
+}
+
+func (s *rtcpSession) Close() {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	close(s.done)
+
+	// 结束前通知对端.
+	now := time.Now()
+	for _, stream := range s.streams {
+		_ = s.write(stream, stream.senderReport(now), &rtcp.Goodbye{Sources: []uint32{stream.ssrc}})
+	}
+	if err := s.conn.Close(); err != nil {
+		log.Logger.Errorf("error: couldn't close rtcp connection, %v", err)
+	}
+	for _, stream := range s.streams {
+		metric.DeleteRtp(s.id, stream.media)
+	}
+}
+
+func (s *rtcpSession) sendLoop() {
+	defer func() {
+		if v := recover(); v != nil {
+			process.DefaultPanicReport.RecoverFromPanic(s.id, "rtcpSession:sendLoop", v)
+		}
+	}()
+
+	t := time.NewTicker(rtcpInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-t.C:
+			for _, stream := range s.streams {
+				sdes := &rtcp.SourceDescription{Chunks: []rtcp.SourceDescriptionChunk{{Source: stream.ssrc, CNAME: s.id}}}
+				if err := s.write(stream, stream.senderReport(now), sdes); err != nil {
+					log.Logger.Debugf("rtcp write failed: %v, id:%s media:%s", err, s.id, stream.media)
+				}
+			}
+			s.observe()
+		}
+	}
+}
+
+// write 按流发送复合包, 发往该流对端rtp端口+1, 协商了srtp时加密.
+func (s *rtcpSession) write(stream *rtpStream, packets ...rtcp.Packet) error {
+	data, err := rtcp.Marshal(packets...)
+	if err != nil {
+		return err
+	}
+	if stream.srtpTx != nil {
+		if data, err = stream.srtpTx.EncryptRTCP(data); err != nil {
+			return err
+		}
+	}
+	_, err = s.conn.WriteToUDP(data, rtcpAddr(stream.remote))
+	return err
+}
+
+func (s *rtcpSession) readLoop() {
+	defer func() {
+		if v := recover(); v != nil {
+			process.DefaultPanicReport.RecoverFromPanic(s.id, "rtcpSession:readLoop", v)
+		}
+	}()
+
+	buf := make([]byte, rtpBufferSize)
+	for {
+		n, _, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-s.done:
+			default:
+				log.Logger.Errorf("rtcp read failed: %v, id:%s", err, s.id)
+			}
+			return
+		}
+		data, err := s.decrypt(buf[:n])
+		if err != nil {
+			log.Logger.Debugf("srtcp decrypt failed: %v, id:%s", err, s.id)
+			continue
+		}
+		packets, err := rtcp.Unmarshal(data)
+		if err != nil {
+			log.Logger.Debugf("rtcp unmarshal failed: %v, id:%s", err, s.id)
+			continue
+		}
+		arrival := time.Now()
+		s.alive.touch(arrival)
+		s.handle(packets, arrival)
+	}
+}
+
+// decrypt 音视频的密钥不同, 依次尝试有密钥的流, 都没有密钥时原样返回.
+func (s *rtcpSession) decrypt(data []byte) ([]byte, error) {
+	keyed := false
+	var err error
+	for _, stream := range s.streams {
+		if stream.srtpRx == nil {
+			continue
+		}
+		keyed = true
+		var plain []byte
+		if plain, err = stream.srtpRx.DecryptRTCP(data); err == nil {
+			return plain, nil
+		}
+	}
+	if !keyed {
+		return data, nil
+	}
+	return nil, err
+}
+
+func (s *rtcpSession) handle(packets []rtcp.Packet, arrival time.Time) {
+	for _, packet := range packets {
+		switch p := packet.(type) {
+		case *rtcp.SenderReport:
+			for _, stream := range s.streams {
+				if ssrc, ok := stream.remoteSSRC(); ok && ssrc == p.SSRC {
+					stream.onSenderReport(p, arrival)
+				}
+				for _, report := range p.Reports {
+					stream.onReceptionReport(report, arrival)
+				}
+			}
+		case *rtcp.ReceiverReport:
+			for _, stream := range s.streams {
+				for _, report := range p.Reports {
+					stream.onReceptionReport(report, arrival)
+				}
+			}
+		case *rtcp.PictureLossIndication:
+			if stream := s.stream(p.MediaSSRC); stream != nil && stream.isVideo {
+				stream.onFeedback(true)
+				s.requestKeyframe()
+			}
+		case *rtcp.FullIntraRequest:
+			for _, entry := range p.FIR {
+				if stream := s.stream(entry.SSRC); stream != nil && stream.isVideo {
+					stream.onFeedback(false)
+					s.requestKeyframe()
+					break
+				}
+			}
+		case *rtcp.Goodbye:
+			log.Logger.Infof("rtcp BYE received, id:%s sources:%v", s.id, p.Sources)
+		}
+	}
+	s.observe()
+}
+
+// stream 本端发送ssrc对应的流.
+func (s *rtcpSession) stream(ssrc uint32) *rtpStream {
+	for _, stream := range s.streams {
+		if stream.ssrc == ssrc {
+			return stream
+		}
+	}
+	return nil
+}
+
+func (s *rtcpSession) requestKeyframe() {
+	if s.onKeyframeRequest != nil {
+		s.onKeyframeRequest()
+	}
+}
+
+// observe 更新prometheus统计.
+func (s *rtcpSession) observe() {
+	for _, stream := range s.streams {
+		stats := stream.Stats()
+		metric.ObserveRtp(s.id, stream.media, metric.RtpStats{
+			PacketsSent:  stats.PacketsSent,
+			OctetsSent:   stats.OctetsSent,
+			PacketsLost:  stats.PacketsLost,
+			FractionLost: stats.FractionLost,
+			Jitter:       stats.Jitter,
+			RTT:          stats.RTT,
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package rtpua
+
+import (
+	"bytes"
+	"testing"
+	"xmediaEmu/pkg/media/rtcp"
+	"xmediaEmu/pkg/media/srtp"
+)
+
+func srtpContext(t *testing.T, key byte) *srtp.Context {
+	c, err := srtp.CreateContext(bytes.Repeat([]byte{key}, 16), bytes.Repeat([]byte{key}, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// 只有一路有密钥时不按明文处理, 和流的顺序无关.
+func TestRtcpDecryptMixed(t *testing.T) {
+	plain, err := (&rtcp.ReceiverReport{SSRC: 0xA}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := srtpContext(t, 1).EncryptRTCP(append([]byte(nil), plain...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, audioFirst := range []bool{false, true} {
+		// 每次新的接收context, 同一个包不能解密两次.
+		video, audio := &rtpStream{media: "video"}, &rtpStream{media: "audio", srtpRx: srtpContext(t, 1)}
+		s := &rtcpSession{streams: []*rtpStream{video, audio}}
+		if audioFirst {
+			s.streams = []*rtpStream{audio, video}
+		}
+		got, err := s.decrypt(encrypted)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("got %x %v, want %x", got, err, plain)
+		}
+		if _, err := s.decrypt(plain); err == nil {
+			t.Fatal("plain rtcp accepted on keyed session")
+		}
+	}
+
+	// 都没有密钥时原样返回.
+	s := &rtcpSession{streams: []*rtpStream{{media: "video"}, {media: "audio"}}}
+	if got, err := s.decrypt(plain); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("got %x %v", got, err)
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"common/rtpengine/rtp/codecs"
 	"common/util/process"
 	"encoding/json"
+	"errors"
+	"sync"
 	"sync/atomic"
 	"time"
 	"xmediaEmu/pkg/log"
+	"xmediaEmu/pkg/media/sdp"
 )
 
 type WebFrame struct {
@@ -27,14 +30,33 @@ type RtpUa struct { // = WebRtc.
 
 	//
 	// singleConnection       *net.UDPConn // incoming connections.TODO:暂时只考虑视频流或者音频流.
-	singleTrack *rtpengine.TrackLocal // 只支持一路.目前只做测试只有视频.
-	cfg         Config
+	// StartClient中设置, StopClient等发送goroutine结束后清空, m保护.
+	m           sync.Mutex
+	session     *rtpSession // 音视频复用一个端口.
+	singleTrack *rtpStream  // 视频流.
+	audioTrack  *rtpStream  // 音频流, 没配置音频编码或者对端没有音频时为nil.
+
+	// 对端PLI/FIR请求关键帧时回调, 由Room设置.
+	keyframeRequest atomic.Value
+
+	cfg Config
 
 	globalVideoFrameTimestamp uint32 // TODO:分段剪辑视频时用.
-	isConnected               bool   // 目前只支持一端.
+	isConnected               int32  // 目前只支持一端, 原子读写.
+	// StopClient时关闭, 只执行一次, 停止后不能再启动.
+	done     chan struct{}
+	stopOnce sync.Once
+	senders  sync.WaitGroup // 音视频发送goroutine.
 	// for yuvI420 image
+	// 不会被关闭, 用SendFrame和SendAudio写入, 断开后不再阻塞.
 	ImageChannel chan WebFrame
 	AudioChannel chan []byte
+	// 对端语音输入, 接收结束或StopClient后关闭.
+	VoiceInChannel chan VoiceFrame
+	// 对端按键, rfc4733或者带内dtmf, 0-9 * # A-D, 和VoiceInChannel一起关闭.
+	DtmfChannel chan rune
+	// 语音接收只启动一次, 没有启动(音频只发或inactive)时由StopClient关闭上面两个channel.
+	voiceOnce sync.Once
 
 	// input event?.
 	InputChannel chan []byte // ws 接口输入当做DataChannel,
@@ -46,6 +68,14 @@ type RtpUa struct { // = WebRtc.
 
 	audioPayLoad int
 	videoPayLoad int
+	dtmfPayLoad  int // 协商出的telephone-event, 0表示没有.
+
+	// 协商后的本端方向.
+	videoDirection sdp.Direction
+	audioDirection sdp.Direction
+
+	// 最后收到对端rtp/rtcp的时间, 开始时为StartClient的时间.
+	alive liveness
 }
 
 type OnIceCallback func(candidate string)
@@ -80,7 +110,7 @@ func Decode(in string, obj interface{}) error {
 // NewWebRTC create, 创建RtpUa请求，不支持重协商.
 func NewWebRTC(conf Config, aPayload, vPayload int) (*RtpUa, error) {
 	if aPayload == 0 {
-		aPayload = audioPayload
+		aPayload = defaultAudioPayload(conf.Encoder.Audio.Codec)
 	}
 	if vPayload == 0 {
 		vPayload = videoPayload
@@ -89,17 +119,21 @@ func NewWebRTC(conf Config, aPayload, vPayload int) (*RtpUa, error) {
 	w := &RtpUa{
 		ID: conf.SessionId,
 
-		ImageChannel: make(chan WebFrame, 30),
-		AudioChannel: make(chan []byte, 1),
-		//VoiceInChannel:  make(chan []byte, 1),
+		ImageChannel:   make(chan WebFrame, 30),
+		AudioChannel:   make(chan []byte, 50),
+		VoiceInChannel: make(chan VoiceFrame, 50),
+		DtmfChannel:    make(chan rune, 16),
 		//VoiceOutChannel: make(chan []byte, 1),
 		InputChannel: make(chan []byte, 100),
+		done:         make(chan struct{}),
 		cfg:          conf,
 		audioPayLoad: aPayload,
 		videoPayLoad: vPayload,
 	}
-	w.singleTrack = rtpengine.NewTrackLocal(conf.NetWork, conf.UdpAddr)
 	log.Logger.Debugf("NewWebRTC:%s %s", conf.NetWork, conf.UdpAddr)
+	if hasAudio(conf.Encoder.Audio) {
+		log.Logger.Debugf("NewWebRTC audio codec:%s", conf.Encoder.Audio.Codec)
+	}
 
 	// w.laddr = *conf.UdpAddr
 	// w.network = conf.NetWork
@@ -112,41 +146,81 @@ func NewWebRTC(conf Config, aPayload, vPayload int) (*RtpUa, error) {
 }
 
 // StartClient start rtp ua.
-// accept some clients.
-// 不支持媒体协商.
-// rtp等待开始连接，返回连接地址, 等待对端地址带过来...
-// 对端ip和端口发送给对端.
-//
-func (w *RtpUa) StartClient(peerAddr string) (string, error) {
+// 按对端offer协商编码、负载类型和方向, 返回answer.
+// rtp等待开始连接，对端地址从offer里的c=和m=行获取.
+func (w *RtpUa) StartClient(offer *sdp.SessionDescription) (string, error) {
 	defer func() {
 		if err := recover(); err != nil {
 			log.Logger.Error(err)
 			w.StopClient()
 		}
 	}()
-	var err error
-	w.paddr = peerAddr
-
-	// reset client
-	if w.isConnected {
-		w.StopClient()
-		time.Sleep(2 * time.Second)
+	// 不支持重协商, 启动过或者已经停止的不能再启动.
+	if w.IsConnected() || w.stopped() {
+		return "", errClientStarted
 	}
 	log.Logger.Debug("=== RtpUa: StartClient ===")
 
+	video := negotiate(offer, offer.MediaOf(sdp.MediaVideo), w.videoCodecs(), sdp.SendOnly, w.cfg.SrtpRequired)
+	if video == nil {
+		log.Logger.Debugf("StartClient: no common video codec")
+		return "", sdp.ErrNoCodecs
+	}
+	audio := negotiate(offer, offer.MediaOf(sdp.MediaAudio), w.audioCodecs(), sdp.SendRecv, w.cfg.SrtpRequired)
+	w.paddr = video.remote
+
 	// 编解码, 这里以h264视频为例.
-	binds := rtpengine.SenderBinding{RightAddr: peerAddr, PayloadType: rtpengine.PayloadType(w.videoPayLoad), Payloader: &codecs.H264Payloader{}}
-	w.singleTrack.Bind(binds)
-	w.singleTrack.SetFrequence(30)  // 视频30一帧？..
-	w.singleTrack.SetSamples(90000) // 视频采样例90k.
-
-	// 连接打通接口，复用rtp端口，音视频都用同一个接口.
-	// 使用默认缓存.
-	if err := w.singleTrack.StartSession(rtpengine.Config{}); err != nil {
-		log.Logger.Debugf("StartClient: StartSession failed:%v", err)
+	// 视频30一帧, 采样率90k.
+	w.videoPayLoad = int(video.codec.PayloadType)
+	w.videoDirection = video.direction
+	w.alive.touch(time.Now())
+	session, err := newRtpSession(w.ID, w.cfg.NetWork, w.cfg.UdpAddr, &w.alive)
+	if err != nil {
+		log.Logger.Debugf("StartClient: start rtp failed:%v", err)
+		return "", err
+	}
+
+	binds := rtpengine.SenderBinding{RightAddr: video.remote, PayloadType: rtpengine.PayloadType(w.videoPayLoad), Payloader: &codecs.H264Payloader{}}
+	videoTrack, err := session.addStream(binds, 90000, 30, true)
+	if err == nil {
+		err = videoTrack.protect(video)
+	}
+	if err != nil {
+		log.Logger.Debugf("StartClient: start video failed:%v", err)
+		session.Close()
 		return "", err
 	}
-	w.isConnected = true
+
+	var audioTrack *rtpStream
+	if audio != nil {
+		w.audioPayLoad = int(audio.codec.PayloadType)
+		w.audioDirection = audio.direction
+		if audio.event != nil {
+			w.dtmfPayLoad = int(audio.event.PayloadType)
+		}
+		if audioTrack, err = w.startAudioTrack(session, audio); err != nil {
+			log.Logger.Debugf("StartClient: start audio failed:%v", err)
+			session.Close()
+			return "", err
+		}
+	}
+
+	// 和StopClient互斥: 已经停止时不再启动, 否则StopClient一定能看到session并等发送goroutine结束.
+	senders := 1
+	if audioTrack != nil {
+		senders++
+	}
+	w.m.Lock()
+	if w.stopped() {
+		w.m.Unlock()
+		session.Close()
+		return "", errClientStopped
+	}
+	w.session, w.singleTrack, w.audioTrack = session, videoTrack, audioTrack
+	w.senders.Add(senders)
+	atomic.StoreInt32(&w.isConnected, 1)
+	w.m.Unlock()
+	session.start(w.requestKeyframe)
 
 	// 不断输入的指令在ws接口解决.
 	// add audio rtp connection.
@@ -193,16 +267,53 @@ func (w *RtpUa) StartClient(peerAddr string) (string, error) {
 	//		w.StopClient()
 	//	}
 	//})
-	w.startVideoOrAudioStreaming(true)
+	w.startVideoOrAudioStreaming(videoTrack, true)
+	if audioTrack != nil {
+		w.startVideoOrAudioStreaming(audioTrack, false)
+	}
+	if audioTrack == nil {
+		w.startVoiceReceiving(videoTrack)
+	} else if w.audioDirection.CanRecv() {
+		w.startVoiceReceiving(audioTrack)
+	}
 
-	offer := Sdp{Address: w.cfg.UdpAddr, AudioPayLoad: w.audioPayLoad, VideoPayLoad: w.videoPayLoad}
-	localSession, err := Encode(offer)
+	answer, err := w.answer(offer, video, audio)
 	if err != nil {
-		log.Logger.Debugf("StartClient: Sdp Encode failed:%v", err)
+		log.Logger.Debugf("StartClient: Sdp answer failed:%v", err)
+		w.StopClient()
 		return "", err
 	}
 
-	return localSession, nil
+	return answer, nil
+}
+
+// 音频track, 和视频同一个rtpSession, 按编码绑定打包方式, 每帧时长由Encoder.Audio.Frame决定.
+func (w *RtpUa) startAudioTrack(session *rtpSession, answer *mediaAnswer) (*rtpStream, error) {
+	audio := w.cfg.Encoder.Audio
+	payloader, clockRate := audioPayloader(audio)
+	if clockRate <= 0 {
+		clockRate = 8000
+	}
+	frame := audioFrame(audio)
+
+	binds := rtpengine.SenderBinding{RightAddr: answer.remote, PayloadType: rtpengine.PayloadType(w.audioPayLoad), Payloader: payloader}
+	track, err := session.addStream(binds, clockRate, 1000/frame, false)
+	if err != nil {
+		return nil, err
+	}
+	return track, track.protect(answer)
+}
+
+// OnKeyframeRequest 设置对端请求关键帧时的回调.
+func (w *RtpUa) OnKeyframeRequest(fn func()) {
+	w.keyframeRequest.Store(fn)
+}
+
+func (w *RtpUa) requestKeyframe() {
+	if fn, ok := w.keyframeRequest.Load().(func()); ok && fn != nil {
+		log.Logger.Debugf("RtpUa keyframe requested, id:%s", w.ID)
+		fn()
+	}
 }
 
 // 直接返回h264.
@@ -228,35 +339,83 @@ func (w *RtpUa) GetAudioCodec() string {
 	return w.cfg.Encoder.Audio.Codec
 }
 
+var (
+	errClientStarted = errors.New("rtpua: client already started")
+	errClientStopped = errors.New("rtpua: client stopped")
+)
+
 // StopClient disconnect
-// 手动拆除rtp连接.
+// 手动拆除rtp连接, 可以并发和重复调用, 只执行一次.
+// 不能在发送goroutine里直接调用, 要等它们结束.
 func (w *RtpUa) StopClient() {
-	// if stopped, bypass
-	if !w.isConnected {
-		return
+	w.stopOnce.Do(func() {
+		atomic.StoreInt32(&w.isConnected, 0)
+		close(w.done)
+
+		w.m.Lock()
+		session := w.session
+		w.m.Unlock()
+		if session != nil {
+			if err := session.Close(); err != nil {
+				log.Logger.Errorf("error: couldn't close RtpUa connection, %v", err)
+			}
+		}
+		// 发送goroutine结束后才能清空.
+		w.senders.Wait()
+		w.m.Lock()
+		w.session, w.singleTrack, w.audioTrack = nil, nil, nil
+		w.m.Unlock()
+		// 接收启动过时在接收结束后关闭.
+		w.voiceOnce.Do(w.closeVoice)
+		//close(w.InputChannel)
+		// ImageChannel和AudioChannel有多个写入方, 不关闭, 写入方通过done得知断开.
+		//close(w.VoiceOutChannel)
+		log.Logger.Debug("===StopClient===")
+	})
+}
+
+func (w *RtpUa) stopped() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
 	}
+}
 
-	w.isConnected = false
-	if w.singleTrack != nil {
-		if err := w.singleTrack.Close(); err != nil {
-			log.Logger.Errorf("error: couldn't close RtpUa connection, %v", err)
-		}
+func (w *RtpUa) IsConnected() bool { return atomic.LoadInt32(&w.isConnected) != 0 }
+
+// SendFrame 发送一帧视频, 队列满时阻塞, 断开后返回false.
+func (w *RtpUa) SendFrame(frame WebFrame) bool {
+	select {
+	case <-w.done:
+		return false
+	default:
+	}
+	select {
+	case w.ImageChannel <- frame:
+		return true
+	case <-w.done:
+		return false
 	}
-	w.singleTrack = nil
-	//close(w.InputChannel)
-	// webrtc is producer, so we close
-	// NOTE: ImageChannel is waiting for input. Close in writer is not correct for this
-	close(w.ImageChannel)
-	close(w.AudioChannel)
-	//close(w.VoiceInChannel)
-	//close(w.VoiceOutChannel)
-	log.Logger.Debug("===StopClient===")
 }
 
-func (w *RtpUa) IsConnected() bool { return w.isConnected }
+// SendAudio 发送一帧音频, 队列满或者断开时丢弃.
+func (w *RtpUa) SendAudio(data []byte) {
+	select {
+	case w.AudioChannel <- data:
+	case <-w.done:
+	default:
+	}
+}
 
-// 音视频发送, TODO: 多路复用一个连接.
-func (w *RtpUa) startVideoOrAudioStreaming(isVideo bool) {
+// LastReceived 最后收到对端rtp或rtcp的时间, 还没开始时为零值.
+func (w *RtpUa) LastReceived() time.Time {
+	return w.alive.get()
+}
+
+// 音视频发送, 复用同一个rtpSession, done关闭后结束.
+func (w *RtpUa) startVideoOrAudioStreaming(track *rtpStream, isVideo bool) {
 	log.Logger.Debug("Start streaming")
 	// receive frame buffer
 	if isVideo {
@@ -266,17 +425,27 @@ func (w *RtpUa) startVideoOrAudioStreaming(isVideo bool) {
 					process.DefaultPanicReport.RecoverFromPanic(w.ID, "RtpUa:startStreaming", v)
 				}
 			}()
+			defer w.senders.Done()
 
 			// TODO:为啥channel没传输到?..
-			for data := range w.ImageChannel {
+			for {
+				var data WebFrame
+				select {
+				case <-w.done:
+					return
+				case data = <-w.ImageChannel:
+				}
 				atomic.StoreUint32(&w.globalVideoFrameTimestamp, data.Timestamp)
-				if err := w.singleTrack.WriteSample(media.Sample{Data: data.Data}); err != nil {
-					w.StopClient()
+				if !w.videoDirection.CanSend() {
+					continue // 对端不接收, 只消费.
+				}
+				if err := track.WriteSample(media.Sample{Data: data.Data}); err != nil {
 					log.Logger.Error("WriteSample: Err write sample: ", err)
-					break
-				} else {
-					log.Logger.Debugf("WriteSample done, length: %d", len(data.Data))
+					// StopClient要等本goroutine结束.
+					go w.StopClient()
+					return
 				}
+				log.Logger.Debugf("WriteSample done, length: %d", len(data.Data))
 			}
 		}()
 	} else {
@@ -287,14 +456,20 @@ func (w *RtpUa) startVideoOrAudioStreaming(isVideo bool) {
 					process.DefaultPanicReport.RecoverFromPanic(w.ID, "RtpUa:startStreaming", v)
 				}
 			}()
+			defer w.senders.Done()
 
 			// audioDuration := time.Duration(w.cfg.Encoder.Audio.Frame) * time.Millisecond
-			for data := range w.AudioChannel {
-				if !w.isConnected {
+			for {
+				var data []byte
+				select {
+				case <-w.done:
 					return
+				case data = <-w.AudioChannel:
+				}
+				if !w.audioDirection.CanSend() {
+					continue
 				}
-				err := w.singleTrack.WriteSample(media.Sample{Data: data})
-				if err != nil {
+				if err := track.WriteSample(media.Sample{Data: data}); err != nil {
 					log.Logger.Error("Warn: Err write sample: ", err)
 				}
 			}
@@ -0,0 +1,139 @@
+package rtpua
+
+import (
+	"sync"
+	"testing"
+	"time"
+	"xmediaEmu/pkg/emulator/config"
+	"xmediaEmu/pkg/media/sdp"
+)
+
+// startClient 和回环地址上的对端建立连接, rtcp端口被占用时重试.
+func startClient(t *testing.T) (*RtpUa, *rtpStream) {
+	return startClientWith(t, Config{}, nil)
+}
+
+// startClientWith 同startClient, conf为空的地址和id会被填上, edit在发送前修改offer.
+func startClientWith(t *testing.T, conf Config, edit func(offer *sdp.SessionDescription)) (*RtpUa, *rtpStream) {
+	conf.SessionId, conf.UdpAddr = "test", "127.0.0.1:0"
+	peer := listenUDP(t)
+	var err error
+	for i := 0; i < 5; i++ {
+		w, _ := NewWebRTC(conf, 0, 0)
+		offer, err := w.AddrOffer(peer.LocalAddr().String(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if edit != nil {
+			edit(offer)
+		}
+		if _, err = w.StartClient(offer); err == nil {
+			return w, w.singleTrack
+		}
+	}
+	t.Fatal(err)
+	return nil, nil
+}
+
+// 并发的StopClient只执行一次, 之后发送不阻塞也不panic.
+func TestStopClientConcurrent(t *testing.T) {
+	w, track := startClient(t)
+	if !w.IsConnected() || track == nil {
+		t.Fatal("client not started")
+	}
+	if _, err := w.StartClient(nil); err != errClientStarted {
+		t.Fatalf("restart got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				w.SendFrame(WebFrame{Data: []byte{0, 0, 0, 1, 0x65}})
+				w.SendAudio([]byte{1})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			w.StopClient()
+			_ = w.Stats()
+		}()
+	}
+	wg.Wait()
+
+	if w.IsConnected() || w.Stats().Video.SSRC != 0 {
+		t.Fatal("client not stopped")
+	}
+	done := make(chan bool)
+	go func() { done <- w.SendFrame(WebFrame{}) }()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("send after stop")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("send blocked after stop")
+	}
+	if _, err := w.StartClient(nil); err != errClientStarted {
+		t.Fatalf("start after stop got %v", err)
+	}
+}
+
+// 没有启动过的也可以停止.
+func TestStopClientNotStarted(t *testing.T) {
+	w, _ := NewWebRTC(Config{SessionId: "test"}, 0, 0)
+	w.StopClient()
+	w.StopClient()
+	if w.IsConnected() || w.SendFrame(WebFrame{}) {
+		t.Fatal("stopped client")
+	}
+	waitVoiceClosed(t, w)
+}
+
+// waitVoiceClosed room里range这两个channel的循环要能结束.
+func waitVoiceClosed(t *testing.T, w *RtpUa) {
+	deadline := time.After(time.Second)
+	for _, closed := range []func() bool{
+		func() bool { _, ok := <-w.VoiceInChannel; return !ok },
+		func() bool { _, ok := <-w.DtmfChannel; return !ok },
+	} {
+		done := make(chan bool, 1)
+		go func(closed func() bool) {
+			for !closed() {
+			}
+			done <- true
+		}(closed)
+		select {
+		case <-done:
+		case <-deadline:
+			t.Fatal("voice channels not closed")
+		}
+	}
+}
+
+// 音频不接收(对端recvonly或inactive)时没有启动语音接收, StopClient关闭语音和按键channel.
+func TestStopClientClosesVoice(t *testing.T) {
+	for _, dir := range []sdp.Direction{sdp.RecvOnly, sdp.Inactive, sdp.SendRecv} {
+		conf := Config{}
+		conf.Encoder.Audio = config.AudioConfig{Codec: string(config.G711), Channels: 1, Frame: 20, Frequency: 8000}
+		w, _ := startClientWith(t, conf, func(offer *sdp.SessionDescription) {
+			for _, m := range offer.Media {
+				if m.Type == sdp.MediaAudio {
+					m.Direction = dir
+				}
+			}
+		})
+		w.m.Lock()
+		audio := w.audioTrack
+		w.m.Unlock()
+		if audio == nil || w.audioDirection.CanRecv() != (dir == sdp.SendRecv) {
+			t.Fatalf("%s: audio %v direction %s", dir, audio != nil, w.audioDirection)
+		}
+		w.StopClient()
+		waitVoiceClosed(t, w)
+		// 停止后不再启动接收.
+		w.startVoiceReceiving(audio)
+	}
+}
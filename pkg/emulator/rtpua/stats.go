@@ -0,0 +1,46 @@
+package rtpua
+
+import "time"
+
+// StreamStats 一路rtp的统计, 丢包、抖动和rtt来自对端RR.
+type StreamStats struct {
+	SSRC        uint32
+	PayloadType uint8
+
+	PacketsSent     uint32
+	OctetsSent      uint32
+	PacketsReceived uint32
+	OctetsReceived  uint32
+
+	FractionLost float64 // 0~1, 上个报告周期.
+	PacketsLost  uint32  // 累计.
+	Jitter       time.Duration
+	RTT          time.Duration
+	LastReport   time.Time // 最近一次收到RR的时间.
+
+	PLI uint32 // 对端请求关键帧次数.
+	FIR uint32
+}
+
+// Stats 一个会话的统计, 没有音频时Audio为nil.
+type Stats struct {
+	ID    string
+	Video StreamStats
+	Audio *StreamStats
+}
+
+// Stats returns rtp/rtcp statistics of the session.
+func (w *RtpUa) Stats() Stats {
+	stats := Stats{ID: w.ID}
+	w.m.Lock()
+	video, audio := w.singleTrack, w.audioTrack
+	w.m.Unlock()
+	if video != nil {
+		stats.Video = video.Stats()
+	}
+	if audio != nil {
+		audioStats := audio.Stats()
+		stats.Audio = &audioStats
+	}
+	return stats
+}
@@ -0,0 +1,324 @@
+package rtpua
+
+import (
+	"common/rtpengine"
+	"common/rtpengine/media"
+	"common/rtpengine/rtp"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+	"xmediaEmu/pkg/media/rtcp"
+	"xmediaEmu/pkg/media/srtp"
+)
+
+const (
+	defaultMtu    = 1200
+	rtpHeaderSize = 12
+	incomingSize  = 50
+)
+
+// rtpStream 一路rtp收发, 自己维护ssrc、序号和时间戳, 发送和接收统计给rtcp用.
+// 绑定信息沿用rtpengine.SenderBinding, 连接由rtpSession共用.
+type rtpStream struct {
+	conn    *net.UDPConn
+	media   string // video/audio, 用于metrics.
+	remote  *net.UDPAddr
+	binding rtpengine.SenderBinding
+	mtu     int
+	isVideo bool // 视频每帧最后一个包打marker.
+
+	// srtp, 明文时为nil.
+	srtpTx *srtp.Context
+	srtpRx *srtp.Context
+
+	ssrc      uint32
+	sequence  uint16
+	timestamp uint32
+	clockRate int
+	step      uint32 // 每个sample的时间戳增量.
+
+	mu          sync.Mutex
+	stats       StreamStats
+	lastRtpTime uint32    // 最近一次发送的rtp时间戳.
+	lastSentAt  time.Time // 对应的本地时间, SR里外推rtp时间.
+	recv        receiveStats
+
+	// 对端发来的包, 由rtpSession分发.
+	incoming chan *rtp.Packet
+}
+
+// newRtpStream 时钟clockRate, 每秒frequence个sample.
+func newRtpStream(conn *net.UDPConn, network, media string, binding rtpengine.SenderBinding, clockRate, frequence int, isVideo bool) (*rtpStream, error) {
+	if network == "" {
+		network = "udp"
+	}
+	remote, err := net.ResolveUDPAddr(network, binding.RightAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	mtu := binding.Options.Mtu
+	if mtu <= rtpHeaderSize {
+		mtu = defaultMtu
+	}
+	if frequence <= 0 {
+		frequence = 1
+	}
+	s := &rtpStream{
+		conn:      conn,
+		media:     media,
+		remote:    remote,
+		binding:   binding,
+		mtu:       mtu,
+		isVideo:   isVideo,
+		ssrc:      rand.Uint32(),
+		sequence:  uint16(rand.Uint32()),
+		timestamp: rand.Uint32(),
+		clockRate: clockRate,
+		step:      uint32(clockRate / frequence),
+		incoming:  make(chan *rtp.Packet, incomingSize),
+	}
+	s.stats.SSRC = s.ssrc
+	s.stats.PayloadType = uint8(binding.PayloadType)
+	return s, nil
+}
+
+// WriteSample 按payloader打包发送一帧.
+func (s *rtpStream) WriteSample(sample media.Sample) error {
+	payloads := s.binding.Payloader.Payload(uint16(s.mtu-rtpHeaderSize), sample.Data)
+	for i, payload := range payloads {
+		packet := rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         s.isVideo && i == len(payloads)-1,
+				PayloadType:    uint8(s.binding.PayloadType),
+				SequenceNumber: s.sequence,
+				Timestamp:      s.timestamp,
+				SSRC:           s.ssrc,
+			},
+			Payload: payload,
+		}
+		s.sequence++
+
+		buf, err := packet.Marshal()
+		if err != nil {
+			return err
+		}
+		if s.srtpTx != nil {
+			if buf, err = s.srtpTx.EncryptRTP(buf); err != nil {
+				return err
+			}
+		}
+		if _, err := s.conn.WriteToUDP(buf, s.remote); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.stats.PacketsSent++
+		s.stats.OctetsSent += uint32(len(payload))
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	s.lastRtpTime = s.timestamp
+	s.lastSentAt = time.Now()
+	s.mu.Unlock()
+
+	if sample.Duration > 0 {
+		s.timestamp += uint32(sample.Duration.Seconds() * float64(s.clockRate))
+	} else {
+		s.timestamp += s.step
+	}
+	return nil
+}
+
+// receive 解密并更新接收统计, 上层来不及处理时丢弃.
+func (s *rtpStream) receive(data []byte, arrival time.Time) error {
+	if s.srtpRx != nil {
+		// 认证失败或者重放的丢弃.
+		var err error
+		if data, err = s.srtpRx.DecryptRTP(data); err != nil {
+			return err
+		}
+	}
+	packet := &rtp.Packet{}
+	if err := packet.Unmarshal(data); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.stats.PacketsReceived++
+	s.stats.OctetsReceived += uint32(len(packet.Payload))
+	s.recv.update(packet, arrival, s.clockRate)
+	s.mu.Unlock()
+
+	select {
+	case s.incoming <- packet:
+	default:
+	}
+	return nil
+}
+
+// remoteSSRC 对端发送的ssrc, 还没收到包时返回false.
+func (s *rtpStream) remoteSSRC() (uint32, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recv.ssrc, s.recv.started
+}
+
+// protect 协商了srtp时设置加解密.
+func (s *rtpStream) protect(answer *mediaAnswer) error {
+	tx, rx, err := answer.contexts()
+	if err != nil {
+		return err
+	}
+	s.srtpTx, s.srtpRx = tx, rx
+	return nil
+}
+
+// senderReport 生成SR, rtp时间按本地时间外推, 带上接收方向的报告块.
+func (s *rtpStream) senderReport(now time.Time) *rtcp.SenderReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rtpTime := s.lastRtpTime
+	if !s.lastSentAt.IsZero() {
+		rtpTime += uint32(now.Sub(s.lastSentAt).Seconds() * float64(s.clockRate))
+	}
+	sr := &rtcp.SenderReport{
+		SSRC:        s.ssrc,
+		NTPTime:     rtcp.ToNTP(now),
+		RTPTime:     rtpTime,
+		PacketCount: s.stats.PacketsSent,
+		OctetCount:  s.stats.OctetsSent,
+	}
+	if report, ok := s.recv.report(now); ok {
+		sr.Reports = append(sr.Reports, report)
+	}
+	return sr
+}
+
+// onSenderReport 记录对端SR, 下次RR里回LSR/DLSR.
+func (s *rtpStream) onSenderReport(sr *rtcp.SenderReport, arrival time.Time) {
+	s.mu.Lock()
+	s.recv.lastSR = rtcp.MiddleNTP(sr.NTPTime)
+	s.recv.lastSRAt = arrival
+	s.mu.Unlock()
+}
+
+// onReceptionReport 对端对本端发送流的反馈.
+func (s *rtpStream) onReceptionReport(report rtcp.ReceptionReport, arrival time.Time) {
+	if report.SSRC != s.ssrc {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.FractionLost = float64(report.FractionLost) / 256
+	s.stats.PacketsLost = report.TotalLost
+	if s.clockRate > 0 {
+		s.stats.Jitter = time.Duration(float64(report.Jitter) / float64(s.clockRate) * float64(time.Second))
+	}
+	if rtt, ok := rtcp.RoundTripTime(arrival, report); ok {
+		s.stats.RTT = rtt
+	}
+	s.stats.LastReport = arrival
+}
+
+func (s *rtpStream) Stats() StreamStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// receiveStats 接收方向统计, rfc3550 A.3/A.8.
+type receiveStats struct {
+	ssrc        uint32
+	started     bool
+	baseSeq     uint16
+	maxSeq      uint16
+	cycles      uint32
+	received    uint32
+	expectPrior uint32
+	recvPrior   uint32
+	base        time.Time // 第一个包的到达时间, 到达时间从这里开始换算, 避免溢出.
+	transit     uint32
+	jitter      float64
+	lastSR      uint32
+	lastSRAt    time.Time
+}
+
+func (r *receiveStats) update(packet *rtp.Packet, arrival time.Time, clockRate int) {
+	seq := packet.SequenceNumber
+	if !r.started || packet.SSRC != r.ssrc {
+		*r = receiveStats{ssrc: packet.SSRC, started: true, baseSeq: seq, maxSeq: seq, base: arrival}
+	} else if delta := seq - r.maxSeq; delta < 0x8000 {
+		if seq < r.maxSeq {
+			r.cycles += 1 << 16
+		}
+		r.maxSeq = seq
+	}
+	r.received++
+
+	// 到达时间换算成rtp时钟, 和时间戳一样按32位回绕, rfc3550 A.8.
+	d := arrival.Sub(r.base)
+	units := int64(d/time.Second)*int64(clockRate) + int64(d%time.Second)*int64(clockRate)/int64(time.Second)
+	transit := uint32(units) - packet.Timestamp
+	if r.received > 1 {
+		d := int64(int32(transit - r.transit))
+		if d < 0 {
+			d = -d
+		}
+		r.jitter += (float64(d) - r.jitter) / 16
+	}
+	r.transit = transit
+}
+
+func (r *receiveStats) report(now time.Time) (rtcp.ReceptionReport, bool) {
+	if !r.started {
+		return rtcp.ReceptionReport{}, false
+	}
+	extMax := r.cycles + uint32(r.maxSeq)
+	expected := extMax - uint32(r.baseSeq) + 1
+	lost := int64(expected) - int64(r.received)
+	if lost < 0 {
+		lost = 0
+	}
+
+	expectedInterval := expected - r.expectPrior
+	receivedInterval := r.received - r.recvPrior
+	r.expectPrior, r.recvPrior = expected, r.received
+	var fraction uint8
+	if lostInterval := int64(expectedInterval) - int64(receivedInterval); expectedInterval > 0 && lostInterval > 0 {
+		if f := lostInterval << 8 / int64(expectedInterval); f > 255 {
+			fraction = 255
+		} else {
+			fraction = uint8(f)
+		}
+	}
+
+	report := rtcp.ReceptionReport{
+		SSRC:               r.ssrc,
+		FractionLost:       fraction,
+		TotalLost:          uint32(lost) & 0xffffff,
+		LastSequenceNumber: extMax,
+		Jitter:             uint32(r.jitter),
+		LastSenderReport:   r.lastSR,
+	}
+	if r.lastSR != 0 {
+		report.Delay = uint32(now.Sub(r.lastSRAt).Seconds() * 65536)
+	}
+	return report, true
+}
+
+// onFeedback 统计对端的关键帧请求.
+func (s *rtpStream) onFeedback(pli bool) {
+	s.mu.Lock()
+	if pli {
+		s.stats.PLI++
+	} else {
+		s.stats.FIR++
+	}
+	s.mu.Unlock()
+}
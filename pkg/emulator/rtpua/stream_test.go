@@ -0,0 +1,195 @@
+package rtpua
+
+import (
+	"common/rtpengine"
+	"common/rtpengine/media"
+	"common/rtpengine/rtp"
+	"net"
+	"testing"
+	"time"
+)
+
+// splitPayloader 按mtu切分, 测试用.
+type splitPayloader struct{}
+
+func (splitPayloader) Payload(mtu uint16, payload []byte) [][]byte {
+	var out [][]byte
+	for len(payload) > int(mtu) {
+		out = append(out, payload[:mtu])
+		payload = payload[mtu:]
+	}
+	return append(out, payload)
+}
+
+func listenUDP(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readPacket(t *testing.T, conn *net.UDPConn) *rtp.Packet {
+	buf := make([]byte, rtpBufferSize)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := &rtp.Packet{}
+	if err := packet.Unmarshal(buf[:n]); err != nil {
+		t.Fatal(err)
+	}
+	return packet
+}
+
+func marshalPacket(t *testing.T, ssrc uint32, payloadType uint8, seq uint16, timestamp uint32) []byte {
+	packet := rtp.Packet{Header: rtp.Header{Version: 2, PayloadType: payloadType, SequenceNumber: seq, Timestamp: timestamp, SSRC: ssrc}, Payload: []byte{1, 2, 3, 4}}
+	data, err := packet.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRtpStreamWriteSample(t *testing.T) {
+	peer, local := listenUDP(t), listenUDP(t)
+	binding := rtpengine.SenderBinding{RightAddr: peer.LocalAddr().String(), PayloadType: 96, Payloader: splitPayloader{}}
+	stream, err := newRtpStream(local, "udp", "video", binding, 90000, 30, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.mtu = rtpHeaderSize + 100
+
+	// 一帧分3个包, 序号连续, 时间戳相同, 最后一个打marker.
+	if err := stream.WriteSample(media.Sample{Data: make([]byte, 250)}); err != nil {
+		t.Fatal(err)
+	}
+	var first *rtp.Packet
+	for i, size := range []int{100, 100, 50} {
+		p := readPacket(t, peer)
+		if first == nil {
+			first = p
+		}
+		if len(p.Payload) != size || p.SSRC != stream.ssrc || p.PayloadType != 96 || p.Timestamp != first.Timestamp ||
+			p.SequenceNumber != first.SequenceNumber+uint16(i) || p.Marker != (i == 2) {
+			t.Fatalf("packet %d got %+v", i, p.Header)
+		}
+	}
+
+	// 没有Duration时按帧率前进.
+	if err := stream.WriteSample(media.Sample{Data: make([]byte, 10)}); err != nil {
+		t.Fatal(err)
+	}
+	p := readPacket(t, peer)
+	if p.Timestamp != first.Timestamp+3000 || p.SequenceNumber != first.SequenceNumber+3 || !p.Marker {
+		t.Fatalf("second frame got %+v", p.Header)
+	}
+
+	stats := stream.Stats()
+	if stats.PacketsSent != 4 || stats.OctetsSent != 260 || stats.SSRC != stream.ssrc {
+		t.Fatalf("stats %+v", stats)
+	}
+	sr := stream.senderReport(time.Now())
+	if sr.SSRC != stream.ssrc || sr.PacketCount != 4 || sr.OctetCount != 260 || len(sr.Reports) != 0 {
+		t.Fatalf("sr %+v", sr)
+	}
+}
+
+func TestRtpStreamDuration(t *testing.T) {
+	peer, local := listenUDP(t), listenUDP(t)
+	binding := rtpengine.SenderBinding{RightAddr: peer.LocalAddr().String(), PayloadType: 0, Payloader: splitPayloader{}}
+	stream, err := newRtpStream(local, "udp", "audio", binding, 8000, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := stream.WriteSample(media.Sample{Data: make([]byte, 160), Duration: 40 * time.Millisecond}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := readPacket(t, peer), readPacket(t, peer)
+	if b.Timestamp-a.Timestamp != 320 || a.Marker || b.Marker {
+		t.Fatalf("got %+v %+v", a.Header, b.Header)
+	}
+}
+
+func TestRtpStreamReceive(t *testing.T) {
+	binding := rtpengine.SenderBinding{RightAddr: "127.0.0.1:9", PayloadType: 0, Payloader: splitPayloader{}}
+	stream, err := newRtpStream(nil, "udp", "audio", binding, 8000, 50, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stream.remoteSSRC(); ok {
+		t.Fatal("no packet received yet")
+	}
+
+	// 12丢失.
+	now := time.Now()
+	for i, seq := range []uint16{10, 11, 13} {
+		if err := stream.receive(marshalPacket(t, 0x1234, 0, seq, uint32(seq)*160), now.Add(time.Duration(i)*20*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+		if p := <-stream.incoming; p.SequenceNumber != seq {
+			t.Fatalf("incoming got %d", p.SequenceNumber)
+		}
+	}
+	if ssrc, ok := stream.remoteSSRC(); !ok || ssrc != 0x1234 {
+		t.Fatalf("remote ssrc %x", ssrc)
+	}
+	if stats := stream.Stats(); stats.PacketsReceived != 3 || stats.OctetsReceived != 12 {
+		t.Fatalf("stats %+v", stats)
+	}
+
+	report, ok := stream.recv.report(now)
+	if !ok || report.SSRC != 0x1234 || report.TotalLost != 1 || report.LastSequenceNumber != 13 || report.FractionLost != 64 {
+		t.Fatalf("report %+v", report)
+	}
+	// 上个周期以来没有丢包.
+	if report, _ := stream.recv.report(now); report.FractionLost != 0 || report.TotalLost != 1 {
+		t.Fatalf("second report %+v", report)
+	}
+	if err := stream.receive([]byte{0x80}, now); err == nil {
+		t.Fatal("short packet should fail")
+	}
+}
+
+func TestReceiveStatsWrap(t *testing.T) {
+	var r receiveStats
+	now := time.Now()
+	for _, seq := range []uint16{65534, 65535, 0, 1} {
+		r.update(&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: seq}}, now, 8000)
+	}
+	report, _ := r.report(now)
+	if report.LastSequenceNumber != 1<<16+1 || report.TotalLost != 0 {
+		t.Fatalf("report %+v", report)
+	}
+}
+
+// 按墙上时间到达, 间隔和时间戳一致时jitter为0, 一个包晚到10ms后为80/16.
+func TestReceiveStatsJitter(t *testing.T) {
+	for _, clockRate := range []int{8000, 90000} {
+		var r receiveStats
+		step := uint32(clockRate / 50)
+		start := time.Now()
+		// 时间戳从回绕前开始.
+		ts := 0 - 3*step
+		for i := 0; i < 200; i++ {
+			packet := &rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: uint16(i), Timestamp: ts + uint32(i)*step}}
+			r.update(packet, start.Add(time.Duration(i)*20*time.Millisecond), clockRate)
+		}
+		if r.jitter != 0 {
+			t.Fatalf("clock %d: paced jitter %v", clockRate, r.jitter)
+		}
+
+		late := &rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 200, Timestamp: ts + 200*step}}
+		r.update(late, start.Add(200*20*time.Millisecond+10*time.Millisecond), clockRate)
+		if want := float64(clockRate/100) / 16; r.jitter != want {
+			t.Fatalf("clock %d: jitter %v, want %v", clockRate, r.jitter, want)
+		}
+		if report, _ := r.report(time.Now()); report.Jitter != uint32(r.jitter) {
+			t.Fatalf("clock %d: report %+v", clockRate, report)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package rtpua
+
+import (
+	"common/util/process"
+	"time"
+	"xmediaEmu/pkg/audio/g711"
+	"xmediaEmu/pkg/emulator/config"
+	"xmediaEmu/pkg/log"
+	"xmediaEmu/pkg/media/dtmf"
+	"xmediaEmu/pkg/media/jitter"
+)
+
+const rtpBufferSize = 1500
+
+// VoiceFrame 对端发来的语音, 解码后的16bit小端pcm.
+type VoiceFrame struct {
+	Data       []byte
+	SampleRate int
+	Timestamp  uint32
+}
+
+// voiceDecoder 根据负载类型解码, 不支持的返回nil.
+func (w *RtpUa) voiceDecoder(payloadType uint8) (func([]byte) []byte, int) {
+	switch int(payloadType) {
+	case pcmuPayload:
+		return g711.Ulaw.Decode, 8000
+	case pcmaPayload:
+		return g711.Alaw.Decode, 8000
+	case w.audioPayLoad:
+		audio := w.cfg.Encoder.Audio
+		switch config.AudioCodec(audio.Codec) {
+		case config.G711:
+			return g711.Ulaw.Decode, 8000
+		case config.G711A:
+			return g711.Alaw.Decode, 8000
+		case config.PCM:
+			frequency := audio.Frequency
+			if frequency <= 0 {
+				frequency = 8000
+			}
+			return decodeL16, frequency
+		}
+	}
+	return nil, 0
+}
+
+// L16 网络字节序转小端.
+func decodeL16(payload []byte) []byte {
+	pcm := make([]byte, len(payload)&^1)
+	for i := 0; i < len(pcm); i += 2 {
+		pcm[i], pcm[i+1] = payload[i+1], payload[i]
+	}
+	return pcm
+}
+
+// startVoiceReceiving 接收rtpSession分发到track(音频流, 没有则视频流)的rtp, 解码后经过jitter buffer按帧写入VoiceInChannel.
+// StopClient之后不再启动.
+func (w *RtpUa) startVoiceReceiving(track *rtpStream) {
+	w.voiceOnce.Do(func() {
+		w.receiveVoice(track)
+	})
+}
+
+// closeVoice 通知room的语音和按键循环结束.
+func (w *RtpUa) closeVoice() {
+	close(w.VoiceInChannel)
+	close(w.DtmfChannel)
+}
+
+func (w *RtpUa) receiveVoice(track *rtpStream) {
+	// 按协商的音频编码确定采样率, 不能解码时按g711.
+	_, sampleRate := w.voiceDecoder(uint8(w.audioPayLoad))
+	if sampleRate <= 0 {
+		sampleRate = 8000
+	}
+	frame := time.Duration(audioFrame(w.cfg.Encoder.Audio)) * time.Millisecond
+	buffer := jitter.New(jitter.Config{SampleRate: sampleRate, Frame: frame})
+	var detector *dtmf.Detector
+	if w.cfg.InbandDtmf {
+		detector = dtmf.NewDetector(sampleRate)
+	}
+	done := make(chan struct{})
+
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				process.DefaultPanicReport.RecoverFromPanic(w.ID, "RtpUa:startVoiceReceiving", v)
+			}
+		}()
+		defer close(done)
+
+		var receiver dtmf.Receiver
+		// 会话关闭时incoming被关闭.
+		for packet := range track.incoming {
+			if w.dtmfPayLoad != 0 && int(packet.PayloadType) == w.dtmfPayLoad {
+				if digit, ok := receiver.Push(packet.Timestamp, packet.Payload); ok {
+					w.sendDtmf(digit)
+				}
+				continue
+			}
+			// 舒适噪声、dtmf等其他负载忽略, 采样率不同的也丢弃.
+			decode, rate := w.voiceDecoder(packet.PayloadType)
+			if decode == nil || rate != sampleRate {
+				continue
+			}
+			buffer.Push(packet.SequenceNumber, packet.Timestamp, decode(packet.Payload), time.Now())
+		}
+	}()
+
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				process.DefaultPanicReport.RecoverFromPanic(w.ID, "RtpUa:voicePlayout", v)
+			}
+		}()
+		defer w.closeVoice()
+
+		t := time.NewTicker(frame)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				log.Logger.Debugf("RtpUa voice jitter buffer, id:%s stats:%+v", w.ID, buffer.Stats())
+				return
+			case <-t.C:
+				f, ok := buffer.Pop()
+				if !ok {
+					continue
+				}
+				if detector != nil && f.Kind == jitter.Normal {
+					for _, digit := range detector.Process(f.PCM) {
+						w.sendDtmf(digit)
+					}
+				}
+				select {
+				case w.VoiceInChannel <- VoiceFrame{Data: f.PCM, SampleRate: sampleRate, Timestamp: f.Timestamp}:
+				default:
+				}
+			}
+		}
+	}()
+}
+
+// sendDtmf 来不及处理的按键丢弃.
+func (w *RtpUa) sendDtmf(digit rune) {
+	log.Logger.Debugf("RtpUa dtmf %c, id:%s", digit, w.ID)
+	select {
+	case w.DtmfChannel <- digit:
+	default:
+	}
+}
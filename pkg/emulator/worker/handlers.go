@@ -2,13 +2,18 @@ package worker
 
 import (
 	"common/web"
-	"fmt"
+	"errors"
 	"github.com/gorilla/websocket"
+	"sort"
+	"time"
+	appconfig "xmediaEmu/pkg/config"
 	"xmediaEmu/pkg/cws"
 	"xmediaEmu/pkg/cws/entity"
 	"xmediaEmu/pkg/emulator/config"
+	"xmediaEmu/pkg/emulator/libretro/games"
 	"xmediaEmu/pkg/emulator/rtpua"
 	"xmediaEmu/pkg/log"
+	"xmediaEmu/pkg/media/sdp"
 )
 
 // one server for all users.
@@ -24,20 +29,32 @@ type Handler struct {
 	// global ID of the current server
 	// serverID string
 
-	// sessions handles all sessions server is handler (key is sessionID)
-	sessions map[string]*Session //保留map实例常量.
-	// Rooms map : RoomID -> Room
-	rooms map[string]*Room //支持启动多个room
+	// sessions and rooms, 支持启动多个room.
+	registry *registry
+
+	// 注册的命令和hello协商的协议版本, 没有协商时为0, 按版本1处理.
+	commands map[string]command
+	version  int32
 }
 
 // 支持ws复用，gin 框架.
 // ws的命令server只要一个通道即可.
+// 没有配置超时时取AppConf.Timeout.
 func NewHandler(conf config.Config, conn *websocket.Conn) *Handler {
+	timeout := appconfig.AppConf.Timeout
+	if conf.Timeout.NoMedia == 0 {
+		conf.Timeout.NoMedia = time.Duration(timeout.T1) * time.Second
+	}
+	if conf.Timeout.MaxCall == 0 {
+		conf.Timeout.MaxCall = time.Duration(timeout.T2) * time.Second
+	}
+	if conf.Timeout.RoomIdle == 0 {
+		conf.Timeout.RoomIdle = time.Duration(timeout.TRoomIdle) * time.Second
+	}
 	return &Handler{
 		wsConn:   conn,
 		cfg:      conf,
-		rooms:    map[string]*Room{},
-		sessions: map[string]*Session{},
+		registry: newRegistry(),
 	}
 }
 
@@ -51,136 +68,240 @@ func (h *Handler) Run(serverId string) {
 	h.oClient.Listen()
 }
 
-// 根据roomId创建room，如果之前有room则直接返回EmptyPacket.
+// 根据roomId创建room，如果之前有room则加入.
 // client端收到响应后需要绑定对应ip和端口.
-func (h *Handler) handleRoomStart() cws.PacketHandler {
-	return func(resp cws.WSPacket) (req cws.WSPacket) {
+// 同一个SessionID重复的start返回第一次的结果.
+func (h *Handler) handleRoomStart() commandHandler {
+	return func(resp cws.WSPacket, call entity.Command) (req cws.WSPacket) {
 		log.Logger.Info("Received a start request from coordinator")
-		// TODO: Standardize for all types of packet. Make WSPacket generic
-		rom := entity.RoomStartCall{}
-		if err := rom.From(resp.Data); err != nil {
-			return cws.EmptyPacket
+		rom := call.(*entity.RoomStartCall)
+		// 新建room时游戏必须已经注册, 加入已有的room时不检查.
+		if room := h.getRoom(resp.RoomID); (room == nil || !room.Running()) && !games.Registered(rom.Name) {
+			log.Logger.Errorf("error: unknown game %q, registered:%v", rom.Name, games.Names())
+			return cws.ErrorPacket(entity.RoomStarted, cws.CodeNotFound, "unknown game %q", rom.Name)
 		}
 
-		session := h.getSession(resp.SessionID)
-		if session != nil {
-			log.Logger.Errorf("error: session already exist with id: %s", resp.SessionID)
-			return cws.EmptyPacket
+		session, created := h.registry.reserveSession(resp.SessionID)
+		if !created {
+			log.Logger.Infof("session already exist with id: %s, wait for the first start", resp.SessionID)
+			<-session.ready
+			if session.answer == "" {
+				req = cws.WSPacket{ID: entity.RoomStarted, Error: session.startErr}
+				if req.Error == nil {
+					req.Error = cws.NewPacketError(cws.CodeInternal, "session start failed")
+				}
+				return req
+			}
+			return h.startedPacket(resp, session)
 		}
 
+		defer func() {
+			if req.Error != nil {
+				session.startErr = req.Error
+				h.registry.removeSession(session.ID)
+			}
+			close(session.ready)
+		}()
+
 		// 创建 session.
-		if session = h.newSession(resp.SessionID, &rom); session == nil {
-			log.Logger.Errorf("error: no session with id: %s", resp.SessionID)
-			return cws.EmptyPacket
+		if err := h.newSession(session, rom); err != nil {
+			log.Logger.Errorf("error: new session failed: %v, id: %s", err, resp.SessionID)
+			code := cws.CodeInternal
+			if errors.Is(err, ErrInsufficientCapacity) {
+				code = cws.CodeUnavailable
+			}
+			return cws.ErrorPacket(entity.RoomStarted, code, "new session failed: %v", err)
 		}
 
-		sdpAnswer, err := session.peerconnection.StartClient(rom.Addr)
+		offer, err := startCallOffer(session.peerconnection, rom)
+		if err != nil {
+			log.Logger.Errorf("error: invalid offer: %v, sdp:%q addr:%s", err, rom.Sdp, rom.Addr)
+			session.Close()
+			return cws.ErrorPacket(entity.RoomStarted, cws.CodeBadRequest, "invalid offer: %v", err)
+		}
+		sdpAnswer, err := session.peerconnection.StartClient(offer)
 		if err != nil {
 			log.Logger.Errorf("error: StartClient failed: %v, peer:%s", err, rom.Addr)
-			return cws.EmptyPacket
+			session.Close()
+			code := cws.CodeInternal
+			if errors.Is(err, sdp.ErrNoCodecs) {
+				code = cws.CodeNotAcceptable
+			}
+			return cws.ErrorPacket(entity.RoomStarted, code, "start client failed: %v", err)
 		}
 
 		// game := games.GameMetadata{Name: rom.Name, Type: rom.Type, Base: rom.Base, Path: rom.Path}
-		room := h.startGameHandler(rom.Name, h.cfg.Encoder.BUseUnixSocket, resp.RoomID, 0, session.peerconnection) // playerIndex暂时不用，多方通话时再填上.
-		session.room = room
-		// TODO: can data race (and it does)
-		h.rooms[room.ID] = room
-		rsp := entity.RoomStartRsp{RoomId: room.ID, Sdp: sdpAnswer}
-		data, _ := rsp.To()
-		return cws.WSPacket{ID: entity.RoomStarted, RoomID: room.ID, SessionID: resp.SessionID, PacketID: req.PacketID, Data: data}
+		h.startGameHandler(rom.Name, gameParams(rom), h.cfg.Encoder.BUseUnixSocket, resp.RoomID, 0, session) // playerIndex暂时不用，多方通话时再填上.
+		session.answer = sdpAnswer
+		h.watchSession(session)
+		return h.startedPacket(resp, session)
 	}
 }
 
+func (h *Handler) startedPacket(resp cws.WSPacket, session *Session) cws.WSPacket {
+	var roomID string
+	if room := h.registry.roomOf(session.ID); room != nil {
+		roomID = room.ID
+	}
+	rsp := entity.RoomStartRsp{RoomId: roomID, Sdp: session.answer}
+	data, _ := rsp.To()
+	return cws.WSPacket{ID: entity.RoomStarted, RoomID: roomID, SessionID: resp.SessionID, PacketID: resp.PacketID, Data: data}
+}
+
+// gameParams 请求里创建游戏的参数.
+func gameParams(rom *entity.RoomStartCall) games.Params {
+	return games.Params{Url: rom.Url, Dir: rom.Dir, Text: rom.Text, Extra: rom.Params}
+}
+
+// startCallOffer 优先用请求里的sdp, 没有时按地址构造.
+func startCallOffer(pc *rtpua.RtpUa, rom *entity.RoomStartCall) (*sdp.SessionDescription, error) {
+	if rom.Sdp != "" {
+		return sdp.Parse(rom.Sdp)
+	}
+	return pc.AddrOffer(rom.Addr, rom.AudioAddr)
+}
+
 // 退出房间.
-func (h *Handler) handleRoomQuit() cws.PacketHandler {
-	return func(resp cws.WSPacket) (req cws.WSPacket) {
+// 拆除session, 最后一个离开时关闭room.
+func (h *Handler) handleRoomQuit() commandHandler {
+	return func(resp cws.WSPacket, call entity.Command) (req cws.WSPacket) {
 		log.Logger.Info("Received a quit request from client")
 		session := h.getSession(resp.SessionID)
-
-		if session != nil {
-			room := h.getRoom(session.ID)
-			// Defensive coding, check if the peerconnection is in room
-			if room.IsPCInRoom(session.peerconnection) {
-				h.detachPeerConn(session.peerconnection)
-			}
-		} else {
+		if session == nil {
 			log.Logger.Warnf("Error: No session for ID: %s\n", resp.SessionID)
+			return cws.ErrorPacket(entity.RoomQuit, cws.CodeNotFound, "session %s not found", resp.SessionID)
 		}
 
+		// 还在启动的等启动完成.
+		<-session.ready
+		h.closeSession(resp.SessionID)
 		return cws.EmptyPacket
 	}
 }
 
-// TODO: 实例循环利用，不要临时创建.
-func (h *Handler) newSession(sessionId string, startCall *entity.RoomStartCall) *Session {
-	// rptua初始化.
-	// one port for both audio and video.
-	portSuit, err := GetPortSuiteHelper().AllotPort()
-	if err != nil {
-		log.Logger.Errorf("error: AllotPort failed: %v", err)
-		return nil
+// room状态查询和控制, 响应为RoomInfo.
+func (h *Handler) handleGetRoom() commandHandler {
+	return func(resp cws.WSPacket, call entity.Command) (req cws.WSPacket) {
+		return h.roomReply(entity.GetRoom, call.(*entity.RoomCall).RoomId, nil)
 	}
-	udpAddr := fmt.Sprintf("%s:%d", h.cfg.LocalMediaIp, portSuit.PortRtp)
-	peerConnection, err := rtpua.NewWebRTC(rtpua.Config{Encoder: h.cfg.Encoder, NetWork: startCall.Zone, UdpAddr: udpAddr, SessionId: sessionId}, startCall.AudioPayloadType, startCall.VideoPayloadType)
-	if err != nil {
-		log.Logger.Errorf("error: rtpua.NewWebRTC failed: %v", err)
-		return nil
+}
+
+func (h *Handler) handlePauseRoom() commandHandler {
+	return func(resp cws.WSPacket, call entity.Command) (req cws.WSPacket) {
+		return h.roomReply(entity.PauseRoom, call.(*entity.RoomCall).RoomId, (*Room).Pause)
+	}
+}
+
+func (h *Handler) handleResumeRoom() commandHandler {
+	return func(resp cws.WSPacket, call entity.Command) (req cws.WSPacket) {
+		return h.roomReply(entity.ResumeRoom, call.(*entity.RoomCall).RoomId, (*Room).Resume)
 	}
+}
 
-	session := &Session{}
-	session.peerconnection = peerConnection
-	session.ID = sessionId
-	return session
+func (h *Handler) handleKeyframe() commandHandler {
+	return func(resp cws.WSPacket, call entity.Command) (req cws.WSPacket) {
+		return h.roomReply(entity.Keyframe, call.(*entity.RoomCall).RoomId, (*Room).requestKeyframe)
+	}
 }
 
-// getRoom returns session from sessionID
-func (h *Handler) getSession(sessionID string) *Session {
-	session, ok := h.sessions[sessionID]
-	if !ok {
-		return nil
+// 分辨率在下一帧生效, 响应里还是当前的分辨率.
+func (h *Handler) handleResolution() commandHandler {
+	return func(resp cws.WSPacket, call entity.Command) (req cws.WSPacket) {
+		c := call.(*entity.ResolutionCall)
+		return h.roomReply(entity.Resolution, c.RoomId, func(room *Room) {
+			room.SetResolution(c.Width, c.Height)
+		})
 	}
+}
 
-	return session
+func (h *Handler) handleListRooms() commandHandler {
+	return func(resp cws.WSPacket, call entity.Command) (req cws.WSPacket) {
+		rsp := entity.RoomListRsp{Rooms: []entity.RoomInfo{}}
+		for _, room := range h.registry.roomList() {
+			if room.Running() {
+				rsp.Rooms = append(rsp.Rooms, h.roomInfo(room))
+			}
+		}
+		data, _ := rsp.To()
+		return cws.WSPacket{ID: entity.ListRooms, Data: data}
+	}
 }
 
-func (h *Handler) getRoom(roomID string) (r *Room) {
-	r, ok := h.rooms[roomID]
-	if !ok {
-		return nil
+// roomReply 对运行中的room执行f后返回状态, room不存在或已关闭时返回错误.
+func (h *Handler) roomReply(id, roomID string, f func(room *Room)) cws.WSPacket {
+	room := h.getRoom(roomID)
+	if room == nil || !room.Running() {
+		return cws.ErrorPacket(id, cws.CodeNotFound, "room %s not found", roomID)
+	}
+	if f != nil {
+		f(room)
 	}
-	return
+	info := h.roomInfo(room)
+	data, _ := info.To()
+	return cws.WSPacket{ID: id, RoomID: room.ID, Data: data}
 }
 
-// detachRoom detach room from Handler
-func (h *Handler) detachRoom(roomID string) {
-	delete(h.rooms, roomID)
+func (h *Handler) roomInfo(room *Room) entity.RoomInfo {
+	sessions := []string{}
+	for _, s := range h.registry.sessionsOf(room.ID) {
+		sessions = append(sessions, s.ID)
+	}
+	sort.Strings(sessions)
+	width, height := room.Resolution()
+	return entity.RoomInfo{RoomId: room.ID, Game: room.game, Sessions: sessions, Paused: room.Paused(), Width: width, Height: height}
 }
 
-// createNewRoom creates a new room
-// Return nil in case of room is existed
-func (h *Handler) createNewRoom(game string, bUseUnixSocket bool, roomID string) *Room {
-	// If the roomID doesn't have any running sessions (room was closed)
-	// we spawn a new room
-	if !h.isRoomBusy(roomID) {
-		newRoom := NewRoom(roomID, game, bUseUnixSocket, h.cfg)
-		// TODO: Might have race condition (and it has (:)
-		h.rooms[newRoom.ID] = newRoom
-		return newRoom
+// closeSession 从registry删除并释放, 并发调用时只有一次生效.
+func (h *Handler) closeSession(sessionID string) {
+	session, room, empty := h.registry.removeSession(sessionID)
+	if session == nil {
+		return
+	}
+	if room != nil {
+		h.leaveRoom(room, session.peerconnection, empty)
 	}
+	session.Close()
+}
+
+// TODO: 实例循环利用，不要临时创建.
+func (h *Handler) newSession(session *Session, startCall *entity.RoomStartCall) error {
+	// rptua初始化.
+	// video和audio复用一个端口.
+	portSuit, err := GetPortSuiteHelper().AllotPort(session.ID)
+	if err != nil {
+		return err
+	}
+	session.port = portSuit
+	conf := rtpua.Config{Encoder: h.cfg.Encoder, NetWork: startCall.Zone, SessionId: session.ID, SrtpRequired: h.cfg.SrtpRequired, InbandDtmf: h.cfg.InbandDtmf}
+	conf.UdpAddr = portSuit.RtpAddr(h.cfg.LocalMediaIp)
+
+	peerConnection, err := rtpua.NewWebRTC(conf, startCall.AudioPayloadType, startCall.VideoPayloadType)
+	if err != nil {
+		session.releasePort()
+		return err
+	}
+
+	session.peerconnection = peerConnection
 	return nil
 }
 
-// isRoomBusy check if there is any running sessions.
-// TODO: If we remove sessions from room anytime a session is closed,
-// we can check if the sessions list is empty or not.
-func (h *Handler) isRoomBusy(roomID string) bool {
+// getSession returns session from sessionID
+func (h *Handler) getSession(sessionID string) *Session {
+	return h.registry.session(sessionID)
+}
+
+func (h *Handler) getRoom(roomID string) *Room {
+	return h.registry.room(roomID)
+}
+
+// createNewRoom returns the running room of roomID and attaches session to it, creates one if not exist.
+// 第二个返回值表示是否新建.
+func (h *Handler) createNewRoom(game string, params games.Params, bUseUnixSocket bool, roomID string, session *Session) (*Room, bool) {
 	if roomID == "" {
-		return false
-	}
-	// If no roomID is registered
-	r, ok := h.rooms[roomID]
-	if !ok {
-		return false
+		roomID = GenerateRoomID(game)
 	}
-	return r.IsRunningSessions()
+	params.Report = h.gameReporter(roomID)
+	return h.registry.join(session, roomID, func() *Room {
+		return NewRoom(roomID, game, params, bUseUnixSocket, h.cfg)
+	})
 }
@@ -1,39 +1,46 @@
 package worker
 
 import (
+	"common/util/process"
+	"time"
+	"xmediaEmu/pkg/cws"
 	"xmediaEmu/pkg/cws/entity"
+	"xmediaEmu/pkg/emulator/libretro/games"
 	"xmediaEmu/pkg/emulator/rtpua"
 	"xmediaEmu/pkg/log"
 )
 
 // startGameHandler starts a game if roomID is given, if not create new room
-func (h *Handler) startGameHandler(gameName string, bUseUnixSocket bool, existedRoomID string, playerIndex int, peerconnection *rtpua.RtpUa) *Room {
+func (h *Handler) startGameHandler(gameName string, params games.Params, bUseUnixSocket bool, existedRoomID string, playerIndex int, session *Session) *Room {
 	log.Logger.Infof("Loading game: %v\n", gameName)
+	peerconnection := session.peerconnection
 	// If we are connecting to coordinator, request corresponding serverID based on roomID
 	// TODO: check if existedRoomID is in the current server
-	room := h.getRoom(existedRoomID)
+	// 已经在其他room时先离开.
+	if old := h.registry.roomOf(session.ID); old != nil && old.ID != existedRoomID {
+		h.detachPeerConn(session)
+	}
+	room, created := h.createNewRoom(gameName, params, bUseUnixSocket, existedRoomID, session)
 	// If room is not running
-	if room == nil {
-		log.Logger.Info("Got Room from local ", room, " ID: ", existedRoomID)
+	if created {
+		log.Logger.Info("Created room ID: ", room.ID)
 		// Create new room and update player index
-		room = h.createNewRoom(gameName, bUseUnixSocket, existedRoomID)
 		room.UpdatePlayerIndex(peerconnection, playerIndex)
 
 		// Wait for done signal from room
 		go func() {
 			// room没有client时关闭，通知client端关闭了.
 			<-room.Done
-			h.detachRoom(room.ID)
+			h.registry.removeRoom(room)
 			// send signal to coordinator that the room is closed, then client will remove that room
 			// no session left, remove it.
-			h.oClient.Send(entity.CloseRoomPacket(room.ID), nil)
+			h.send(entity.CloseRoomPacket(room.ID, "", room.CloseReason()))
 		}()
 	}
 
-	// Attach peerconnection to room. If PC is already in room, don't detach
+	// Attach peerconnection to room. If PC is already in room, don't add again
 	log.Logger.Infof("startGameHandler Is PC in room:%v", room.IsPCInRoom(peerconnection))
 	if !room.IsPCInRoom(peerconnection) {
-		h.detachPeerConn(peerconnection)
 		room.AddConnectionToRoom(peerconnection)
 	}
 
@@ -47,17 +54,113 @@ func (h *Handler) startGameHandler(gameName string, bUseUnixSocket bool, existed
 }
 
 // detachPeerConn detaches a peerconnection from the current room.
-func (h *Handler) detachPeerConn(pc *rtpua.RtpUa) {
-	log.Logger.Info("[worker] closing peer connection")
-	gameRoom := h.getRoom(pc.RoomID)
-	if gameRoom == nil || gameRoom.IsEmpty() {
+func (h *Handler) detachPeerConn(session *Session) {
+	gameRoom, empty := h.registry.detach(session)
+	if gameRoom == nil {
 		return
 	}
+	h.leaveRoom(gameRoom, session.peerconnection, empty)
+}
+
+// leaveRoom 从room里移除, 最后一个离开时room空闲RoomIdle后关闭.
+func (h *Handler) leaveRoom(gameRoom *Room, pc *rtpua.RtpUa, empty bool) {
+	log.Logger.Info("[worker] closing peer connection")
 	gameRoom.RemoveSession(pc)
-	if gameRoom.IsEmpty() {
-		log.Logger.Info("[worker] closing an empty room")
-		gameRoom.Close()
+	if empty {
 		pc.InputChannel <- []byte{0xFF, 0xFF}
 		close(pc.InputChannel)
+		h.closeIdleRoom(gameRoom)
+	}
+}
+
+// closeIdleRoom 空闲期间有session加入时不关闭.
+func (h *Handler) closeIdleRoom(gameRoom *Room) {
+	idle := h.cfg.Timeout.RoomIdle
+	if idle <= 0 {
+		if h.registry.removeIdleRoom(gameRoom) {
+			log.Logger.Info("[worker] closing an empty room")
+			gameRoom.Close()
+		}
+		return
+	}
+	time.AfterFunc(idle, func() {
+		if h.registry.removeIdleRoom(gameRoom) {
+			log.Logger.Infof("[worker] closing an idle room: %s", gameRoom.ID)
+			gameRoom.CloseWithReason(entity.CloseReasonIdle)
+		}
+	})
+}
+
+// watchSession 对端超过NoMedia没有rtp/rtcp, 或者通话超过MaxCall时拆除session.
+func (h *Handler) watchSession(session *Session) {
+	timeout := h.cfg.Timeout
+	if timeout.NoMedia <= 0 && timeout.MaxCall <= 0 {
+		return
+	}
+	interval := time.Second
+	for _, d := range []time.Duration{timeout.NoMedia, timeout.MaxCall} {
+		if d > 0 && d/4 < interval {
+			interval = d / 4
+		}
+	}
+
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				process.DefaultPanicReport.RecoverFromPanic(session.ID, "Handler:watchSession", v)
+			}
+		}()
+
+		start := time.Now()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-session.done:
+				return
+			case now := <-t.C:
+				reason := ""
+				if timeout.NoMedia > 0 && now.Sub(session.peerconnection.LastReceived()) > timeout.NoMedia {
+					reason = entity.CloseReasonNoMedia
+				} else if timeout.MaxCall > 0 && now.Sub(start) > timeout.MaxCall {
+					reason = entity.CloseReasonMaxCall
+				}
+				if reason != "" {
+					h.expireSession(session, reason)
+					return
+				}
+			}
+		}
+	}()
+}
+
+// expireSession 超时拆除session并通知coordinator.
+func (h *Handler) expireSession(session *Session, reason string) {
+	var roomID string
+	if room := h.registry.roomOf(session.ID); room != nil {
+		roomID = room.ID
+	}
+	log.Logger.Warnf("[worker] session timeout: %s, id:%s room:%s", reason, session.ID, roomID)
+
+	h.detachPeerConn(session)
+	h.closeSession(session.ID)
+	h.send(entity.CloseRoomPacket(roomID, session.ID, reason))
+}
+
+// send 没有连接coordinator时忽略.
+func (h *Handler) send(packet cws.WSPacket) {
+	if h.oClient != nil {
+		h.oClient.Send(packet, nil)
+	}
+}
+
+// gameReporter 游戏上报的事件通过game_event转发给coordinator, 协议版本2才支持.
+func (h *Handler) gameReporter(roomID string) games.Reporter {
+	return func(event string, data interface{}) {
+		log.Logger.Infof("room %s game event %s: %+v", roomID, event, data)
+		if h.protocolVersion() < 2 {
+			return
+		}
+		h.send(entity.GameEventPacket(roomID, event, data))
 	}
 }
@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"xmediaEmu/pkg/emulator/config"
+	"xmediaEmu/pkg/emulator/libretro"
+	"xmediaEmu/pkg/emulator/rtpua"
+	"xmediaEmu/pkg/inpututil"
+)
+
+// closableRoom 可以Close的room, 不启动游戏.
+func closableRoom(id string) *Room {
+	inputChannel := make(chan libretro.InputEvent, 1)
+	director, _, _ := libretro.New(id, true, inputChannel, libretro.NewUserInterface(inpututil.NewInputMgr()))
+	return &Room{ID: id, IsRunning: true, Done: make(chan struct{}), inputChannel: inputChannel, director: director}
+}
+
+func TestSessionNoMediaTimeout(t *testing.T) {
+	h := &Handler{registry: newRegistry(), cfg: config.Config{Timeout: config.TimeoutConfig{NoMedia: 20 * time.Millisecond}}}
+	session, _ := h.registry.reserveSession("s1")
+	pc, err := rtpua.NewWebRTC(rtpua.Config{SessionId: session.ID}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.peerconnection = pc
+	room, _ := h.registry.join(session, "r1", func() *Room { return closableRoom("r1") })
+	close(session.ready)
+
+	// 没有收到过rtp.
+	h.watchSession(session)
+	select {
+	case <-session.done:
+	case <-time.After(time.Second):
+		t.Fatal("session not expired")
+	}
+	select {
+	case <-room.Done:
+	case <-time.After(time.Second):
+		t.Fatal("empty room not closed")
+	}
+	if h.registry.session("s1") != nil || h.registry.room("r1") != nil {
+		t.Fatal("registry not cleaned")
+	}
+}
+
+func TestIdleRoom(t *testing.T) {
+	h := &Handler{registry: newRegistry(), cfg: config.Config{Timeout: config.TimeoutConfig{RoomIdle: 50 * time.Millisecond}}}
+	s1, _ := h.registry.reserveSession("s1")
+	room, _ := h.registry.join(s1, "r1", func() *Room { return closableRoom("r1") })
+	h.registry.removeSession("s1")
+	h.closeIdleRoom(room)
+
+	// 空闲期间加入的不关闭.
+	s2, _ := h.registry.reserveSession("s2")
+	if joined, created := h.registry.join(s2, "r1", nil); created || joined != room {
+		t.Fatal("idle room should be reused")
+	}
+	time.Sleep(80 * time.Millisecond)
+	if !room.Running() {
+		t.Fatal("room closed with session")
+	}
+
+	h.registry.removeSession("s2")
+	h.closeIdleRoom(room)
+	select {
+	case <-room.Done:
+	case <-time.After(time.Second):
+		t.Fatal("idle room not closed")
+	}
+	if room.CloseReason() != "idle" || h.registry.room("r1") != nil {
+		t.Fatalf("reason %q", room.CloseReason())
+	}
+}
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"image"
+	"xmediaEmu/pkg/cws"
+	"xmediaEmu/pkg/cws/entity"
+	"xmediaEmu/pkg/emulator/config"
+	"xmediaEmu/pkg/log"
+)
+
+// NewLocalHandler 没有coordinator连接的Handler, 供http接口调用, 使用最新的协议版本.
+func NewLocalHandler(conf config.Config) *Handler {
+	h := NewHandler(conf, nil)
+	h.version = entity.ProtocolVersion
+	h.routes()
+	return h
+}
+
+// Call 在本地执行一个命令, 和ws的命令一样校验, 失败时响应带Error.
+func (h *Handler) Call(packet cws.WSPacket) cws.WSPacket {
+	if _, ok := h.commands[packet.ID]; !ok {
+		return h.handleUnknown()(packet)
+	}
+	resp := h.dispatch(packet.ID)(packet)
+	resp.SessionID = packet.SessionID
+	return resp
+}
+
+// Sessions 所有session的状态, 按ID排序.
+func (h *Handler) Sessions() []entity.SessionInfo {
+	sessions := []entity.SessionInfo{}
+	for _, s := range h.registry.sessionList() {
+		info := entity.SessionInfo{SessionId: s.ID, State: entity.SessionStarting}
+		select {
+		case <-s.ready:
+			info.State = entity.SessionRunning
+			if s.peerconnection != nil {
+				info.LastReceived = s.peerconnection.LastReceived().UnixNano() / 1e6
+			}
+		default:
+		}
+		if room := h.registry.roomOf(s.ID); room != nil {
+			info.RoomId = room.ID
+		}
+		sessions = append(sessions, info)
+	}
+	return sessions
+}
+
+// Snapshot room下一帧画面的拷贝, 没有画面时返回nil.
+func (h *Handler) Snapshot(roomID string) (image.Image, error) {
+	room := h.getRoom(roomID)
+	if room == nil || !room.Running() {
+		return nil, cws.NewPacketError(cws.CodeNotFound, "room %s not found", roomID)
+	}
+	img, ok := room.director.GetViewport().(image.Image)
+	if !ok {
+		return nil, nil
+	}
+	return img, nil
+}
+
+// CloseRoom 拆除room里的所有session并关闭room, 期间加入的session不受影响, room不存在时返回false.
+func (h *Handler) CloseRoom(roomID string) bool {
+	room := h.getRoom(roomID)
+	if room == nil || !room.Running() {
+		return false
+	}
+	for _, s := range h.registry.sessionsOf(roomID) {
+		// 还在启动的等启动完成.
+		<-s.ready
+		h.closeSession(s.ID)
+	}
+	if h.registry.removeIdleRoom(room) {
+		log.Logger.Infof("[worker] closing room: %s", roomID)
+		room.CloseWithReason(entity.CloseReasonDeleted)
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"testing"
+
+	"xmediaEmu/pkg/cws/entity"
+	"xmediaEmu/pkg/emulator/rtpua"
+)
+
+func TestCloseRoom(t *testing.T) {
+	h := testHandler()
+	s1, _ := h.registry.reserveSession("s1")
+	pc, err := rtpua.NewWebRTC(rtpua.Config{SessionId: s1.ID}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1.peerconnection = pc
+	room, _ := h.registry.join(s1, "r1", func() *Room { return closableRoom("r1") })
+	room.AddConnectionToRoom(pc)
+	h.registry.reserveSession("s2")
+
+	sessions := h.Sessions()
+	if len(sessions) != 2 || sessions[0].RoomId != "r1" || sessions[0].State != entity.SessionStarting || sessions[1].RoomId != "" {
+		t.Fatalf("sessions %+v", sessions)
+	}
+	close(s1.ready)
+	if h.Sessions()[0].State != entity.SessionRunning {
+		t.Fatal("session not running")
+	}
+
+	if !h.CloseRoom("r1") || h.CloseRoom("r2") {
+		t.Fatal("close room")
+	}
+	<-room.Done
+	if h.registry.session("s1") != nil || h.registry.room("r1") != nil {
+		t.Fatal("registry not cleaned")
+	}
+	if h.CloseRoom("r1") {
+		t.Fatal("closed room closed again")
+	}
+}
@@ -1,23 +1,68 @@
 package worker
 
 import (
+	"common/util/process"
+	"fmt"
+	"xmediaEmu/pkg/audio/g711"
 	"xmediaEmu/pkg/emulator/config"
+	"xmediaEmu/pkg/emulator/libretro"
 	"xmediaEmu/pkg/emulator/rtpua"
 	"xmediaEmu/pkg/encoder"
+	"xmediaEmu/pkg/encoder/amr"
 	"xmediaEmu/pkg/encoder/h264"
 	"xmediaEmu/pkg/log"
 )
 
 // startVideo processes imageChannel images with an encoder (codec) then pushes the result to WebRTC.
+// 编码器按收到的帧大小创建, 分辨率变化时重建, 新的编码器从IDR开始.
 func (r *Room) startVideo(width, height int, video config.VideoConfig) {
-	var enc *h264.H264 // encoder.Encoder
-	var err error
-
 	log.Logger.Debug("Video codec:", video.Codec)
 	if video.Codec != string(config.H264) {
 		log.Logger.Error("ignore unknown codec:", video.Codec)
 	}
-	enc, err = h264.NewEncoder(width, height, h264.WithOptions(h264.Options{
+
+	var pipe *encoder.VideoPipe
+	defer func() {
+		if pipe != nil {
+			pipe.Stop()
+		}
+	}()
+
+	// imageChannel来自图片的接收输入流.
+	for image := range r.imageChannel {
+		// 暂停时丢弃.
+		if r.Paused() {
+			continue
+		}
+		if size := image.Image.Bounds().Size(); pipe == nil || size.X != width || size.Y != height {
+			if pipe != nil {
+				log.Logger.Infof("Room %s video size changed from %dx%d to %dx%d", r.ID, width, height, size.X, size.Y)
+				pipe.Stop()
+			}
+			width, height = size.X, size.Y
+			if pipe = r.newVideoPipe(width, height, video); pipe == nil {
+				// 没有编码器也要读完, 否则渲染线程阻塞, room关不掉.
+				for range r.imageChannel {
+				}
+				log.Logger.Error("Room ", r.ID, " video channel closed without encoder")
+				return
+			}
+		}
+
+		einput := pipe.Input
+		if len(einput) < cap(einput) {
+			einput <- encoder.InFrame{Image: image.Image, Timestamp: image.Timestamp}
+			log.Logger.Debugf("startVideo done, einput length of image: %d", len(image.Image.Pix))
+		} else {
+			log.Logger.Info("startVideo done, einput queue is full")
+		}
+	}
+	log.Logger.Info("Room ", r.ID, " video channel closed")
+}
+
+// newVideoPipe 创建编码器并把输出分发给所有session, 编码器关闭后分发结束.
+func (r *Room) newVideoPipe(width, height int, video config.VideoConfig) *encoder.VideoPipe {
+	enc, err := h264.NewEncoder(width, height, h264.WithOptions(h264.Options{
 		Crf:      video.H264.Crf,
 		Tune:     video.H264.Tune,
 		Preset:   video.H264.Preset,
@@ -26,61 +71,148 @@ func (r *Room) startVideo(width, height int, video config.VideoConfig) {
 	}))
 	if err != nil {
 		log.Logger.Error("error create new encoder", err)
-		return
+		return nil
 	}
 	log.Logger.Debugf("startVideo: create new encoder:%v", enc)
 
-	r.vPipe = encoder.NewVideoPipe(enc, width, height)
-	einput, eoutput := r.vPipe.Input, r.vPipe.Output
+	pipe := encoder.NewVideoPipe(enc, width, height)
+	r.pipeLock.Lock()
+	r.vPipe, r.width, r.height = pipe, width, height
+	r.pipeLock.Unlock()
+
+	go pipe.Start()
+	go r.fanoutVideo(pipe.Output)
+	return pipe
+}
+
+// fanoutVideo 把编码后的帧发给所有连接的session, eoutput关闭后结束.
+func (r *Room) fanoutVideo(eoutput <-chan encoder.OutFrame) {
+	defer func() {
+		if v := recover(); v != nil {
+			process.DefaultPanicReport.RecoverFromPanic(r.ID, "Room:fanoutVideo", v)
+		}
+	}()
 
-	go r.vPipe.Start()
-	defer r.vPipe.Stop()
+	// Test: TODO:测试代码，待删除.
+	//h264File, err := h264writer.New("worker.h264")
+	//if err != nil {
+	//	panic(err)
+	//}
 
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Logger.Warn("Recovered when sent to close Image Channel")
+	// fanout Screen, send to result rtp to .
+	for data := range eoutput {
+		// 每帧复制一次session列表, 发送时不持锁.
+		for _, webRTC := range r.sessions() {
+			if !webRTC.IsConnected() {
+				log.Logger.Debugf("webRTC disconnect, ignored. ")
+				continue
 			}
-		}()
-
-		// Test: TODO:测试代码，待删除.
-		//h264File, err := h264writer.New("worker.h264")
-		//if err != nil {
-		//	panic(err)
-		//}
-
-		// fanout Screen, send to result rtp to .
-		for data := range eoutput {
-			// TODO: r.rtcSessions is rarely updated. Lock will hold down perf
-			for _, webRTC := range r.rtcSessions {
-				if !webRTC.IsConnected() {
-					log.Logger.Debugf("webRTC disconnect, ignored. ")
-					continue
-				}
-				// encode frame
-				// fanout imageChannel
-				// NOTE: can block here
-				webRTC.ImageChannel <- rtpua.WebFrame{Data: data.Data, Timestamp: data.Timestamp}
-				log.Logger.Debugf("startVideo done, write ImageChannel: %d", len(data.Data))
-
-				// Test:
-				//if err := h264File.WriteFile(data.Data); err != nil {
-				//	pterm.FgLightRed.Printfln("startVideo:test  h264File.WriteFile failed:%v\n", err)
-				//} else {
-				//	pterm.FgWhite.Printf("startVideo:test write image length:%d done. \n", len(data.Data))
-				//}
+			// encode frame
+			// fanout imageChannel
+			// NOTE: can block here, 断开时返回.
+			if !webRTC.SendFrame(rtpua.WebFrame{Data: data.Data, Timestamp: data.Timestamp}) {
+				continue
 			}
+			log.Logger.Debugf("startVideo done, write ImageChannel: %d", len(data.Data))
+
+			// Test:
+			//if err := h264File.WriteFile(data.Data); err != nil {
+			//	pterm.FgLightRed.Printfln("startVideo:test  h264File.WriteFile failed:%v\n", err)
+			//} else {
+			//	pterm.FgWhite.Printf("startVideo:test write image length:%d done. \n", len(data.Data))
+			//}
+		}
+	}
+}
+
+// fanoutAudio 音频不阻塞, 满了直接丢, eoutput关闭后结束.
+func (r *Room) fanoutAudio(eoutput <-chan encoder.OutFrame) {
+	defer func() {
+		if v := recover(); v != nil {
+			process.DefaultPanicReport.RecoverFromPanic(r.ID, "Room:fanoutAudio", v)
 		}
 	}()
 
-	// imageChannel来自图片的接收输入流.
-	for image := range r.imageChannel {
-		if len(einput) < cap(einput) {
-			einput <- encoder.InFrame{Image: image.Image, Timestamp: image.Timestamp}
-			log.Logger.Debugf("startVideo done, einput length of image: %d", len(image.Image.Pix))
-		} else {
-			log.Logger.Info("startVideo done, einput queue is full")
+	for data := range eoutput {
+		for _, webRTC := range r.sessions() {
+			if webRTC.IsConnected() {
+				webRTC.SendAudio(data.Data)
+			}
+		}
+	}
+}
+
+// newAudioEncoder 根据编码创建音频编码器, 返回编码要求的采样率.
+func newAudioEncoder(audio config.AudioConfig) (encoder.Encoder, int, error) {
+	switch config.AudioCodec(audio.Codec) {
+	case config.G711:
+		return encoder.NewG711Encoder(g711.Ulaw), 8000, nil
+	case config.G711A:
+		return encoder.NewG711Encoder(g711.Alaw), 8000, nil
+	case config.AMRNB:
+		enc, err := amr.NewNbEncoder(amr.NbMR122, false)
+		return enc, amr.NbSampleRate, err
+	case config.AMRWB:
+		enc, err := amr.NewWbEncoder(amr.WbMode2385, false)
+		return enc, amr.WbSampleRate, err
+	case config.PCM:
+		frequency := audio.Frequency
+		if frequency <= 0 {
+			frequency = 8000
+		}
+		return encoder.NewPcmEncoder(), frequency, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown audio codec: %s", audio.Codec)
+	}
+}
+
+// startAudio processes audioChannel pcm with an encoder (codec) then pushes the result to rtp.
+func (r *Room) startAudio(audio config.AudioConfig) {
+	log.Logger.Debug("Audio codec:", audio.Codec)
+	enc, frequency, err := newAudioEncoder(audio)
+	if err != nil {
+		log.Logger.Error("error create new audio encoder", err)
+		// 同startVideo, 读完audioChannel.
+		for range r.audioChannel {
+		}
+		return
+	}
+	if audio.Frequency > 0 && audio.Frequency != frequency {
+		log.Logger.Warnf("audio codec %s requires %dHz, ignore frequency %d", audio.Codec, frequency, audio.Frequency)
+	}
+
+	frame, channels := audio.Frame, audio.Channels
+	if frame <= 0 {
+		frame = amr.FrameMs
+	}
+	switch config.AudioCodec(audio.Codec) {
+	case config.AMRNB, config.AMRWB: // amr固定单声道20ms一帧.
+		frame, channels = amr.FrameMs, 1
+	case config.G711, config.G711A:
+		channels = 1
+	}
+
+	pipe := encoder.NewAudioPipe(enc, libretro.AudioSampleRate, libretro.AudioChannels, frequency, channels, frame)
+	r.pipeLock.Lock()
+	r.aPipe = pipe
+	r.pipeLock.Unlock()
+	einput, eoutput := pipe.Input, pipe.Output
+
+	go pipe.Start()
+	defer pipe.Stop()
+
+	go r.fanoutAudio(eoutput)
+
+	// audioChannel来自游戏的pcm输出, 暂停时丢弃.
+	for pcm := range r.audioChannel {
+		if r.Paused() {
+			continue
+		}
+		select {
+		case einput <- pcm:
+		default:
+			log.Logger.Info("startAudio, einput queue is full")
 		}
 	}
-	log.Logger.Fatal("Room ", r.ID, " video channel closed")
+	log.Logger.Info("Room ", r.ID, " audio channel closed")
 }
@@ -0,0 +1,160 @@
+package worker
+
+import (
+	"fmt"
+	"image"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"xmediaEmu/pkg/emulator/config"
+	"xmediaEmu/pkg/emulator/libretro"
+	"xmediaEmu/pkg/emulator/rtpua"
+	"xmediaEmu/pkg/encoder"
+)
+
+// connectedUa 和回环地址上的对端建立连接, 测试结束时断开.
+func connectedUa(t *testing.T, id string) *rtpua.RtpUa {
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { peer.Close() })
+
+	// rtcp占用rtp端口+1, 被占用时重试.
+	for i := 0; i < 5; i++ {
+		var pc *rtpua.RtpUa
+		if pc, err = rtpua.NewWebRTC(rtpua.Config{SessionId: id, UdpAddr: "127.0.0.1:0"}, 0, 0); err != nil {
+			break
+		}
+		offer, err := pc.AddrOffer(peer.LocalAddr().String(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = pc.StartClient(offer); err == nil {
+			t.Cleanup(pc.StopClient)
+			return pc
+		}
+	}
+	t.Fatal(err)
+	return nil
+}
+
+// 分发的同时session加入、离开和断开, 不能有数据竞争, 断开的session也不能让分发停止.
+func TestFanoutStorm(t *testing.T) {
+	room := closableRoom("r1")
+	defer room.Close()
+
+	video, audio := make(chan encoder.OutFrame), make(chan encoder.OutFrame)
+	var fanout sync.WaitGroup
+	fanout.Add(2)
+	go func() {
+		defer fanout.Done()
+		room.fanoutVideo(video)
+	}()
+	go func() {
+		defer fanout.Done()
+		room.fanoutAudio(audio)
+	}()
+	stop := make(chan struct{})
+	go func() {
+		defer close(video)
+		defer close(audio)
+		frame := encoder.OutFrame{Data: []byte{0, 0, 0, 1, 0x65, 0x88}}
+		for {
+			select {
+			case <-stop:
+				return
+			case video <- frame:
+			case audio <- frame:
+			}
+		}
+	}()
+
+	pcs := make([]*rtpua.RtpUa, 8)
+	for i := range pcs {
+		pcs[i] = connectedUa(t, fmt.Sprintf("s%d", i))
+	}
+	var wg sync.WaitGroup
+	for i, pc := range pcs {
+		wg.Add(1)
+		go func(i int, pc *rtpua.RtpUa) {
+			defer wg.Done()
+			room.AddConnectionToRoom(pc)
+			time.Sleep(time.Duration(i) * 5 * time.Millisecond)
+			// 一半先断开再离开, 一半先离开再断开, 断开的和重复的并发.
+			if i%2 == 0 {
+				go pc.StopClient()
+				pc.StopClient()
+				room.RemoveSession(pc)
+			} else {
+				room.RemoveSession(pc)
+				pc.StopClient()
+			}
+		}(i, pc)
+	}
+	wg.Wait()
+	if !room.IsEmpty() {
+		t.Fatal("sessions left in room")
+	}
+
+	// 之后加入的还能收到视频.
+	last := connectedUa(t, "last")
+	room.AddConnectionToRoom(last)
+	deadline := time.Now().Add(time.Second)
+	for last.Stats().Video.PacketsSent == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("fanout stopped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(stop)
+	fanout.Wait()
+}
+
+// 游戏结束后imageChannel关闭, startVideo返回, 不影响其他room.
+func TestStartVideoChannelClosed(t *testing.T) {
+	images := make(chan libretro.GameFrame)
+	close(images)
+	room := &Room{ID: "r1", imageChannel: images}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		room.startVideo(32, 32, config.VideoConfig{Codec: string(config.H264)})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("startVideo not returned")
+	}
+}
+
+// 编码器创建失败时继续读完imageChannel, 渲染线程不会阻塞.
+func TestStartVideoEncoderError(t *testing.T) {
+	images := make(chan libretro.GameFrame, 30)
+	room := &Room{ID: "r1", imageChannel: images}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		video := config.VideoConfig{Codec: string(config.H264)}
+		video.H264.Preset = "bogus"
+		room.startVideo(32, 32, video)
+	}()
+
+	frame := libretro.GameFrame{Image: image.NewRGBA(image.Rect(0, 0, 32, 32))}
+	for i := 0; i < 2*cap(images); i++ {
+		select {
+		case images <- frame:
+		case <-time.After(time.Second):
+			t.Fatalf("render blocked after %d frames", i)
+		}
+	}
+	close(images)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("startVideo not returned")
+	}
+}
@@ -2,36 +2,82 @@ package worker
 
 import (
 	"errors"
+	"fmt"
+	"net"
+	"sort"
 	"sync"
+	"time"
+	"xmediaEmu/pkg/log"
 )
 
+const (
+	// 释放的端口冷却一段时间再分配, 避免对端迟到的rtp发给新的会话.
+	defaultQuarantine = 5 * time.Second
+	// 探测绑定失败(被其他进程占用)时最多重试的次数.
+	maxProbeRetry = 16
+)
+
+var ErrInsufficientCapacity = errors.New("insufficient capacity")
+
 func init() {
-	defaultSuiteHelper = &PortSuiteHelper{
-		startPort:     10000,
-		capacity:      (20000 - 10000) / 2,
-		portsUsed:     map[int]bool{},
-		lastAllocated: -1,
-	}
+	defaultSuiteHelper = NewPortSuiteHelper(10000, 20000, defaultQuarantine)
 }
 
 // module init here, called by external if not default.
-func Init(start, end int) {
-	defaultSuiteHelper.startPort = start
-	defaultSuiteHelper.capacity = (end - start) / 2
+// ips为媒体ip, 每个ip一个端口池, 不传时只有一个ip为空的池, 由调用方使用配置的媒体ip.
+func Init(start, end int, quarantine time.Duration, ips ...string) {
+	defaultSuiteHelper = NewPortSuiteHelper(start, end, quarantine, ips...)
 }
 
-// one port for audio or video, and for rtcp.
+// one port for rtp(audio and video), and port+1 for rtcp.
 type PortSuite struct {
+	Ip       string // 所在的媒体ip, 空表示使用配置的媒体ip.
 	PortRtp  int
 	PortRtcp int
+	Owner    string // 占用的session id.
 }
 
-type PortSuiteHelper struct {
-	startPort     int
-	capacity      int
+// RtpAddr rtp监听地址, Ip为空时用defaultIp.
+func (p *PortSuite) RtpAddr(defaultIp string) string {
+	ip := p.Ip
+	if ip == "" {
+		ip = defaultIp
+	}
+	return fmt.Sprintf("%s:%d", ip, p.PortRtp)
+}
+
+// PortLease 一次分配, 用于运维查询和泄漏检测.
+type PortLease struct {
+	Ip        string    `json:"ip"`
+	PortRtp   int       `json:"port_rtp"`
+	Owner     string    `json:"owner"`
+	Allocated time.Time `json:"allocated"`
+}
+
+// PortPoolStats 每个ip的端口使用情况.
+type PortPoolStats struct {
+	Ip          string `json:"ip"`
+	Capacity    int    `json:"capacity"`
+	Used        int    `json:"used"`
+	Quarantined int    `json:"quarantined"`
+}
+
+// portPool 一个媒体ip的端口, id对应startPort+id*2.
+type portPool struct {
+	ip            string
 	lastAllocated int
-	portsUsed     map[int]bool
-	mu            sync.Mutex
+	used          map[int]*PortLease
+	cooling       map[int]time.Time // 释放时间.
+}
+
+type PortSuiteHelper struct {
+	startPort  int
+	capacity   int // 每个池的端口对数.
+	quarantine time.Duration
+	pools      []*portPool
+	// 分配时先绑定一次确认端口没有被其他进程占用.
+	probe bool
+	mu    sync.Mutex
 }
 
 var defaultSuiteHelper *PortSuiteHelper
@@ -40,35 +86,176 @@ func GetPortSuiteHelper() *PortSuiteHelper {
 	return defaultSuiteHelper
 }
 
-// 4 ports for one session
-func (psHelper *PortSuiteHelper) generatePortSuiteByID(id int) *PortSuite {
+func NewPortSuiteHelper(start, end int, quarantine time.Duration, ips ...string) *PortSuiteHelper {
+	if len(ips) == 0 {
+		ips = []string{""}
+	}
+	capacity := (end - start) / 2
+	if capacity < 0 {
+		capacity = 0
+	}
+	psHelper := &PortSuiteHelper{
+		startPort:  start,
+		capacity:   capacity,
+		quarantine: quarantine,
+		probe:      true,
+	}
+	for _, ip := range ips {
+		psHelper.pools = append(psHelper.pools, &portPool{
+			ip:            ip,
+			lastAllocated: -1,
+			used:          map[int]*PortLease{},
+			cooling:       map[int]time.Time{},
+		})
+	}
+	return psHelper
+}
+
+// Capacity 所有ip可以同时使用的端口对数.
+func (psHelper *PortSuiteHelper) Capacity() int {
+	return psHelper.capacity * len(psHelper.pools)
+}
+
+func (psHelper *PortSuiteHelper) generatePortSuiteByID(pool *portPool, id int, owner string) *PortSuite {
 	base := psHelper.startPort + id*2
 	return &PortSuite{
+		Ip:       pool.ip,
 		PortRtp:  base,
 		PortRtcp: base + 1,
+		Owner:    owner,
 	}
 }
 
-func (psHelper *PortSuiteHelper) AllotPort() (*PortSuite, error) {
+// AllotPort 在空闲最多的ip上分配一对端口, owner为占用的session id.
+func (psHelper *PortSuiteHelper) AllotPort(owner string) (*PortSuite, error) {
+	for i := 0; i < maxProbeRetry; i++ {
+		suite, err := psHelper.reserve(owner)
+		if err != nil {
+			return nil, err
+		}
+		if !psHelper.probe {
+			return suite, nil
+		}
+		err = probePort(suite)
+		if err == nil {
+			return suite, nil
+		}
+		// 被其他进程占用, 冷却后再试.
+		log.Logger.Warnf("port %d of ip %s in use, err:%v", suite.PortRtp, suite.Ip, err)
+		psHelper.ReleasePort(suite)
+	}
+	return nil, ErrInsufficientCapacity
+}
+
+func (psHelper *PortSuiteHelper) reserve(owner string) (*PortSuite, error) {
 	psHelper.mu.Lock()
 	defer psHelper.mu.Unlock()
 
-	if len(psHelper.portsUsed) >= psHelper.capacity {
-		return nil, errors.New("insufficient capacity")
+	now := time.Now()
+	var pool *portPool
+	free := 0
+	for _, p := range psHelper.pools {
+		p.expire(now, psHelper.quarantine)
+		if n := psHelper.capacity - len(p.used) - len(p.cooling); n > free {
+			pool, free = p, n
+		}
+	}
+	if pool == nil {
+		return nil, ErrInsufficientCapacity
 	}
 
 	for {
-		psHelper.lastAllocated = (psHelper.lastAllocated + 1) % psHelper.capacity
-		if _, ok := psHelper.portsUsed[psHelper.lastAllocated]; !ok {
-			break
+		pool.lastAllocated = (pool.lastAllocated + 1) % psHelper.capacity
+		id := pool.lastAllocated
+		if _, ok := pool.used[id]; ok {
+			continue
+		}
+		if _, ok := pool.cooling[id]; ok {
+			continue
+		}
+		suite := psHelper.generatePortSuiteByID(pool, id, owner)
+		pool.used[id] = &PortLease{Ip: pool.ip, PortRtp: suite.PortRtp, Owner: owner, Allocated: now}
+		return suite, nil
+	}
+}
+
+// expire 冷却结束的端口可以再分配.
+func (p *portPool) expire(now time.Time, quarantine time.Duration) {
+	for id, released := range p.cooling {
+		if now.Sub(released) >= quarantine {
+			delete(p.cooling, id)
+		}
+	}
+}
+
+// probePort 绑定rtp和rtcp端口确认可用.
+func probePort(suite *PortSuite) error {
+	for _, port := range []int{suite.PortRtp, suite.PortRtcp} {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(suite.Ip), Port: port})
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	}
+	return nil
+}
+
+// ReleasePort 释放后进入冷却, 重复释放和已经分给其他session的忽略.
+func (psHelper *PortSuiteHelper) ReleasePort(suite *PortSuite) {
+	if suite == nil {
+		return
+	}
+	psHelper.mu.Lock()
+	defer psHelper.mu.Unlock()
+
+	id := (suite.PortRtp - psHelper.startPort) / 2
+	for _, pool := range psHelper.pools {
+		if pool.ip != suite.Ip {
+			continue
+		}
+		lease, ok := pool.used[id]
+		if !ok {
+			log.Logger.Warnf("release port %d of ip %s not allocated, owner:%s", suite.PortRtp, suite.Ip, suite.Owner)
+			return
 		}
+		if lease.Owner != suite.Owner {
+			log.Logger.Warnf("release port %d of ip %s owned by %s, owner:%s", suite.PortRtp, suite.Ip, lease.Owner, suite.Owner)
+			return
+		}
+		delete(pool.used, id)
+		pool.cooling[id] = time.Now()
+		return
 	}
-	psHelper.portsUsed[psHelper.lastAllocated] = true
-	return psHelper.generatePortSuiteByID(psHelper.lastAllocated), nil
 }
 
-func (psHelper *PortSuiteHelper) ReleasePort(portRtp int) {
+// Stats 每个ip的使用情况.
+func (psHelper *PortSuiteHelper) Stats() []PortPoolStats {
 	psHelper.mu.Lock()
-	delete(psHelper.portsUsed, (portRtp-psHelper.startPort)/4)
-	psHelper.mu.Unlock()
+	defer psHelper.mu.Unlock()
+
+	now := time.Now()
+	stats := make([]PortPoolStats, 0, len(psHelper.pools))
+	for _, pool := range psHelper.pools {
+		pool.expire(now, psHelper.quarantine)
+		stats = append(stats, PortPoolStats{Ip: pool.ip, Capacity: psHelper.capacity, Used: len(pool.used), Quarantined: len(pool.cooling)})
+	}
+	return stats
+}
+
+// Leaks 占用超过olderThan的分配, 正常的会话不会持续这么久, 按分配时间排序.
+func (psHelper *PortSuiteHelper) Leaks(olderThan time.Duration) []PortLease {
+	psHelper.mu.Lock()
+	defer psHelper.mu.Unlock()
+
+	now := time.Now()
+	leaks := []PortLease{}
+	for _, pool := range psHelper.pools {
+		for _, lease := range pool.used {
+			if now.Sub(lease.Allocated) >= olderThan {
+				leaks = append(leaks, *lease)
+			}
+		}
+	}
+	sort.Slice(leaks, func(i, j int) bool { return leaks[i].Allocated.Before(leaks[j].Allocated) })
+	return leaks
 }
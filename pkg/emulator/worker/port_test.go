@@ -0,0 +1,162 @@
+package worker
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPortRelease(t *testing.T) {
+	helper := NewPortSuiteHelper(30000, 30008, 0)
+	helper.probe = false
+
+	var suites []*PortSuite
+	for i := 0; i < 4; i++ {
+		suite, err := helper.AllotPort("s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if suite.PortRtcp != suite.PortRtp+1 {
+			t.Fatalf("rtcp port %d for rtp %d", suite.PortRtcp, suite.PortRtp)
+		}
+		suites = append(suites, suite)
+	}
+	if _, err := helper.AllotPort("s"); err != ErrInsufficientCapacity {
+		t.Fatalf("got %v, want insufficient capacity", err)
+	}
+
+	// 释放第3对后只能分配到同一对.
+	helper.ReleasePort(suites[2])
+	helper.ReleasePort(suites[2])
+	suite, err := helper.AllotPort("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suite.PortRtp != suites[2].PortRtp {
+		t.Fatalf("got port %d, want %d", suite.PortRtp, suites[2].PortRtp)
+	}
+}
+
+// 端口重新分给别的session后, 旧session迟到的释放不能影响新的.
+func TestPortReleaseOwner(t *testing.T) {
+	helper := NewPortSuiteHelper(30000, 30002, 0)
+	helper.probe = false
+
+	old, err := helper.AllotPort("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	helper.ReleasePort(old)
+	suite, err := helper.AllotPort("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suite.PortRtp != old.PortRtp {
+		t.Fatalf("got port %d, want %d", suite.PortRtp, old.PortRtp)
+	}
+
+	helper.ReleasePort(old)
+	if _, err := helper.AllotPort("other"); err != ErrInsufficientCapacity {
+		t.Fatalf("got %v, want insufficient capacity", err)
+	}
+	helper.ReleasePort(suite)
+	if _, err := helper.AllotPort("other"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPortQuarantine(t *testing.T) {
+	helper := NewPortSuiteHelper(30000, 30004, 50*time.Millisecond)
+	helper.probe = false
+
+	a, _ := helper.AllotPort("a")
+	b, _ := helper.AllotPort("b")
+	helper.ReleasePort(a)
+	if _, err := helper.AllotPort("c"); err != ErrInsufficientCapacity {
+		t.Fatalf("quarantined port allocated, err:%v", err)
+	}
+	if stats := helper.Stats(); stats[0].Used != 1 || stats[0].Quarantined != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	c, err := helper.AllotPort("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.PortRtp != a.PortRtp || c.PortRtp == b.PortRtp {
+		t.Fatalf("got port %d", c.PortRtp)
+	}
+}
+
+func TestPortMultiIp(t *testing.T) {
+	helper := NewPortSuiteHelper(30000, 30004, 0, "10.0.0.1", "10.0.0.2")
+	helper.probe = false
+	if helper.Capacity() != 4 {
+		t.Fatalf("capacity %d", helper.Capacity())
+	}
+
+	ips := map[string]int{}
+	var suites []*PortSuite
+	for i := 0; i < 4; i++ {
+		suite, err := helper.AllotPort("s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ips[suite.Ip]++
+		suites = append(suites, suite)
+	}
+	if ips["10.0.0.1"] != 2 || ips["10.0.0.2"] != 2 {
+		t.Fatalf("unbalanced %v", ips)
+	}
+	if suites[0].RtpAddr("x") != suites[0].Ip+":30000" {
+		t.Fatalf("addr %s", suites[0].RtpAddr("x"))
+	}
+
+	// 同一端口号在不同ip上互不影响.
+	helper.ReleasePort(&PortSuite{Ip: "10.0.0.2", PortRtp: 30000, Owner: "s"})
+	if suite, err := helper.AllotPort("s"); err != nil || suite.Ip != "10.0.0.2" || suite.PortRtp != 30000 {
+		t.Fatalf("got %+v %v", suite, err)
+	}
+}
+
+func TestPortProbe(t *testing.T) {
+	// 占用第一对的rtcp端口, 分配时应跳过.
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	busy := conn.LocalAddr().(*net.UDPAddr).Port
+
+	start := busy - 1
+	helper := NewPortSuiteHelper(start, start+4, time.Minute, "127.0.0.1")
+	suite, err := helper.AllotPort("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suite.PortRtp == start {
+		t.Fatalf("allocated busy port %d", busy)
+	}
+	if stats := helper.Stats(); stats[0].Used != 1 || stats[0].Quarantined != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func TestPortLeaks(t *testing.T) {
+	helper := NewPortSuiteHelper(30000, 30010, 0)
+	helper.probe = false
+
+	old, _ := helper.AllotPort("old")
+	time.Sleep(20 * time.Millisecond)
+	helper.AllotPort("new")
+
+	leaks := helper.Leaks(10 * time.Millisecond)
+	if len(leaks) != 1 || leaks[0].Owner != "old" || leaks[0].PortRtp != old.PortRtp {
+		t.Fatalf("leaks %+v", leaks)
+	}
+	helper.ReleasePort(old)
+	if leaks := helper.Leaks(0); len(leaks) != 1 || leaks[0].Owner != "new" {
+		t.Fatalf("leaks %+v", leaks)
+	}
+}
@@ -0,0 +1,196 @@
+package worker
+
+import (
+	"sort"
+	"sync"
+)
+
+// registry session和room的索引, cws回调在各自的goroutine里并发访问, 都在锁内操作.
+// session->room用Session.room, room->sessions用members.
+type registry struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session            // sessionID -> session
+	rooms    map[string]*Room               // roomID -> room
+	members  map[string]map[string]*Session // roomID -> sessionID -> session
+}
+
+func newRegistry() *registry {
+	return &registry{
+		sessions: map[string]*Session{},
+		rooms:    map[string]*Room{},
+		members:  map[string]map[string]*Session{},
+	}
+}
+
+// reserveSession 占位一个session, 已存在时返回已有的和false.
+// 新建的session在ready关闭前还没有启动完成.
+func (r *registry) reserveSession(id string) (*Session, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s, ok := r.sessions[id]; ok {
+		return s, false
+	}
+	s := &Session{ID: id, ready: make(chan struct{}), done: make(chan struct{})}
+	r.sessions[id] = s
+	return s, true
+}
+
+func (r *registry) session(id string) *Session {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sessions[id]
+}
+
+// removeSession 删除session并从所在room移除, 返回所在room和room是否空了.
+// room空了之后还在索引里, 由removeIdleRoom删除.
+// 不存在时返回nil.
+func (r *registry) removeSession(id string) (*Session, *Room, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok {
+		return nil, nil, false
+	}
+	delete(r.sessions, id)
+	room, empty := r.detachLocked(s)
+	return s, room, empty
+}
+
+func (r *registry) room(id string) *Room {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rooms[id]
+}
+
+// join session加入运行中的room, 没有时用create创建, 第二个返回值表示是否新建.
+// 查找和加入在同一个锁内, 空闲的room不会在加入前被删除.
+func (r *registry) join(s *Session, id string, create func() *Room) (*Room, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	room, ok := r.rooms[id]
+	created := !ok || !room.Running()
+	if created {
+		room = create()
+		r.rooms[room.ID] = room
+	}
+	r.attachLocked(s, room)
+	return room, created
+}
+
+// sessionList 所有session, 按ID排序.
+func (r *registry) sessionList() []*Session {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sessions := make([]*Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions
+}
+
+// roomList 索引里的所有room, 按ID排序.
+func (r *registry) roomList() []*Room {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rooms := make([]*Room, 0, len(r.rooms))
+	for _, room := range r.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].ID < rooms[j].ID })
+	return rooms
+}
+
+// removeRoom 只删除同一个实例, 同ID的新room不受影响.
+func (r *registry) removeRoom(room *Room) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rooms[room.ID] != room {
+		return
+	}
+	delete(r.rooms, room.ID)
+	for _, s := range r.members[room.ID] {
+		s.room = nil
+	}
+	delete(r.members, room.ID)
+}
+
+// attachLocked session加入room, 已经在其他room时先移除.
+func (r *registry) attachLocked(s *Session, room *Room) {
+	if s.room == room {
+		return
+	}
+	r.detachLocked(s)
+	s.room = room
+	members, ok := r.members[room.ID]
+	if !ok {
+		members = map[string]*Session{}
+		r.members[room.ID] = members
+	}
+	members[s.ID] = s
+}
+
+// detach session离开所在room, 返回room和room是否空了.
+func (r *registry) detach(s *Session) (*Room, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.detachLocked(s)
+}
+
+func (r *registry) detachLocked(s *Session) (*Room, bool) {
+	room := s.room
+	if room == nil {
+		return nil, false
+	}
+	s.room = nil
+	members := r.members[room.ID]
+	delete(members, s.ID)
+	// 最后一个离开的返回true, 空闲期间同ID的start还可以加入.
+	if len(members) == 0 {
+		delete(r.members, room.ID)
+		return room, true
+	}
+	return room, false
+}
+
+// removeIdleRoom room没有session时从索引删除并返回true, room只会被删除一次.
+// 之后同ID的start会新建room.
+func (r *registry) removeIdleRoom(room *Room) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rooms[room.ID] != room || len(r.members[room.ID]) > 0 {
+		return false
+	}
+	delete(r.rooms, room.ID)
+	return true
+}
+
+// roomOf session所在的room.
+func (r *registry) roomOf(sessionID string) *Room {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if s, ok := r.sessions[sessionID]; ok {
+		return s.room
+	}
+	return nil
+}
+
+// sessionsOf room里的所有session.
+func (r *registry) sessionsOf(roomID string) []*Session {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sessions := make([]*Session, 0, len(r.members[roomID]))
+	for _, s := range r.members[roomID] {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"xmediaEmu/pkg/cws"
+	"xmediaEmu/pkg/emulator/rtpua"
+)
+
+func testRoom(id string) *Room {
+	return &Room{ID: id, IsRunning: true, Done: make(chan struct{})}
+}
+
+func TestRegistryReserve(t *testing.T) {
+	r := newRegistry()
+	s, created := r.reserveSession("s1")
+	if !created {
+		t.Fatal("first reserve should create")
+	}
+	if dup, created := r.reserveSession("s1"); created || dup != s {
+		t.Fatal("duplicate reserve should return the same session")
+	}
+
+	room, created := r.join(s, "r1", func() *Room { return testRoom("r1") })
+	if !created {
+		t.Fatal("room should be created")
+	}
+	if r.roomOf("s1") != room || len(r.sessionsOf("r1")) != 1 || r.room("r1") != room {
+		t.Fatal("join failed")
+	}
+	if r.removeIdleRoom(room) {
+		t.Fatal("room with session should not be removed")
+	}
+
+	if got, gotRoom, empty := r.removeSession("s1"); got != s || gotRoom != room || !empty {
+		t.Fatalf("remove got %v %v %v", got, gotRoom, empty)
+	}
+	if r.session("s1") != nil || len(r.sessionsOf("r1")) != 0 {
+		t.Fatal("session should be removed")
+	}
+	if got, _, _ := r.removeSession("s1"); got != nil {
+		t.Fatal("second remove should be nil")
+	}
+
+	// 空闲的room还可以加入.
+	s2, _ := r.reserveSession("s2")
+	if joined, created := r.join(s2, "r1", func() *Room { return testRoom("r1") }); created || joined != room {
+		t.Fatal("idle room should be reused")
+	}
+	r.removeSession("s2")
+	if !r.removeIdleRoom(room) || r.removeIdleRoom(room) || r.room("r1") != nil {
+		t.Fatal("idle room should be removed once")
+	}
+}
+
+// 并发start/quit, 每个room只能被关闭一次, 结束后索引为空.
+func TestRegistryStorm(t *testing.T) {
+	r := newRegistry()
+	var mu sync.Mutex
+	closed := map[*Room]int{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		sessionID := fmt.Sprintf("s%d", i%50)
+		roomID := fmt.Sprintf("r%d", i%5)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s, created := r.reserveSession(sessionID)
+			if !created {
+				return
+			}
+			r.join(s, roomID, func() *Room { return testRoom(roomID) })
+		}()
+		go func() {
+			defer wg.Done()
+			if _, room, empty := r.removeSession(sessionID); empty && r.removeIdleRoom(room) {
+				mu.Lock()
+				closed[room]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 50; i++ {
+		if _, room, empty := r.removeSession(fmt.Sprintf("s%d", i)); empty && r.removeIdleRoom(room) {
+			closed[room]++
+		}
+	}
+	for room, n := range closed {
+		if n != 1 {
+			t.Errorf("room %p closed %d times", room, n)
+		}
+	}
+	if len(r.sessions) != 0 || len(r.rooms) != 0 || len(r.members) != 0 {
+		t.Errorf("registry not empty: %d sessions %d rooms %d members", len(r.sessions), len(r.rooms), len(r.members))
+	}
+}
+
+// 重复的quit并发到达, session只释放一次.
+func TestHandlerQuitStorm(t *testing.T) {
+	h := &Handler{registry: newRegistry()}
+	quit := h.handleRoomQuit()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		s, _ := h.registry.reserveSession(fmt.Sprintf("s%d", i))
+		pc, err := rtpua.NewWebRTC(rtpua.Config{SessionId: s.ID}, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.peerconnection = pc
+		go close(s.ready)
+
+		for j := 0; j < 3; j++ {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				quit(cws.WSPacket{SessionID: id}, nil)
+			}(s.ID)
+		}
+	}
+	wg.Wait()
+	if len(h.registry.sessions) != 0 {
+		t.Errorf("%d sessions left", len(h.registry.sessions))
+	}
+}
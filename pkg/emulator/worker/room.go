@@ -2,15 +2,21 @@ package worker
 
 import (
 	"bytes"
+	"common/util/process"
 	"encoding/gob"
 	"fmt"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
+	"xmediaEmu/pkg/cws/entity"
 	"xmediaEmu/pkg/emulator/config"
 	"xmediaEmu/pkg/emulator/libretro"
+	"xmediaEmu/pkg/emulator/libretro/games"
 	"xmediaEmu/pkg/emulator/rtpua"
 	// "xmediaEmu/pkg/emulator/run"
 	"xmediaEmu/pkg/encoder"
+	"xmediaEmu/pkg/inpututil"
 	"xmediaEmu/pkg/log"
 )
 
@@ -22,7 +28,8 @@ const (
 // Room is a game session. multi webRTC sessions can connect to a same game.
 // A room stores all the channel for interaction between all webRTCs session and emulator
 type Room struct {
-	ID string
+	ID   string
+	game string
 
 	// imageChannel is image stream received from director
 	imageChannel <-chan libretro.GameFrame
@@ -46,13 +53,21 @@ type Room struct {
 	// ws流还是纯rtp流？...
 	rtcSessions []*rtpua.RtpUa
 
-	// NOTE: Not in use, lock rtcSessions
-	// sessionsLock *sync.Mutex
+	// lock rtcSessions, IsRunning and closeReason
+	sessionsLock sync.Mutex
+	closeReason  string
 
 	// 先直接引用.
 	director *libretro.NaEmulator
 
-	vPipe *encoder.VideoPipe
+	// 暂停时不发送音视频.
+	paused int32
+
+	// 分辨率变化时重建vPipe, width和height为当前编码的大小.
+	pipeLock      sync.Mutex
+	vPipe         *encoder.VideoPipe
+	width, height int
+	aPipe         *encoder.AudioPipe
 }
 
 // TODO:
@@ -120,7 +135,7 @@ func NewVideoImporter(roomID string) chan libretro.GameFrame {
 
 // NewRoom creates a new room
 // 目前直接根据应用名字加载对应的game,直接采用注册机制实现.
-func NewRoom(roomID string, gameName string, bUseUnixSocket bool, config config.Config) *Room {
+func NewRoom(roomID string, gameName string, params games.Params, bUseUnixSocket bool, config config.Config) *Room {
 	if roomID == "" {
 		roomID = GenerateRoomID(gameName)
 	}
@@ -130,7 +145,8 @@ func NewRoom(roomID string, gameName string, bUseUnixSocket bool, config config.
 	inputChannel := make(chan libretro.InputEvent, 100)
 
 	room := &Room{
-		ID: roomID,
+		ID:   roomID,
+		game: gameName,
 
 		inputChannel: inputChannel,
 		imageChannel: nil,
@@ -142,8 +158,46 @@ func NewRoom(roomID string, gameName string, bUseUnixSocket bool, config config.
 		Done: make(chan struct{}, 1),
 	}
 
+	// 每个room独立的UserInterface、输入管理和渲染线程, room之间只共享编码库.
+	// director同步创建, room关闭时一定已经存在.
+	ui := libretro.NewUserInterface(inpututil.NewInputMgr())
+	ui.SetWindowSize(config.Width, config.Height)
+	ui.SetWindowTitle(gameName)
+
+	if bUseUnixSocket {
+		// Run without game, image stream is communicated over a unix socket
+		director, _, audioChannel := libretro.New(roomID, false, inputChannel, ui)
+		room.imageChannel = NewVideoImporter(roomID)
+		room.director = director
+		room.audioChannel = audioChannel
+	} else {
+		// Run without game, image stream is communicated over image channel
+		director, imageChannel, audioChannel := libretro.New(roomID, true, inputChannel, ui)
+		room.imageChannel = imageChannel
+		room.director = director
+		room.audioChannel = audioChannel
+	}
+
+	// gameMeta := room.director.LoadMeta(filepath.Join(game.Base, game.Path))
+	log.Logger.Infof("Viewport custom size is disabled, base size will be used instead %dx%d", config.Width, config.Height)
+
+	// set game frame size considering its orientation
+	//encoderW, encoderH := nwidth, nheight
+	//if gameMeta.Rotation.IsEven {
+	//	encoderW, encoderH = nheight, nwidth
+	//}
+
+	room.director.SetViewport(config.Width, config.Height)
+	params.Width, params.Height = config.Width, config.Height
+	room.director.SetGameParams(params)
+
 	// Check if room is on local storage, if not, pull from GCS to local storage
-	go func(game, roomID string) {
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				process.DefaultPanicReport.RecoverFromPanic(roomID, "Room:director", v)
+			}
+		}()
 		// 逻辑不存.
 		//store := nanoarch.Storage{
 		//	Path:     cfg.Emulator.Storage,
@@ -152,54 +206,26 @@ func NewRoom(roomID string, gameName string, bUseUnixSocket bool, config config.
 
 		// Check room is on local or fetch from server
 		// If not then load room or create room from local.
-		log.Logger.Infof("Room %s started. GameName: %s, bUseUnixSocket: %t", roomID, game, bUseUnixSocket)
-
-		// Spawn new emulator and plug-in all channels
-		gameHandleName := game
-
-		// TODO: run.Get()用的是默认输入管理.
-		libretro.Get().SetWindowSize(config.Width, config.Height)
-		libretro.Get().SetWindowTitle(gameHandleName)
-
-		// 创建userInterface.
-		if bUseUnixSocket {
-			// Run without game, image stream is communicated over a unix socket
-			imageChannel := NewVideoImporter(roomID)
-			director, _, audioChannel := libretro.New(roomID, false, inputChannel, libretro.Get())
-			room.imageChannel = imageChannel
-			room.director = director
-			room.audioChannel = audioChannel
-		} else {
-			// Run without game, image stream is communicated over image channel
-			director, imageChannel, audioChannel := libretro.New(roomID, true, inputChannel, libretro.Get())
-			room.imageChannel = imageChannel
-			room.director = director
-			room.audioChannel = audioChannel
-		}
-
-		// gameMeta := room.director.LoadMeta(filepath.Join(game.Base, game.Path))
-		log.Logger.Infof("Viewport custom size is disabled, base size will be used instead %dx%d", config.Width, config.Height)
-
-		// set game frame size considering its orientation
-		//encoderW, encoderH := nwidth, nheight
-		//if gameMeta.Rotation.IsEven {
-		//	encoderW, encoderH = nheight, nwidth
-		//}
-
-		room.director.SetViewport(config.Width, config.Height)
+		log.Logger.Infof("Room %s started. GameName: %s, bUseUnixSocket: %t", roomID, gameName, bUseUnixSocket)
 
 		// Spawn video and audio encoding for rtp
 		go room.startVideo(config.Width, config.Height, config.Encoder.Video)
 
-		// TODO audio: 711 or amr.
-		// go room.startAudio(8000, cfg.Encoder.Audio)
-		//go room.startVoice()
-		room.director.Start()
-	}(gameName, roomID)
+		if config.Encoder.Audio.Codec != "" {
+			go room.startAudio(config.Encoder.Audio)
+		}
+		// 游戏创建失败或异常结束时关闭room, 通过close_room通知coordinator.
+		if err := room.director.Start(); err != nil {
+			room.CloseWithReason(entity.CloseReasonGameError)
+		}
+	}()
 	return room
 }
 
 func (r *Room) IsRunningSessions() bool {
+	r.sessionsLock.Lock()
+	defer r.sessionsLock.Unlock()
+
 	// If there is running session
 	for _, s := range r.rtcSessions {
 		if s.IsConnected() {
@@ -215,6 +241,9 @@ func (r *Room) IsPCInRoom(w *rtpua.RtpUa) bool {
 	if r == nil {
 		return false
 	}
+	r.sessionsLock.Lock()
+	defer r.sessionsLock.Unlock()
+
 	for _, s := range r.rtcSessions {
 		if s.ID == w.ID {
 			return true
@@ -230,16 +259,107 @@ func (r *Room) UpdatePlayerIndex(peerconnection *rtpua.RtpUa, playerIndex int) {
 
 func (r *Room) AddConnectionToRoom(peerconnection *rtpua.RtpUa) {
 	peerconnection.AttachRoomID(r.ID)
+	peerconnection.OnKeyframeRequest(r.requestKeyframe)
+	r.sessionsLock.Lock()
 	r.rtcSessions = append(r.rtcSessions, peerconnection)
+	r.sessionsLock.Unlock()
+	// 新加入的需要从关键帧开始解码.
+	r.requestKeyframe()
 
 	go r.startRtpSession(peerconnection)
+	go r.startVoice(peerconnection)
+	go r.startDtmf(peerconnection)
+}
+
+// requestKeyframe 视频编码下一帧输出IDR.
+func (r *Room) requestKeyframe() {
+	r.pipeLock.Lock()
+	defer r.pipeLock.Unlock()
+	if r.vPipe != nil {
+		r.vPipe.RequestKeyframe()
+	}
+}
+
+// Pause 暂停发送音视频, 游戏和输入不受影响.
+func (r *Room) Pause() {
+	atomic.StoreInt32(&r.paused, 1)
+}
+
+// Resume 恢复发送, 对端从关键帧开始解码.
+func (r *Room) Resume() {
+	if atomic.CompareAndSwapInt32(&r.paused, 1, 0) {
+		r.requestKeyframe()
+	}
+}
+
+func (r *Room) Paused() bool {
+	return atomic.LoadInt32(&r.paused) != 0
+}
+
+// SetResolution 调整游戏输出大小, 编码器在下一帧按新的大小重建.
+func (r *Room) SetResolution(width, height int) {
+	log.Logger.Infof("Room %s resolution changed to %dx%d", r.ID, width, height)
+	r.director.SetViewport(width, height)
+}
+
+// Resolution 当前编码的分辨率.
+func (r *Room) Resolution() (int, int) {
+	r.pipeLock.Lock()
+	defer r.pipeLock.Unlock()
+	return r.width, r.height
+}
+
+// startVoice 对端语音作为输入送给游戏.
+func (r *Room) startVoice(peerconnection *rtpua.RtpUa) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Logger.Warn("Recovered when sent voice to closed inputChannel")
+		}
+	}()
+
+	for voice := range peerconnection.VoiceInChannel {
+		if peerconnection.Done || !peerconnection.IsConnected() || !r.Running() {
+			break
+		}
+
+		select {
+		case r.inputChannel <- libretro.InputEvent{Raw: inpututil.Voice{PCM: voice.Data, SampleRate: voice.SampleRate, Timestamp: voice.Timestamp, ConnID: peerconnection.ID}, PlayerIdx: peerconnection.PlayerIndex, ConnID: peerconnection.ID}:
+		default:
+		}
+	}
+	log.Logger.Info("[worker] voice of peer connection is done")
+}
+
+// startDtmf 对端按键映射成键盘按键送给游戏.
+func (r *Room) startDtmf(peerconnection *rtpua.RtpUa) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Logger.Warn("Recovered when sent dtmf to closed inputChannel")
+		}
+	}()
+
+	for digit := range peerconnection.DtmfChannel {
+		if peerconnection.Done || !peerconnection.IsConnected() || !r.Running() {
+			break
+		}
+		key, ok := inpututil.DtmfKey(digit)
+		if !ok {
+			continue
+		}
+
+		select {
+		case r.inputChannel <- libretro.InputEvent{Raw: key, PlayerIdx: peerconnection.PlayerIndex, ConnID: peerconnection.ID}:
+		default:
+		}
+	}
+	log.Logger.Info("[worker] dtmf of peer connection is done")
 }
 
 // 开启rtp session.
 func (r *Room) startRtpSession(peerconnection *rtpua.RtpUa) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Logger.Fatal("Warn: Recovered when sent to close inputChannel")
+			log.Logger.Warn("Recovered when sent to closed inputChannel")
 		}
 	}()
 
@@ -248,7 +368,7 @@ func (r *Room) startRtpSession(peerconnection *rtpua.RtpUa) {
 	// bug: when input channel here = nil, skip and finish
 	for input := range peerconnection.InputChannel {
 		// NOTE: when room is no longer running. InputChannel needs to have extra event to go inside the loop
-		if peerconnection.Done || !peerconnection.IsConnected() || !r.IsRunning {
+		if peerconnection.Done || !peerconnection.IsConnected() || !r.Running() {
 			break
 		}
 
@@ -262,12 +382,37 @@ func (r *Room) startRtpSession(peerconnection *rtpua.RtpUa) {
 	log.Logger.Info("[worker] peer connection is done")
 }
 
-func (r *Room) IsEmpty() bool { return len(r.rtcSessions) == 0 }
+// sessions 当前session列表的拷贝.
+func (r *Room) sessions() []*rtpua.RtpUa {
+	r.sessionsLock.Lock()
+	defer r.sessionsLock.Unlock()
+	return append([]*rtpua.RtpUa(nil), r.rtcSessions...)
+}
+
+func (r *Room) IsEmpty() bool {
+	r.sessionsLock.Lock()
+	defer r.sessionsLock.Unlock()
+	return len(r.rtcSessions) == 0
+}
+
+// Running 是否还没关闭.
+func (r *Room) Running() bool {
+	r.sessionsLock.Lock()
+	defer r.sessionsLock.Unlock()
+	return r.IsRunning
+}
+
+// CloseReason 关闭的原因, 还在运行时为空.
+func (r *Room) CloseReason() string {
+	r.sessionsLock.Lock()
+	defer r.sessionsLock.Unlock()
+	return r.closeReason
+}
 
 // RemoveSession removes a peerconnection from room and return true if there is no more room
 func (r *Room) RemoveSession(w *rtpua.RtpUa) {
 	log.Logger.Info("Cleaning session: ", w.ID)
-	// TODO: get list of r.rtcSessions in lock
+	r.sessionsLock.Lock()
 	for i, s := range r.rtcSessions {
 		log.Logger.Info("found session: ", w.ID)
 		if s.ID == w.ID {
@@ -277,6 +422,7 @@ func (r *Room) RemoveSession(w *rtpua.RtpUa) {
 			break
 		}
 	}
+	r.sessionsLock.Unlock()
 	// Detach input. Send end signal
 	select {
 	// 关闭byte.
@@ -286,11 +432,20 @@ func (r *Room) RemoveSession(w *rtpua.RtpUa) {
 }
 
 func (r *Room) Close() {
+	r.CloseWithReason(entity.CloseReasonEmpty)
+}
+
+// CloseWithReason 关闭room, reason通过close_room通知coordinator.
+func (r *Room) CloseWithReason(reason string) {
+	r.sessionsLock.Lock()
 	if !r.IsRunning {
+		r.sessionsLock.Unlock()
 		return
 	}
-
 	r.IsRunning = false
+	r.closeReason = reason
+	r.sessionsLock.Unlock()
+
 	log.Logger.Info("Closing room and director of room ", r.ID)
 	r.director.Close()
 	log.Logger.Info("Closing input of room ", r.ID)
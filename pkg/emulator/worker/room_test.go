@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"xmediaEmu/pkg/emulator/libretro"
+	"xmediaEmu/pkg/emulator/libretro/games"
+	iImage "xmediaEmu/pkg/image"
+	"xmediaEmu/pkg/inpututil"
+)
+
+// keyGame 每个tick把刚按下的键发出去.
+type keyGame struct {
+	input *inpututil.InputManager
+	keys  chan inpututil.Key
+}
+
+func (g *keyGame) SetInputMgr(input *inpututil.InputManager) { g.input = input }
+
+func (g *keyGame) Update() error {
+	for key := inpututil.Key(0); key < inpututil.KeyMax; key++ {
+		if g.input.IsKeyJustPressed(key) {
+			g.keys <- key
+		}
+	}
+	return nil
+}
+
+func (g *keyGame) Draw(*iImage.Context) {}
+
+func (g *keyGame) Layout(w, h int) (int, int) { return w, h }
+
+var testKeys = make(chan inpututil.Key, 16)
+
+func init() {
+	games.Register("keys-test", func(games.Params) (games.App, error) {
+		return &keyGame{keys: testKeys}, nil
+	})
+}
+
+// runningRoom 运行注册的游戏, 不编码, 测试结束时关闭.
+func runningRoom(t *testing.T, id, game string) *Room {
+	inputChannel := make(chan libretro.InputEvent, 100)
+	ui := libretro.NewUserInterface(inpututil.NewInputMgr())
+	ui.SetWindowSize(32, 32)
+	ui.SetWindowTitle(game)
+	director, imageChannel, _ := libretro.New(id, true, inputChannel, ui)
+	room := &Room{ID: id, game: game, IsRunning: true, Done: make(chan struct{}), inputChannel: inputChannel, director: director}
+
+	go director.Start()
+	go func() {
+		for range imageChannel {
+		}
+	}()
+	t.Cleanup(room.Close)
+	return room
+}
+
+// 对端的dtmf经startDtmf送到room的输入, 游戏在下一个tick里IsKeyJustPressed.
+func TestDtmfToGame(t *testing.T) {
+	room := runningRoom(t, "r1", "keys-test")
+	pc := connectedUa(t, "s1")
+	room.AddConnectionToRoom(pc)
+
+	for _, c := range []struct {
+		digit rune
+		key   inpututil.Key
+	}{{'5', inpututil.KeyDigit5}, {'#', inpututil.KeyEnter}, {'*', inpututil.KeyNumpadMultiply}} {
+		pc.DtmfChannel <- c.digit
+		select {
+		case key := <-testKeys:
+			if key != c.key {
+				t.Fatalf("%c got key %v", c.digit, key)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%c not pressed", c.digit)
+		}
+	}
+	// 每个按键只按下一次.
+	time.Sleep(5 * time.Second / libretro.DefaultTPS)
+	if len(testKeys) != 0 {
+		t.Fatalf("%d keys repeated", len(testKeys))
+	}
+}
@@ -1,14 +1,126 @@
 package worker
 
-import "xmediaEmu/pkg/cws/entity"
+import (
+	"sort"
+	"sync/atomic"
+	"xmediaEmu/pkg/cws"
+	"xmediaEmu/pkg/cws/entity"
+	"xmediaEmu/pkg/log"
+)
+
+// command 注册的命令, 数据解码校验后交给handle.
+type command struct {
+	since  int                   // 需要的最低协议版本.
+	reply  string                // 响应的命令id, 为空时和命令相同.
+	call   func() entity.Command // 没有数据的命令为nil.
+	handle commandHandler
+}
+
+// commandHandler call为校验过的命令数据.
+type commandHandler func(resp cws.WSPacket, call entity.Command) (req cws.WSPacket)
 
 // 命令字路由.
 func (h *Handler) routes() {
+	roomCall := func() entity.Command { return &entity.RoomCall{} }
+	h.commands = map[string]command{
+		entity.Hello: {since: entity.MinProtocolVersion, call: func() entity.Command { return &entity.HelloCall{} }, handle: h.handleHello()},
+		// TODO: Start带对端地址启动，stop停止完成两个基本功能.
+		entity.RoomStart: {since: 1, reply: entity.RoomStarted, call: func() entity.Command { return &entity.RoomStartCall{} }, handle: h.handleRoomStart()},
+		entity.RoomQuit:  {since: 1, handle: h.handleRoomQuit()},
+
+		entity.GetRoom:    {since: 2, call: roomCall, handle: h.handleGetRoom()},
+		entity.ListRooms:  {since: 2, handle: h.handleListRooms()},
+		entity.PauseRoom:  {since: 2, call: roomCall, handle: h.handlePauseRoom()},
+		entity.ResumeRoom: {since: 2, call: roomCall, handle: h.handleResumeRoom()},
+		entity.Keyframe:   {since: 2, call: roomCall, handle: h.handleKeyframe()},
+		entity.Resolution: {since: 2, call: func() entity.Command { return &entity.ResolutionCall{} }, handle: h.handleResolution()},
+	}
 	if h.oClient == nil {
 		return
 	}
 
-	// TODO: Start带对端地址启动，stop停止完成两个基本功能.
-	h.oClient.Receive(entity.RoomStart, h.handleRoomStart())
-	h.oClient.Receive(entity.RoomQuit, h.handleRoomQuit())
+	for id := range h.commands {
+		h.oClient.Receive(id, h.dispatch(id))
+	}
+	h.oClient.ReceiveUnknown(h.handleUnknown())
+}
+
+// protocolVersion hello协商的版本, 没有协商时为1.
+func (h *Handler) protocolVersion() int {
+	if v := atomic.LoadInt32(&h.version); v != 0 {
+		return int(v)
+	}
+	return 1
+}
+
+// dispatch 检查协议版本, 解码并校验数据后交给命令处理, 失败时回复错误.
+func (h *Handler) dispatch(id string) cws.PacketHandler {
+	cmd := h.commands[id]
+	reply := cmd.reply
+	if reply == "" {
+		reply = id
+	}
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		if version := h.protocolVersion(); cmd.since > version {
+			log.Logger.Warnf("command %s requires protocol version %d, negotiated %d", id, cmd.since, version)
+			return cws.ErrorPacket(reply, cws.CodeVersion, "%s requires protocol version %d, negotiated %d", id, cmd.since, version)
+		}
+
+		var call entity.Command
+		if cmd.call != nil {
+			call = cmd.call()
+			data := resp.Data
+			if data == "" {
+				data = "{}"
+			}
+			if err := call.From(data); err != nil {
+				log.Logger.Errorf("error: %s invalid data: %v", id, err)
+				return cws.ErrorPacket(reply, cws.CodeBadRequest, "invalid data: %v", err)
+			}
+			if err := call.Validate(); err != nil {
+				log.Logger.Errorf("error: %s invalid data: %v", id, err)
+				return cws.ErrorPacket(reply, cws.CodeBadRequest, "%v", err)
+			}
+		}
+		return cmd.handle(resp, call)
+	}
+}
+
+// commandsOf 协议版本可用的命令, 按名字排序.
+func (h *Handler) commandsOf(version int) []string {
+	ids := []string{}
+	for id, cmd := range h.commands {
+		if cmd.since <= version {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// 协商协议版本, 没有共同的版本时保持原来的版本.
+func (h *Handler) handleHello() commandHandler {
+	return func(resp cws.WSPacket, call entity.Command) (req cws.WSPacket) {
+		hello := call.(*entity.HelloCall)
+		version, ok := entity.NegotiateVersion(hello.Versions)
+		if !ok {
+			log.Logger.Warnf("no common protocol version: %v", hello.Versions)
+			return cws.ErrorPacket(entity.Hello, cws.CodeVersion, "no common protocol version in %v, supported %d-%d",
+				hello.Versions, entity.MinProtocolVersion, entity.ProtocolVersion)
+		}
+		atomic.StoreInt32(&h.version, int32(version))
+		log.Logger.Infof("[worker] protocol version %d negotiated", version)
+
+		rsp := entity.HelloRsp{Version: version, Commands: h.commandsOf(version)}
+		data, _ := rsp.To()
+		return cws.WSPacket{ID: entity.Hello, Data: data}
+	}
+}
+
+// 没有注册的命令.
+func (h *Handler) handleUnknown() cws.PacketHandler {
+	return func(resp cws.WSPacket) (req cws.WSPacket) {
+		log.Logger.Warnf("unknown command: %s, session:%s", resp.ID, resp.SessionID)
+		return cws.ErrorPacket(resp.ID, cws.CodeUnknown, "unknown command %q", resp.ID)
+	}
 }
@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"testing"
+
+	"xmediaEmu/pkg/cws"
+	"xmediaEmu/pkg/cws/entity"
+)
+
+func testHandler() *Handler {
+	h := &Handler{registry: newRegistry()}
+	h.routes()
+	return h
+}
+
+func TestDispatchVersion(t *testing.T) {
+	h := testHandler()
+	getRoom := h.dispatch(entity.GetRoom)
+
+	// 没有hello时按版本1.
+	data, _ := (&entity.RoomCall{RoomId: "r1"}).To()
+	if resp := getRoom(cws.WSPacket{ID: entity.GetRoom, Data: data}); resp.Error == nil || resp.Error.Code != cws.CodeVersion {
+		t.Fatalf("got %+v, want version error", resp)
+	}
+
+	hello, _ := (&entity.HelloCall{Versions: []int{99}}).To()
+	if resp := h.dispatch(entity.Hello)(cws.WSPacket{ID: entity.Hello, Data: hello}); resp.Error == nil || resp.Error.Code != cws.CodeVersion {
+		t.Fatalf("got %+v, want version error", resp)
+	}
+	hello, _ = (&entity.HelloCall{Versions: []int{1, 2, 99}}).To()
+	resp := h.dispatch(entity.Hello)(cws.WSPacket{ID: entity.Hello, Data: hello})
+	rsp := entity.HelloRsp{}
+	if err := rsp.From(resp.Data); err != nil || rsp.Version != 2 || len(rsp.Commands) != len(h.commands) {
+		t.Fatalf("got %+v %v", rsp, err)
+	}
+
+	if resp := getRoom(cws.WSPacket{ID: entity.GetRoom, Data: data}); resp.Error == nil || resp.Error.Code != cws.CodeNotFound {
+		t.Fatalf("got %+v, want not found", resp)
+	}
+}
+
+func TestDispatchInvalid(t *testing.T) {
+	h := testHandler()
+	h.version = entity.ProtocolVersion
+
+	for _, c := range []struct {
+		id, data string
+	}{
+		{entity.RoomStart, "{"},
+		{entity.RoomStart, ""},
+		{entity.RoomStart, `{"addr":"1.2.3.4"}`},
+		{entity.GetRoom, `{"room":1}`},
+		{entity.Resolution, `{"room":"r1","width":641,"height":480}`},
+	} {
+		resp := h.dispatch(c.id)(cws.WSPacket{ID: c.id, Data: c.data})
+		if resp.Error == nil || resp.Error.Code != cws.CodeBadRequest {
+			t.Fatalf("%s %q: got %+v, want bad request", c.id, c.data, resp)
+		}
+	}
+	if resp := h.dispatch(entity.RoomStart)(cws.WSPacket{ID: entity.RoomStart, Data: "{"}); resp.ID != entity.RoomStarted {
+		t.Fatalf("got reply id %s", resp.ID)
+	}
+	unknown := cws.WSPacket{ID: entity.RoomStart, SessionID: "s1", Data: `{"name":"nope","addr":"127.0.0.1:5000"}`}
+	if resp := h.dispatch(entity.RoomStart)(unknown); resp.Error == nil || resp.Error.Code != cws.CodeNotFound || h.registry.session("s1") != nil {
+		t.Fatalf("got %+v, want unknown game", resp)
+	}
+	if resp := h.handleUnknown()(cws.WSPacket{ID: "foo"}); resp.Error == nil || resp.Error.Code != cws.CodeUnknown || resp.ID != "foo" {
+		t.Fatalf("got %+v", resp)
+	}
+}
+
+func TestRoomCommands(t *testing.T) {
+	h := testHandler()
+	h.version = entity.ProtocolVersion
+	s1, _ := h.registry.reserveSession("s1")
+	room, _ := h.registry.join(s1, "r1", func() *Room { return closableRoom("r1") })
+	defer room.Close()
+
+	data, _ := (&entity.RoomCall{RoomId: "r1"}).To()
+	resp := h.dispatch(entity.PauseRoom)(cws.WSPacket{ID: entity.PauseRoom, Data: data})
+	info := entity.RoomInfo{}
+	if err := info.From(resp.Data); err != nil || !info.Paused || len(info.Sessions) != 1 || info.Sessions[0] != "s1" {
+		t.Fatalf("got %+v %v", info, err)
+	}
+	h.dispatch(entity.ResumeRoom)(cws.WSPacket{ID: entity.ResumeRoom, Data: data})
+	if room.Paused() {
+		t.Fatal("room still paused")
+	}
+
+	resp = h.dispatch(entity.ListRooms)(cws.WSPacket{ID: entity.ListRooms})
+	list := entity.RoomListRsp{}
+	if err := list.From(resp.Data); err != nil || len(list.Rooms) != 1 || list.Rooms[0].RoomId != "r1" {
+		t.Fatalf("got %+v %v", list, err)
+	}
+}
@@ -4,21 +4,46 @@ import (
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
+	"xmediaEmu/pkg/cws"
 	"xmediaEmu/pkg/emulator/rtpua"
 )
 
 type Session struct {
 	ID             string // session id
 	peerconnection *rtpua.RtpUa
+	port           *PortSuite // 音视频复用的rtp/rtcp端口.
+
+	// 启动完成(成功或失败)时关闭, 重复的start和quit要等待.
+	ready    chan struct{}
+	answer   string           // sdp answer, 启动失败时为空.
+	startErr *cws.PacketError // 启动失败的原因, 重复的start返回同样的错误.
+	// Close时关闭, 结束超时检测.
+	done      chan struct{}
+	closeOnce sync.Once
 
 	// Should I make direct reference
+	// 由registry在锁内维护.
 	room *Room
 }
 
 // Close close a session
 func (s *Session) Close() {
-	// TODO: Use event base
-	s.peerconnection.StopClient()
+	s.closeOnce.Do(func() {
+		close(s.done)
+		// TODO: Use event base
+		if s.peerconnection != nil {
+			s.peerconnection.StopClient()
+		}
+		s.releasePort()
+	})
+}
+
+func (s *Session) releasePort() {
+	if s.port != nil {
+		GetPortSuiteHelper().ReleasePort(s.port)
+		s.port = nil
+	}
 }
 
 const separator = "___"
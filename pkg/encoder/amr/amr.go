@@ -0,0 +1,26 @@
+// Implements cgo bindings for opencore-amrnb and vo-amrwbenc encoders.
+// 输出为rfc4867 storage格式的单帧, 首字节为ToC.
+package amr
+
+import "encoding/binary"
+
+// 每帧20ms.
+const (
+	FrameMs        = 20
+	NbSampleRate   = 8000
+	WbSampleRate   = 16000
+	nbFrameSamples = NbSampleRate * FrameMs / 1000
+	wbFrameSamples = WbSampleRate * FrameMs / 1000
+	maxFrameBytes  = 64
+)
+
+// 16bit小端pcm转成采样.
+func toSamples(input []byte, samples []int16) bool {
+	if len(input) != len(samples)*2 {
+		return false
+	}
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(input[2*i:]))
+	}
+	return true
+}
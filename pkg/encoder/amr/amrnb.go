@@ -0,0 +1,65 @@
+package amr
+
+/*
+#cgo pkg-config: opencore-amrnb
+#cgo CFLAGS: -Wall -O3
+
+#include <stdlib.h>
+#include <opencore-amrnb/interf_enc.h>
+*/
+import "C"
+import (
+	"errors"
+	"unsafe"
+)
+
+// AMR-NB码率模式, enum Mode.
+const (
+	NbMR475 = C.MR475
+	NbMR515 = C.MR515
+	NbMR59  = C.MR59
+	NbMR67  = C.MR67
+	NbMR74  = C.MR74
+	NbMR795 = C.MR795
+	NbMR102 = C.MR102
+	NbMR122 = C.MR122
+)
+
+type NbEncoder struct {
+	state   unsafe.Pointer
+	mode    C.enum_Mode
+	samples [nbFrameSamples]int16
+	out     [maxFrameBytes]byte
+}
+
+func NewNbEncoder(mode int, dtx bool) (*NbEncoder, error) {
+	d := C.int(0)
+	if dtx {
+		d = 1
+	}
+	state := C.Encoder_Interface_init(d)
+	if state == nil {
+		return nil, errors.New("amr: Encoder_Interface_init failed")
+	}
+	return &NbEncoder{state: state, mode: C.enum_Mode(mode)}, nil
+}
+
+// Encode 输入160个采样.
+func (e *NbEncoder) Encode(input []byte) []byte {
+	if e.state == nil || !toSamples(input, e.samples[:]) {
+		return nil
+	}
+	n := C.Encoder_Interface_Encode(e.state, e.mode, (*C.short)(unsafe.Pointer(&e.samples[0])), (*C.uchar)(unsafe.Pointer(&e.out[0])), 0)
+	if n <= 0 {
+		return nil
+	}
+	return append([]byte(nil), e.out[:n]...)
+}
+
+func (e *NbEncoder) Shutdown() error {
+	if e.state != nil {
+		C.Encoder_Interface_exit(e.state)
+		e.state = nil
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package amr
+
+/*
+#cgo pkg-config: vo-amrwbenc
+#cgo CFLAGS: -Wall -O3
+
+#include <stdlib.h>
+#include <vo-amrwbenc/enc_if.h>
+*/
+import "C"
+import (
+	"errors"
+	"unsafe"
+)
+
+// AMR-WB码率模式, 0:6.60k ... 8:23.85k.
+const (
+	WbMode660  = 0
+	WbMode885  = 1
+	WbMode1265 = 2
+	WbMode1425 = 3
+	WbMode1585 = 4
+	WbMode1825 = 5
+	WbMode1985 = 6
+	WbMode2305 = 7
+	WbMode2385 = 8
+)
+
+type WbEncoder struct {
+	state   unsafe.Pointer
+	mode    C.int
+	dtx     C.int
+	samples [wbFrameSamples]int16
+	out     [maxFrameBytes]byte
+}
+
+func NewWbEncoder(mode int, dtx bool) (*WbEncoder, error) {
+	state := C.E_IF_init()
+	if state == nil {
+		return nil, errors.New("amr: E_IF_init failed")
+	}
+	e := &WbEncoder{state: state, mode: C.int(mode)}
+	if dtx {
+		e.dtx = 1
+	}
+	return e, nil
+}
+
+// Encode 输入320个采样.
+func (e *WbEncoder) Encode(input []byte) []byte {
+	if e.state == nil || !toSamples(input, e.samples[:]) {
+		return nil
+	}
+	n := C.E_IF_encode(e.state, e.mode, (*C.short)(unsafe.Pointer(&e.samples[0])), (*C.uchar)(unsafe.Pointer(&e.out[0])), e.dtx)
+	if n <= 0 {
+		return nil
+	}
+	return append([]byte(nil), e.out[:n]...)
+}
+
+func (e *WbEncoder) Shutdown() error {
+	if e.state != nil {
+		C.E_IF_exit(e.state)
+		e.state = nil
+	}
+	return nil
+}
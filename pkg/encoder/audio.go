@@ -0,0 +1,164 @@
+package encoder
+
+import (
+	"encoding/binary"
+	"xmediaEmu/pkg/log"
+)
+
+type AudioPipe struct {
+	Input  chan []int16
+	Output chan OutFrame
+	done   chan struct{}
+
+	encoder Encoder
+
+	srcRate, srcChannels int
+	dstRate, dstChannels int
+	frameSamples         int // 每帧每声道采样数.
+
+	resampler []*resampler
+	buf       []int16 // 未满一帧的缓存, 交错存放.
+	timestamp uint32  // rtp时间戳, 按采样数递增.
+}
+
+// NewAudioPipe returns new audio encoder pipe.
+// It waits for interleaved 16bit pcm on the input channel,
+// mixes and resamples it into dstRate/dstChannels,
+// cuts it into frame ms frames, encodes every frame with provided encoder,
+// and puts the result into the output channel.
+func NewAudioPipe(enc Encoder, srcRate, srcChannels, dstRate, dstChannels, frame int) *AudioPipe {
+	if dstChannels <= 0 {
+		dstChannels = 1
+	}
+	ap := &AudioPipe{
+		Input:  make(chan []int16, 30),
+		Output: make(chan OutFrame, 30),
+		done:   make(chan struct{}),
+
+		encoder: enc,
+
+		srcRate:      srcRate,
+		srcChannels:  srcChannels,
+		dstRate:      dstRate,
+		dstChannels:  dstChannels,
+		frameSamples: dstRate * frame / 1000,
+	}
+	for i := 0; i < dstChannels; i++ {
+		ap.resampler = append(ap.resampler, newResampler(srcRate, dstRate))
+	}
+	return ap
+}
+
+// Start begins audio encoding pipe.
+// Should be wrapped into a goroutine.
+func (ap *AudioPipe) Start() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Logger.Error("Warn: Recovered panic in audio encoding ", r)
+		}
+		close(ap.Output)
+		close(ap.done)
+	}()
+
+	frameLen := ap.frameSamples * ap.dstChannels
+	for pcm := range ap.Input {
+		ap.buf = append(ap.buf, ap.convert(pcm)...)
+		for len(ap.buf) >= frameLen {
+			ap.encode(ap.buf[:frameLen])
+			ap.buf = append(ap.buf[:0], ap.buf[frameLen:]...)
+		}
+	}
+}
+
+func (ap *AudioPipe) Stop() {
+	close(ap.Input)
+	<-ap.done
+	if err := ap.encoder.Shutdown(); err != nil {
+		log.Logger.Error("error: failed to close the audio encoder")
+	}
+}
+
+func (ap *AudioPipe) encode(samples []int16) {
+	data := make([]byte, len(samples)*2)
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(s))
+	}
+	frame := ap.encoder.Encode(data)
+	if len(frame) > 0 {
+		ap.Output <- OutFrame{Data: frame, Timestamp: ap.timestamp}
+	}
+	ap.timestamp += uint32(ap.frameSamples)
+}
+
+// convert 声道混合后按声道重采样, 返回交错的pcm.
+func (ap *AudioPipe) convert(pcm []int16) []int16 {
+	srcChannels := ap.srcChannels
+	if srcChannels <= 0 {
+		srcChannels = 1
+	}
+	n := len(pcm) / srcChannels
+
+	var out []int16
+	channel := make([]int16, n)
+	for c := 0; c < ap.dstChannels; c++ {
+		for i := 0; i < n; i++ {
+			frame := pcm[i*srcChannels : (i+1)*srcChannels]
+			switch {
+			case ap.dstChannels == 1 && srcChannels > 1: // 下混成单声道.
+				sum := 0
+				for _, s := range frame {
+					sum += int(s)
+				}
+				channel[i] = int16(sum / srcChannels)
+			case c < srcChannels:
+				channel[i] = frame[c]
+			default:
+				channel[i] = frame[srcChannels-1]
+			}
+		}
+
+		resampled := ap.resampler[c].process(channel)
+		if out == nil {
+			out = make([]int16, len(resampled)*ap.dstChannels)
+		}
+		for i := 0; i < len(resampled) && i*ap.dstChannels+c < len(out); i++ {
+			out[i*ap.dstChannels+c] = resampled[i]
+		}
+	}
+	return out
+}
+
+// 单声道线性插值重采样, 跨输入块保留状态.
+type resampler struct {
+	from, to int
+	pos      float64 // 下一个输出点, 相对于last的位置.
+	last     int16
+	hasLast  bool
+}
+
+func newResampler(from, to int) *resampler {
+	return &resampler{from: from, to: to}
+}
+
+func (r *resampler) process(in []int16) []int16 {
+	if r.from == r.to || r.from <= 0 || r.to <= 0 || len(in) == 0 {
+		return append([]int16(nil), in...)
+	}
+
+	src := in
+	if r.hasLast {
+		src = append([]int16{r.last}, in...)
+	}
+	step := float64(r.from) / float64(r.to)
+	out := make([]int16, 0, int(float64(len(src))/step)+1)
+	for r.pos+1 < float64(len(src)) {
+		i := int(r.pos)
+		frac := r.pos - float64(i)
+		out = append(out, int16(float64(src[i])*(1-frac)+float64(src[i+1])*frac))
+		r.pos += step
+	}
+	r.pos -= float64(len(src) - 1)
+	r.last = src[len(src)-1]
+	r.hasLast = true
+	return out
+}
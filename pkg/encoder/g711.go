@@ -0,0 +1,14 @@
+package encoder
+
+import "xmediaEmu/pkg/audio/g711"
+
+// G711Encoder 输出PCMU/PCMA.
+type G711Encoder struct {
+	law g711.Law
+}
+
+func NewG711Encoder(law g711.Law) *G711Encoder { return &G711Encoder{law: law} }
+
+func (e *G711Encoder) Encode(input []byte) []byte { return e.law.Encode(input) }
+
+func (e *G711Encoder) Shutdown() error { return nil }
@@ -4,6 +4,7 @@ import "C"
 import (
 	"fmt"
 	"github.com/pterm/pterm"
+	"sync/atomic"
 )
 
 // 利用x264进行转换.
@@ -19,6 +20,9 @@ type H264 struct {
 
 	// keep monotonic pts to suppress warnings
 	pts int64
+
+	// 下一帧强制IDR, 原子操作, 其他协程请求.
+	forceIdr int32
 }
 
 func NewEncoder(width, height int, options ...Option) (encoder *H264, err error) {
@@ -115,11 +119,13 @@ func (e *H264) Encode(yuv []byte) []byte {
 	picIn.Img.Plane[2] = C.CBytes(yuv[e.lumaSize+e.chromaSize:])
 
 	picIn.IPts = e.pts
-
-	// every image is key frame.
-	picIn.BKeyframe = 1
 	e.pts++
 
+	// 正常按GOP编码, 对端请求时强制IDR.
+	if atomic.CompareAndSwapInt32(&e.forceIdr, 1, 0) {
+		picIn.IType = TypeIdr
+	}
+
 	defer func() {
 		picIn.freePlane(0)
 		picIn.freePlane(1)
@@ -138,6 +144,11 @@ func (e *H264) Encode(yuv []byte) []byte {
 	return []byte{}
 }
 
+// RequestKeyframe 下一帧编码为IDR, BRepeatHeaders带上sps/pps.
+func (e *H264) RequestKeyframe() {
+	atomic.StoreInt32(&e.forceIdr, 1)
+}
+
 // outputs SPS/PPS/SEI.
 func (e *H264) EncodeHeader() []byte {
 	// 返回sps和pps头部.
@@ -0,0 +1,16 @@
+package encoder
+
+// PcmEncoder 输出L16, rtp要求网络字节序.
+type PcmEncoder struct{}
+
+func NewPcmEncoder() *PcmEncoder { return &PcmEncoder{} }
+
+func (e *PcmEncoder) Encode(input []byte) []byte {
+	out := make([]byte, len(input)&^1)
+	for i := 0; i+1 < len(input); i += 2 {
+		out[i], out[i+1] = input[i+1], input[i]
+	}
+	return out
+}
+
+func (e *PcmEncoder) Shutdown() error { return nil }
@@ -72,6 +72,13 @@ func (vp *VideoPipe) Start() {
 	// else to do?.
 }
 
+// RequestKeyframe 请求下一帧为关键帧, 编码器不支持时忽略.
+func (vp *VideoPipe) RequestKeyframe() {
+	if r, ok := vp.encoder.(KeyframeRequester); ok {
+		r.RequestKeyframe()
+	}
+}
+
 func (vp *VideoPipe) Stop() {
 	close(vp.Input)
 	<-vp.done
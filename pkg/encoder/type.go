@@ -17,3 +17,7 @@ type Encoder interface {
 	Shutdown() error
 }
 
+// KeyframeRequester 支持按需输出关键帧的编码器.
+type KeyframeRequester interface {
+	RequestKeyframe()
+}
@@ -0,0 +1,27 @@
+package inpututil
+
+// dtmf按键到键盘按键, 数字用主键盘数字键, *用小键盘乘号, #作为确认用回车, A-D用字母键.
+var dtmfKeys = map[rune]Key{
+	'0': KeyDigit0,
+	'1': KeyDigit1,
+	'2': KeyDigit2,
+	'3': KeyDigit3,
+	'4': KeyDigit4,
+	'5': KeyDigit5,
+	'6': KeyDigit6,
+	'7': KeyDigit7,
+	'8': KeyDigit8,
+	'9': KeyDigit9,
+	'*': KeyNumpadMultiply,
+	'#': KeyEnter,
+	'A': KeyA,
+	'B': KeyB,
+	'C': KeyC,
+	'D': KeyD,
+}
+
+// DtmfKey returns the key of a DTMF digit (0-9, *, #, A-D).
+func DtmfKey(digit rune) (Key, bool) {
+	key, ok := dtmfKeys[digit]
+	return key, ok
+}
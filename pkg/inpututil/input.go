@@ -46,10 +46,9 @@ func  (i *Input) IsKeyPressed(key Key) bool {
 	if !key.isValid() {
 		return false
 	}
-	inputKey := i.Get()
-	if !inputKey.isValid() {
-		return false
-	}
+	// 只读Update之后的状态, 不消费keyBuffer.
+	i.m.RLock()
+	defer i.m.RUnlock()
 
 	var keys []Key
 	switch key {
@@ -65,12 +64,7 @@ func  (i *Input) IsKeyPressed(key Key) bool {
 		keys = []Key{Key(key)}
 	}
 	for _, k := range keys {
-		if i.keyPressed == nil {
-			i.keyPressed = map[Key]bool{}
-			return false
-		}
-
-		if i.keyPressed[k] == true {
+		if i.keyPressed[k] {
 			return true
 		}
 
@@ -99,7 +93,9 @@ func (i *Input) Get()  Key {
 
 // reset for Update.
 func (i *Input) ResetForTick() {
+	i.m.Lock()
 	i.scrollX, i.scrollY = 0, 0
+	i.m.Unlock()
 }
 
 
@@ -124,37 +120,44 @@ func (i *Input) ResetForTick() {
 //	return false
 //}
 func (i *Input) CursorPosition() (x, y int) {
+	i.m.RLock()
+	defer i.m.RUnlock()
 	return i.cursorX, i.cursorY
 }
 
 // set by external
 func (i *Input) SetCursorPosition(x, y int) {
+	i.m.Lock()
 	i.cursorX = x
 	i.cursorY = y
+	i.m.Unlock()
 }
 
 // set by external
+// 向上滚动yoff为正, 每个tick后清零.
 func (i *Input) SetScrollOffSet(xoff, yoff float64) {
+	i.m.Lock()
 	i.scrollX = xoff
 	i.scrollY = yoff
+	i.m.Unlock()
 }
 
 func (i *Input) Wheel() (float64, float64) {
+	i.m.RLock()
+	defer i.m.RUnlock()
 	return i.scrollX, i.scrollY
 }
 
 // Update must be called from the main thread.
-// not call yet.
-// nothing to do.
-// 主循环中update, 更新按键状态...
+// 主循环中每个tick update一次, 更新按键状态...
 func (i *Input) Update() error {
+	i.m.Lock()
+	defer i.m.Unlock()
+
 	if i.keyPressed == nil {
 		i.keyPressed = map[Key]bool{}
 	}
 
-	i.m.Lock()
-	defer i.m.Unlock()
-
 	for key:=KeyA; key < KeyMax; key++ {
 		i.keyPressed[key] = false
 	}
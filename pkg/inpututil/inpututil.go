@@ -3,7 +3,6 @@ package inpututil
 import (
 	"errors"
 	"sync"
-	"xmediaEmu/pkg/hooks"
 )
 
 // 支持整数，字符串和结构体输入.
@@ -24,25 +23,13 @@ type InputManager struct {
 	// struct输入, TODO:暂时用不到.
 	structInput *InputSequence
 
-	m sync.RWMutex // 所有输入的锁.
-}
+	// 通话方语音输入.
+	voiceInput *VoiceInput
 
-// input管理默认只要有一个.
-var theInputState = NewInputMgr()
-
-func init() {
-	// 自动开启？..
-	hooks.AppendHookOnBeforeUpdate(func() error {
-		theInputState.Update()
-		return nil
-	})
-}
-
-// DefaultMgr
-func DefaultMgr() *InputManager {
-	return theInputState
+	m sync.RWMutex // 所有输入的锁.
 }
 
+// NewInputMgr 每个UserInterface各自一个, 不同room的输入互不影响.
 func NewInputMgr() *InputManager {
 	return &InputManager{
 		keyDurations:     make([]int, KeyMax+1),
@@ -52,6 +39,7 @@ func NewInputMgr() *InputManager {
 		input:       NewInput(),
 		stringInput: NewInputSequence(),
 		structInput: NewInputSequence(),
+		voiceInput:  NewVoiceInput(),
 	}
 }
 
@@ -63,19 +51,27 @@ func (i *InputManager) GetStringInput() *InputSequence {
 	return i.stringInput
 }
 
+func (i *InputManager) GetVoiceInput() *VoiceInput {
+	return i.voiceInput
+}
+
 func (i *InputManager) SetFpsMode(mode FPSModeType) {
 	i.fpsMode = mode
 }
 
 // 统一接口.
 func (i *InputManager) SendInput(input interface{}) error {
-	switch input.(type) {
+	switch v := input.(type) {
+	case Key:
+		i.input.InputKey(v)
 	case int:
-		i.input.InputKey(input.(Key))
+		i.input.InputKey(Key(v))
 	case string:
 		i.stringInput.InputKeySeq(input)
 	case struct{}:
 		i.structInput.InputKeySeq(input)
+	case Voice:
+		i.voiceInput.InputVoice(v)
 	default:
 		return errors.New("Unknown inputs. ")
 	}
@@ -90,6 +86,9 @@ func (i *InputManager) Update() error {
 	if err := i.input.Update(); err != nil {
 		return err
 	}
+	if err := i.voiceInput.Update(); err != nil {
+		return err
+	}
 	if i.fpsMode > FPSIntOnly {
 		if err := i.stringInput.Update(); err != nil {
 			return err
@@ -115,6 +114,13 @@ func (i *InputManager) Update() error {
 	return nil
 }
 
+// VoiceFrames returns caller voice received in the current frame.
+//
+// VoiceFrames is concurrent safe.
+func (i *InputManager) VoiceFrames() []Voice {
+	return i.voiceInput.Frames()
+}
+
 // AppendPressedKeys append currently pressed keyboard keys to keys and returns the extended buffer.
 // Giving a slice that already has enough capacity works efficiently.
 // AppendPressedKeys is concurrent safe.
@@ -0,0 +1,59 @@
+package inpututil
+
+import (
+	"common/util/mem"
+	"sync"
+)
+
+// 最多缓存1s的20ms语音帧, 超过丢弃最早的.
+const _maxVoiceBuffs = 50
+
+// Voice 通话方的语音输入, 16bit小端单声道pcm.
+type Voice struct {
+	PCM        []byte
+	SampleRate int
+	Timestamp  uint32 // rtp时间戳.
+	ConnID     string // 哪一路通话.
+}
+
+// 语音输入, 每个tick取出期间收到的所有语音帧.
+type VoiceInput struct {
+	frames []Voice
+	// input list.
+	voiceBuffer *mem.Deque
+	m           sync.RWMutex
+}
+
+func NewVoiceInput() *VoiceInput {
+	return &VoiceInput{voiceBuffer: mem.New(_maxVoiceBuffs)}
+}
+
+// InputVoice 不阻塞, 满了丢弃最早的帧.
+func (i *VoiceInput) InputVoice(voice Voice) {
+	i.m.Lock()
+	for i.voiceBuffer.Len() >= _maxVoiceBuffs {
+		i.voiceBuffer.PopFront()
+	}
+	i.voiceBuffer.PushBack(voice)
+	i.m.Unlock()
+}
+
+// 主循环中update, 取出上一个tick以来的语音.
+func (i *VoiceInput) Update() error {
+	i.m.Lock()
+	defer i.m.Unlock()
+
+	i.frames = i.frames[:0]
+	for i.voiceBuffer.Len() > 0 {
+		i.frames = append(i.frames, i.voiceBuffer.PopFront().(Voice))
+	}
+	return nil
+}
+
+// Frames returns voice frames received in the current tick.
+// 返回的切片只在下一个tick前有效.
+func (i *VoiceInput) Frames() []Voice {
+	i.m.RLock()
+	defer i.m.RUnlock()
+	return i.frames
+}
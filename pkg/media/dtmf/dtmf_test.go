@@ -0,0 +1,101 @@
+package dtmf_test
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"xmediaEmu/pkg/media/dtmf"
+)
+
+func TestParseEvent(t *testing.T) {
+	e, err := dtmf.ParseEvent([]byte{0x0b, 0x8a, 0x03, 0x20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Event != 11 || !e.End || e.Volume != 10 || e.Duration != 800 {
+		t.Fatalf("got %+v", e)
+	}
+	if d, ok := e.Digit(); !ok || d != '#' {
+		t.Errorf("digit got %c", d)
+	}
+	if b := e.Marshal(); string(b) != "\x0b\x8a\x03\x20" {
+		t.Errorf("marshal got %x", b)
+	}
+	if _, ok := (dtmf.Event{Event: 16}).Digit(); ok {
+		t.Error("flash should not be a digit")
+	}
+	if _, err := dtmf.ParseEvent([]byte{1, 2}); err != dtmf.ErrShortEvent {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	var r dtmf.Receiver
+	var got []rune
+	packets := []struct {
+		ts    uint32
+		event dtmf.Event
+	}{
+		{1000, dtmf.Event{Event: 1, Duration: 160}},
+		{1000, dtmf.Event{Event: 1, Duration: 320}},
+		{1000, dtmf.Event{Event: 1, End: true, Duration: 480}},
+		{1000, dtmf.Event{Event: 1, End: true, Duration: 480}},
+		{2000, dtmf.Event{Event: 10, Duration: 160}},
+		{3000, dtmf.Event{Event: 15, End: true, Duration: 160}},
+	}
+	for _, p := range packets {
+		if d, ok := r.Push(p.ts, p.event.Marshal()); ok {
+			got = append(got, d)
+		}
+	}
+	if string(got) != "1*D" {
+		t.Errorf("got %q", string(got))
+	}
+}
+
+// tone 生成双音pcm, 幅度各为amp.
+func tone(sampleRate int, d float64, amp float64, freqs ...float64) []byte {
+	n := int(d * float64(sampleRate))
+	pcm := make([]byte, n*2)
+	for i := 0; i < n; i++ {
+		var v float64
+		for _, f := range freqs {
+			v += amp * math.Sin(2*math.Pi*f*float64(i)/float64(sampleRate))
+		}
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(int16(v)))
+	}
+	return pcm
+}
+
+func TestDetector(t *testing.T) {
+	for _, rate := range []int{8000, 16000} {
+		d := dtmf.NewDetector(rate)
+		var got []rune
+		input := [][]byte{
+			tone(rate, 0.1, 5000, 770, 1336), // 5
+			tone(rate, 0.05, 0),
+			tone(rate, 0.1, 5000, 941, 1477), // #
+			tone(rate, 0.05, 0),
+			tone(rate, 0.1, 5000, 1000),       // 单音
+			tone(rate, 0.1, 50, 697, 1209),    // 太小
+			tone(rate, 0.2, 3000, 852, 1633),  // C, 长按只报一次
+			tone(rate, 0.02, 3000, 697, 1209), // 太短
+		}
+		for _, pcm := range input {
+			// 按20ms一帧输入.
+			frame := rate / 50 * 2
+			for len(pcm) > 0 {
+				n := frame
+				if n > len(pcm) {
+					n = len(pcm)
+				}
+				got = append(got, d.Process(pcm[:n])...)
+				pcm = pcm[n:]
+			}
+		}
+		if string(got) != "5#C" {
+			t.Errorf("%d: got %q", rate, string(got))
+		}
+	}
+}
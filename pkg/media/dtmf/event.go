@@ -0,0 +1,74 @@
+// Package dtmf decodes RFC 4733 telephone-events and detects in-band DTMF tones.
+package dtmf
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const eventLen = 4
+
+var ErrShortEvent = errors.New("dtmf: telephone-event payload too short")
+
+// 事件0-15对应的按键, rfc4733 3.2.
+const digits = "0123456789*#ABCD"
+
+// Event is a telephone-event payload, rfc4733 2.3.
+type Event struct {
+	Event    uint8
+	End      bool
+	Volume   uint8  // 0~63, 单位-dBm0.
+	Duration uint16 // rtp时间戳单位.
+}
+
+// ParseEvent parses the payload of a telephone-event rtp packet.
+func ParseEvent(payload []byte) (Event, error) {
+	if len(payload) < eventLen {
+		return Event{}, ErrShortEvent
+	}
+	return Event{
+		Event:    payload[0],
+		End:      payload[1]&0x80 != 0,
+		Volume:   payload[1] & 0x3f,
+		Duration: binary.BigEndian.Uint16(payload[2:]),
+	}, nil
+}
+
+// Marshal returns the payload of the event.
+func (e Event) Marshal() []byte {
+	b := make([]byte, eventLen)
+	b[0] = e.Event
+	b[1] = e.Volume & 0x3f
+	if e.End {
+		b[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(b[2:], e.Duration)
+	return b
+}
+
+// Digit 0-9 * # A-D, 其他事件(如flash)返回false.
+func (e Event) Digit() (rune, bool) {
+	if int(e.Event) >= len(digits) {
+		return 0, false
+	}
+	return rune(digits[e.Event]), true
+}
+
+// Receiver 去重, 同一个事件的所有包(包括重发3次的结束包)时间戳相同, 只在第一个包时上报.
+type Receiver struct {
+	timestamp uint32
+	started   bool
+}
+
+// Push 输入一个telephone-event包, 新按键时返回true.
+func (r *Receiver) Push(timestamp uint32, payload []byte) (rune, bool) {
+	e, err := ParseEvent(payload)
+	if err != nil {
+		return 0, false
+	}
+	if r.started && timestamp == r.timestamp {
+		return 0, false
+	}
+	r.timestamp, r.started = timestamp, true
+	return e.Digit()
+}
@@ -0,0 +1,133 @@
+package dtmf
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	// 8k时205个采样一块, 频率分辨率约39Hz.
+	blockSize8k = 205
+	// 连续两块检测到才算按下, 约50ms.
+	minBlocks = 2
+	// 行列两个频率的能量占比, 纯双音时约为1.
+	minToneRatio = 0.7
+	// 行列能量比, 约8dB.
+	maxTwist = 6.3
+	// 最强频率比次强的能量倍数.
+	minPeakRatio = 4
+	// 最小rms, 太小的当作静音.
+	minLevel = 100
+)
+
+var (
+	rowFreqs = [4]float64{697, 770, 852, 941}
+	colFreqs = [4]float64{1209, 1336, 1477, 1633}
+	keypad   = [4]string{"123A", "456B", "789C", "*0#D"}
+)
+
+// Detector 用Goertzel算法检测带内DTMF, 输入16bit小端单声道pcm.
+type Detector struct {
+	block   int
+	rows    [4]float64 // goertzel系数.
+	cols    [4]float64
+	samples []float64
+
+	last     rune // 上一块检测到的按键.
+	count    int  // 连续检测到的块数.
+	reported bool
+}
+
+// NewDetector 按采样率创建, 块长度和8k时的时长相同.
+func NewDetector(sampleRate int) *Detector {
+	if sampleRate <= 0 {
+		sampleRate = 8000
+	}
+	d := &Detector{block: blockSize8k * sampleRate / 8000}
+	for i := range rowFreqs {
+		d.rows[i] = 2 * math.Cos(2*math.Pi*rowFreqs[i]/float64(sampleRate))
+		d.cols[i] = 2 * math.Cos(2*math.Pi*colFreqs[i]/float64(sampleRate))
+	}
+	d.samples = make([]float64, 0, d.block)
+	return d
+}
+
+// Process 输入pcm, 返回这段时间内新按下的按键.
+func (d *Detector) Process(pcm []byte) []rune {
+	var keys []rune
+	for i := 0; i+1 < len(pcm); i += 2 {
+		d.samples = append(d.samples, float64(int16(binary.LittleEndian.Uint16(pcm[i:]))))
+		if len(d.samples) < d.block {
+			continue
+		}
+		if key, ok := d.update(d.detect()); ok {
+			keys = append(keys, key)
+		}
+		d.samples = d.samples[:0]
+	}
+	return keys
+}
+
+// update 连续minBlocks块是同一个按键时上报一次, 松开后才能再次上报.
+func (d *Detector) update(key rune) (rune, bool) {
+	if key == 0 || key != d.last {
+		d.last, d.count, d.reported = key, 0, false
+		if key == 0 {
+			return 0, false
+		}
+	}
+	d.count++
+	if d.count >= minBlocks && !d.reported {
+		d.reported = true
+		return key, true
+	}
+	return 0, false
+}
+
+// detect 检测当前块, 没有时返回0.
+func (d *Detector) detect() rune {
+	var energy float64
+	for _, s := range d.samples {
+		energy += s * s
+	}
+	n := float64(len(d.samples))
+	if energy < minLevel*minLevel*n {
+		return 0
+	}
+
+	row, rowPower, rowSecond := d.strongest(d.rows)
+	col, colPower, colSecond := d.strongest(d.cols)
+	if rowPower < minPeakRatio*rowSecond || colPower < minPeakRatio*colSecond {
+		return 0
+	}
+	if rowPower > maxTwist*colPower || colPower > maxTwist*rowPower {
+		return 0
+	}
+	// 归一化, 幅度A的正弦能量为(A*n/2)^2, 总能量n*A^2/2.
+	if 2*(rowPower+colPower)/(energy*n) < minToneRatio {
+		return 0
+	}
+	return rune(keypad[row][col])
+}
+
+// strongest 返回最强的频率下标、能量和次强能量.
+func (d *Detector) strongest(coeffs [4]float64) (int, float64, float64) {
+	index, first, second := 0, 0.0, 0.0
+	for i, coeff := range coeffs {
+		p := goertzel(d.samples, coeff)
+		if p > first {
+			index, first, second = i, p, first
+		} else if p > second {
+			second = p
+		}
+	}
+	return index, first, second
+}
+
+func goertzel(samples []float64, coeff float64) float64 {
+	var s1, s2 float64
+	for _, x := range samples {
+		s1, s2 = x+coeff*s1-s2, s1
+	}
+	return s1*s1 + s2*s2 - coeff*s1*s2
+}
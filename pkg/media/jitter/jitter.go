@@ -0,0 +1,325 @@
+// Package jitter implements an adaptive jitter buffer for inbound RTP audio.
+// 按序号重排, 按到达抖动调整播放延迟, 输出固定长度的16bit pcm帧, 丢包时做PLC或舒适噪声.
+package jitter
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSampleRate = 8000
+	defaultFrame      = 20 * time.Millisecond
+	defaultMinDelay   = 40 * time.Millisecond
+	defaultMaxDelay   = 200 * time.Millisecond
+
+	// 连续多帧延迟偏大时丢一帧, 降低延迟.
+	shrinkAfter = 50
+	// 丢包补偿最多重复的时长, 之后用舒适噪声.
+	plcDuration = 60 * time.Millisecond
+)
+
+// Kind 输出帧的来源.
+type Kind int
+
+const (
+	Normal    Kind = iota // 收到的语音.
+	Concealed             // 丢包补偿, 重复上一帧并衰减.
+	Noise                 // 舒适噪声.
+)
+
+// Config 采样率和帧长决定输出帧大小, 播放延迟在MinDelay和MaxDelay之间按抖动调整.
+type Config struct {
+	SampleRate int
+	Frame      time.Duration
+	MinDelay   time.Duration
+	MaxDelay   time.Duration
+}
+
+// Frame 一帧输出, Timestamp为第一个采样的rtp时间戳.
+type Frame struct {
+	PCM       []byte
+	Timestamp uint32
+	Kind      Kind
+}
+
+// Stats 统计.
+type Stats struct {
+	Received  uint32
+	Late      uint32 // 已经播放过才到达, 丢弃.
+	Duplicate uint32
+	Lost      uint32 // 播放时序号缺失.
+	Dropped   uint32 // 延迟过大丢弃.
+	Concealed uint32 // PLC帧数.
+	Noise     uint32 // 舒适噪声帧数.
+	Jitter    time.Duration
+	Delay     time.Duration // 当前目标延迟.
+}
+
+type packet struct {
+	seq       uint64 // 扩展序号.
+	timestamp uint32
+	pcm       []byte
+}
+
+// Buffer is safe for one producer calling Push and one consumer calling Pop every Config.Frame.
+type Buffer struct {
+	mu  sync.Mutex
+	cfg Config
+
+	frameBytes int
+	packets    []packet // 按扩展序号升序.
+	maxSeq     uint64
+	haveSeq    bool
+
+	started bool   // 已经开始播放.
+	waiting bool   // 预缓冲, 缓冲够目标延迟再播放.
+	next    uint64 // 下一个播放的扩展序号.
+	pending []byte // 已出队还没输出的pcm.
+	playout uint32 // pending第一个采样的时间戳.
+	over    int    // 连续延迟偏大的帧数.
+
+	plc plc
+
+	transit     int64
+	haveTransit bool
+	jitter      float64 // 采样数.
+	stats       Stats
+}
+
+// New 创建jitter buffer, 未设置的参数用默认值.
+func New(cfg Config) *Buffer {
+	if cfg.SampleRate <= 0 {
+		cfg.SampleRate = defaultSampleRate
+	}
+	if cfg.Frame <= 0 {
+		cfg.Frame = defaultFrame
+	}
+	if cfg.MinDelay <= 0 {
+		cfg.MinDelay = defaultMinDelay
+	}
+	if cfg.MaxDelay < cfg.MinDelay {
+		cfg.MaxDelay = defaultMaxDelay
+		if cfg.MaxDelay < cfg.MinDelay {
+			cfg.MaxDelay = cfg.MinDelay
+		}
+	}
+	b := &Buffer{cfg: cfg, waiting: true}
+	b.frameBytes = b.bytes(cfg.Frame)
+	b.plc.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	b.plc.limit = b.bytes(plcDuration)
+	b.stats.Delay = cfg.MinDelay
+	return b
+}
+
+// FrameBytes 每帧pcm字节数.
+func (b *Buffer) FrameBytes() int {
+	return b.frameBytes
+}
+
+func (b *Buffer) bytes(d time.Duration) int {
+	return int(d.Seconds()*float64(b.cfg.SampleRate)) * 2
+}
+
+// Push 放入一个解码后的包, pcm为16bit小端.
+func (b *Buffer) Push(seq uint16, timestamp uint32, pcm []byte, arrival time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stats.Received++
+	b.updateJitter(timestamp, arrival)
+
+	ext := b.extend(seq)
+	if b.started && ext < b.next {
+		b.stats.Late++
+		return
+	}
+	// 按序号插入, 一般都在末尾.
+	i := len(b.packets)
+	for i > 0 && b.packets[i-1].seq >= ext {
+		if b.packets[i-1].seq == ext {
+			b.stats.Duplicate++
+			return
+		}
+		i--
+	}
+	b.packets = append(b.packets, packet{})
+	copy(b.packets[i+1:], b.packets[i:])
+	b.packets[i] = packet{seq: ext, timestamp: timestamp, pcm: pcm}
+
+	// 超过最大延迟丢弃最旧的.
+	for len(b.packets) > 1 && b.depth() > b.bytes(b.cfg.MaxDelay) {
+		b.drop()
+	}
+}
+
+// extend rfc3550 A.1, 16bit序号扩展成64bit.
+func (b *Buffer) extend(seq uint16) uint64 {
+	if !b.haveSeq {
+		b.haveSeq = true
+		b.maxSeq = uint64(seq) + 1<<16 // 留出回退的余量.
+		return b.maxSeq
+	}
+	ext := b.maxSeq&^0xffff | uint64(seq)
+	if ext+0x8000 < b.maxSeq {
+		ext += 1 << 16
+	} else if ext > b.maxSeq+0x8000 && ext >= 1<<16 {
+		ext -= 1 << 16
+	}
+	if ext > b.maxSeq {
+		b.maxSeq = ext
+	}
+	return ext
+}
+
+// updateJitter rfc3550 A.8, 同时更新目标延迟.
+func (b *Buffer) updateJitter(timestamp uint32, arrival time.Time) {
+	transit := arrival.UnixNano()*int64(b.cfg.SampleRate)/int64(time.Second) - int64(timestamp)
+	if b.haveTransit {
+		d := transit - b.transit
+		if d < 0 {
+			d = -d
+		}
+		// 时间戳跳变(如静音压缩后)不计入.
+		if d < int64(b.cfg.SampleRate) {
+			b.jitter += (float64(d) - b.jitter) / 16
+		}
+	}
+	b.transit, b.haveTransit = transit, true
+
+	b.stats.Jitter = time.Duration(b.jitter / float64(b.cfg.SampleRate) * float64(time.Second))
+	delay := b.cfg.Frame + 3*b.stats.Jitter
+	if delay < b.cfg.MinDelay {
+		delay = b.cfg.MinDelay
+	}
+	if delay > b.cfg.MaxDelay {
+		delay = b.cfg.MaxDelay
+	}
+	b.stats.Delay = delay
+}
+
+// depth 缓冲的pcm字节数.
+func (b *Buffer) depth() int {
+	n := len(b.pending)
+	for _, p := range b.packets {
+		n += len(p.pcm)
+	}
+	return n
+}
+
+// drop 丢弃最旧的包.
+func (b *Buffer) drop() {
+	p := b.packets[0]
+	b.packets = b.packets[1:]
+	if b.started && p.seq >= b.next {
+		b.next = p.seq + 1
+	}
+	b.stats.Dropped++
+}
+
+// Pop 取一帧, 调用方按Config.Frame的间隔调用.
+// 还没收到过语音时返回false, 开始播放后总是返回一帧.
+func (b *Buffer) Pop() (Frame, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.waiting {
+		if len(b.packets) == 0 || b.depth() < b.bytes(b.stats.Delay) {
+			if !b.started {
+				return Frame{}, false
+			}
+			return b.output(b.conceal(b.frameBytes)), true
+		}
+		b.waiting = false
+		if !b.started {
+			b.started, b.next = true, b.packets[0].seq
+		}
+	}
+
+	kind := Normal
+	for len(b.pending) < b.frameBytes {
+		if len(b.packets) == 0 {
+			// 欠载, 重新预缓冲, 相当于加大延迟.
+			b.waiting = true
+			kind = b.plc.kind()
+			b.pending = append(b.pending, b.plc.generate(b.frameBytes-len(b.pending))...)
+			break
+		}
+
+		p := b.packets[0]
+		if p.seq > b.next {
+			// 缺包, 按后一个包的长度补偿.
+			b.stats.Lost++
+			n := len(p.pcm)
+			if n == 0 {
+				n = b.frameBytes
+			}
+			kind = b.plc.kind()
+			b.appendPending(b.plc.generate(n), p.timestamp-uint32(int(p.seq-b.next)*n/2))
+			b.next++
+			continue
+		}
+		b.packets = b.packets[1:]
+		b.next = p.seq + 1
+		b.appendPending(p.pcm, p.timestamp)
+		b.plc.observe(p.pcm)
+	}
+
+	frame := b.output(b.pending[:b.frameBytes], kind)
+	b.pending = append(b.pending[:0], b.pending[b.frameBytes:]...)
+	b.shrink()
+	return frame, true
+}
+
+func (b *Buffer) appendPending(pcm []byte, timestamp uint32) {
+	if len(b.pending) == 0 {
+		b.playout = timestamp
+	}
+	b.pending = append(b.pending, pcm...)
+}
+
+// conceal 没有数据时补偿n字节.
+func (b *Buffer) conceal(n int) ([]byte, Kind) {
+	kind := b.plc.kind()
+	return b.plc.generate(n), kind
+}
+
+// output 生成一帧并推进播放时间戳.
+func (b *Buffer) output(pcm []byte, kind Kind) Frame {
+	switch kind {
+	case Concealed:
+		b.stats.Concealed++
+	case Noise:
+		b.stats.Noise++
+	}
+	frame := Frame{PCM: make([]byte, len(pcm)), Timestamp: b.playout, Kind: kind}
+	copy(frame.PCM, pcm)
+	b.playout += uint32(len(pcm) / 2)
+	return frame
+}
+
+// shrink 持续比目标延迟多出两帧以上时丢一帧.
+func (b *Buffer) shrink() {
+	if b.depth() <= b.bytes(b.stats.Delay)+2*b.frameBytes {
+		b.over = 0
+		return
+	}
+	if b.over++; b.over < shrinkAfter {
+		return
+	}
+	b.over = 0
+	if len(b.pending) >= b.frameBytes {
+		b.pending = append(b.pending[:0], b.pending[b.frameBytes:]...)
+		b.playout += uint32(b.frameBytes / 2)
+	} else if len(b.packets) > 1 {
+		b.drop()
+	}
+}
+
+// Stats returns the buffer statistics.
+func (b *Buffer) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
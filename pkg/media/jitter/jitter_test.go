@@ -0,0 +1,119 @@
+package jitter_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"xmediaEmu/pkg/media/jitter"
+)
+
+// 8k 20ms一个包, 每个包的采样值为序号.
+func pcm(seq uint16) []byte {
+	b := make([]byte, 320)
+	for i := 0; i < len(b); i += 2 {
+		binary.LittleEndian.PutUint16(b[i:], 1000+seq)
+	}
+	return b
+}
+
+func push(b *jitter.Buffer, start time.Time, seqs ...uint16) {
+	for _, seq := range seqs {
+		b.Push(seq, uint32(seq)*160, pcm(seq), start.Add(time.Duration(seq)*20*time.Millisecond))
+	}
+}
+
+func TestReorder(t *testing.T) {
+	b := jitter.New(jitter.Config{})
+	if _, ok := b.Pop(); ok {
+		t.Fatal("empty buffer should not output")
+	}
+	push(b, time.Now(), 1, 3, 2, 2, 4)
+
+	for _, seq := range []uint16{1, 2, 3, 4} {
+		f, ok := b.Pop()
+		if !ok || f.Kind != jitter.Normal || !bytes.Equal(f.PCM, pcm(seq)) || f.Timestamp != uint32(seq)*160 {
+			t.Fatalf("seq %d got kind %d ts %d", seq, f.Kind, f.Timestamp)
+		}
+	}
+	push(b, time.Now(), 3)
+	if s := b.Stats(); s.Duplicate != 1 || s.Late != 1 || s.Lost != 0 {
+		t.Errorf("stats got %+v", s)
+	}
+}
+
+func TestConceal(t *testing.T) {
+	b := jitter.New(jitter.Config{})
+	push(b, time.Now(), 10, 11, 13, 14)
+
+	var kinds []jitter.Kind
+	for i := 0; i < 4; i++ {
+		f, _ := b.Pop()
+		if len(f.PCM) != b.FrameBytes() {
+			t.Fatalf("frame %d size %d", i, len(f.PCM))
+		}
+		kinds = append(kinds, f.Kind)
+		if i == 2 {
+			// 重复上一个包并衰减.
+			first := int16(binary.LittleEndian.Uint16(f.PCM))
+			lastSample := int16(binary.LittleEndian.Uint16(f.PCM[len(f.PCM)-2:]))
+			if first != 1011 || lastSample >= first || lastSample <= 0 {
+				t.Errorf("plc got %d..%d", first, lastSample)
+			}
+		}
+	}
+	want := []jitter.Kind{jitter.Normal, jitter.Normal, jitter.Concealed, jitter.Normal}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("kinds got %v, want %v", kinds, want)
+		}
+	}
+	if s := b.Stats(); s.Lost != 1 || s.Concealed != 1 {
+		t.Errorf("stats got %+v", s)
+	}
+
+	// 长时间没有包, 补偿之后是舒适噪声.
+	var last jitter.Kind
+	for i := 0; i < 10; i++ {
+		f, ok := b.Pop()
+		if !ok {
+			t.Fatal("should keep output after started")
+		}
+		last = f.Kind
+	}
+	if last != jitter.Noise {
+		t.Errorf("got kind %d, want noise", last)
+	}
+}
+
+func TestAdaptiveDelay(t *testing.T) {
+	b := jitter.New(jitter.Config{MinDelay: 20 * time.Millisecond, MaxDelay: 100 * time.Millisecond})
+	start := time.Now()
+	for seq := uint16(0); seq < 50; seq++ {
+		arrival := start.Add(time.Duration(seq) * 20 * time.Millisecond)
+		if seq%2 == 1 {
+			arrival = arrival.Add(30 * time.Millisecond)
+		}
+		b.Push(seq, uint32(seq)*160, pcm(seq), arrival)
+	}
+	s := b.Stats()
+	if s.Jitter < 10*time.Millisecond || s.Delay <= 20*time.Millisecond || s.Delay > 100*time.Millisecond {
+		t.Errorf("jitter %v delay %v", s.Jitter, s.Delay)
+	}
+	// 超过最大延迟的被丢弃.
+	if s.Dropped == 0 {
+		t.Errorf("stats got %+v", s)
+	}
+}
+
+func TestSequenceWrap(t *testing.T) {
+	b := jitter.New(jitter.Config{})
+	push(b, time.Now(), 65534, 0, 65535, 1)
+	for _, seq := range []uint16{65534, 65535, 0, 1} {
+		f, _ := b.Pop()
+		if f.Kind != jitter.Normal || !bytes.Equal(f.PCM, pcm(seq)) {
+			t.Fatalf("seq %d got kind %d", seq, f.Kind)
+		}
+	}
+}
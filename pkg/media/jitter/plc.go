@@ -0,0 +1,76 @@
+package jitter
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+)
+
+// 舒适噪声的最大幅度, 避免把语音当成背景噪声.
+const maxNoiseLevel = 300
+
+// plc 丢包补偿: 先循环重复最近收到的包并线性衰减, 超过limit后输出舒适噪声.
+type plc struct {
+	rand   *rand.Rand
+	last   []byte  // 最近收到的包.
+	offset int     // 重复到last的位置.
+	lost   int     // 连续补偿的字节数.
+	limit  int     // 重复的最大字节数.
+	level  float64 // 背景噪声rms, 跟踪最小能量.
+}
+
+// observe 收到正常的包.
+func (p *plc) observe(pcm []byte) {
+	if len(pcm) < 2 {
+		return
+	}
+	p.last, p.offset, p.lost = pcm, 0, 0
+
+	rms := rms(pcm)
+	if p.level == 0 || rms < p.level {
+		p.level = rms
+	} else {
+		p.level += (rms - p.level) / 64
+	}
+	if p.level > maxNoiseLevel {
+		p.level = maxNoiseLevel
+	}
+}
+
+// kind 下一段补偿的类型.
+func (p *plc) kind() Kind {
+	if p.last == nil || p.lost >= p.limit {
+		return Noise
+	}
+	return Concealed
+}
+
+// generate 生成n字节补偿.
+func (p *plc) generate(n int) []byte {
+	out := make([]byte, n)
+	size := len(p.last) &^ 1
+	for i := 0; i+1 < n; i += 2 {
+		var v float64
+		if size > 0 && p.lost < p.limit {
+			gain := 1 - float64(p.lost)/float64(p.limit)
+			v = float64(int16(binary.LittleEndian.Uint16(p.last[p.offset:]))) * gain
+			p.offset = (p.offset + 2) % size
+		} else {
+			// 均匀分布, rms为level.
+			v = (p.rand.Float64()*2 - 1) * p.level * math.Sqrt(3)
+		}
+		p.lost += 2
+		binary.LittleEndian.PutUint16(out[i:], uint16(int16(v)))
+	}
+	return out
+}
+
+func rms(pcm []byte) float64 {
+	var sum float64
+	n := len(pcm) / 2
+	for i := 0; i < n; i++ {
+		s := float64(int16(binary.LittleEndian.Uint16(pcm[2*i:])))
+		sum += s * s
+	}
+	return math.Sqrt(sum / float64(n))
+}
@@ -0,0 +1,184 @@
+package rtcp
+
+import "encoding/binary"
+
+// SourceDescription is an RTCP SDES, only CNAME is supported.
+type SourceDescription struct {
+	Chunks []SourceDescriptionChunk
+}
+
+type SourceDescriptionChunk struct {
+	Source uint32
+	CNAME  string
+}
+
+func (p *SourceDescription) Marshal() ([]byte, error) {
+	if len(p.Chunks) > maxCount {
+		return nil, ErrTooManyReports
+	}
+	var chunks []byte
+	for _, c := range p.Chunks {
+		cname := c.CNAME
+		if len(cname) > 255 {
+			cname = cname[:255]
+		}
+		chunk := make([]byte, 4, 4+2+len(cname)+4)
+		binary.BigEndian.PutUint32(chunk, c.Source)
+		chunk = append(chunk, sdesCNAME, byte(len(cname)))
+		chunk = append(chunk, cname...)
+		// 结束符, 补齐32bit.
+		chunk = append(chunk, 0)
+		for len(chunk)%4 != 0 {
+			chunk = append(chunk, 0)
+		}
+		chunks = append(chunks, chunk...)
+	}
+	b := newPacket(uint8(len(p.Chunks)), TypeSourceDescription, headerLength+len(chunks))
+	copy(b[headerLength:], chunks)
+	return b, nil
+}
+
+func (p *SourceDescription) Unmarshal(data []byte) error {
+	h, b, err := body(data, TypeSourceDescription)
+	if err != nil {
+		return err
+	}
+	p.Chunks = p.Chunks[:0]
+	for i := 0; i < int(h.Count); i++ {
+		if len(b) < ssrcLength {
+			return ErrPacketTooShort
+		}
+		chunk := SourceDescriptionChunk{Source: binary.BigEndian.Uint32(b)}
+		off := ssrcLength
+		for {
+			if off >= len(b) {
+				return ErrPacketTooShort
+			}
+			typ := b[off]
+			if typ == 0 { // 结束, 跳到下一个32bit边界.
+				off = (off/4 + 1) * 4
+				break
+			}
+			if off+2 > len(b) || off+2+int(b[off+1]) > len(b) {
+				return ErrPacketTooShort
+			}
+			text := b[off+2 : off+2+int(b[off+1])]
+			if typ == sdesCNAME {
+				chunk.CNAME = string(text)
+			}
+			off += 2 + len(text)
+		}
+		p.Chunks = append(p.Chunks, chunk)
+		if off > len(b) {
+			off = len(b)
+		}
+		b = b[off:]
+	}
+	return nil
+}
+
+// Goodbye is an RTCP BYE, reason is ignored.
+type Goodbye struct {
+	Sources []uint32
+}
+
+func (p *Goodbye) Marshal() ([]byte, error) {
+	if len(p.Sources) > maxCount {
+		return nil, ErrTooManyReports
+	}
+	b := newPacket(uint8(len(p.Sources)), TypeGoodbye, headerLength+len(p.Sources)*ssrcLength)
+	for i, s := range p.Sources {
+		binary.BigEndian.PutUint32(b[headerLength+i*ssrcLength:], s)
+	}
+	return b, nil
+}
+
+func (p *Goodbye) Unmarshal(data []byte) error {
+	h, b, err := body(data, TypeGoodbye)
+	if err != nil {
+		return err
+	}
+	if len(b) < int(h.Count)*ssrcLength {
+		return ErrPacketTooShort
+	}
+	p.Sources = make([]uint32, h.Count)
+	for i := range p.Sources {
+		p.Sources[i] = binary.BigEndian.Uint32(b[i*ssrcLength:])
+	}
+	return nil
+}
+
+// PictureLossIndication is an RTCP PLI, rfc4585.
+type PictureLossIndication struct {
+	SenderSSRC uint32
+	MediaSSRC  uint32
+}
+
+func (p *PictureLossIndication) Marshal() ([]byte, error) {
+	b := newPacket(fmtPLI, TypePayloadFeedback, headerLength+2*ssrcLength)
+	binary.BigEndian.PutUint32(b[4:], p.SenderSSRC)
+	binary.BigEndian.PutUint32(b[8:], p.MediaSSRC)
+	return b, nil
+}
+
+func (p *PictureLossIndication) Unmarshal(data []byte) error {
+	h, b, err := body(data, TypePayloadFeedback)
+	if err != nil {
+		return err
+	}
+	if h.Count != fmtPLI {
+		return ErrWrongType
+	}
+	if len(b) < 2*ssrcLength {
+		return ErrPacketTooShort
+	}
+	p.SenderSSRC = binary.BigEndian.Uint32(b)
+	p.MediaSSRC = binary.BigEndian.Uint32(b[4:])
+	return nil
+}
+
+// FullIntraRequest is an RTCP FIR, rfc5104.
+type FullIntraRequest struct {
+	SenderSSRC uint32
+	MediaSSRC  uint32
+	FIR        []FIREntry
+}
+
+type FIREntry struct {
+	SSRC           uint32
+	SequenceNumber uint8
+}
+
+const firEntryLength = 8
+
+func (p *FullIntraRequest) Marshal() ([]byte, error) {
+	b := newPacket(fmtFIR, TypePayloadFeedback, headerLength+2*ssrcLength+len(p.FIR)*firEntryLength)
+	binary.BigEndian.PutUint32(b[4:], p.SenderSSRC)
+	binary.BigEndian.PutUint32(b[8:], p.MediaSSRC)
+	for i, e := range p.FIR {
+		off := 12 + i*firEntryLength
+		binary.BigEndian.PutUint32(b[off:], e.SSRC)
+		b[off+4] = e.SequenceNumber
+	}
+	return b, nil
+}
+
+func (p *FullIntraRequest) Unmarshal(data []byte) error {
+	h, b, err := body(data, TypePayloadFeedback)
+	if err != nil {
+		return err
+	}
+	if h.Count != fmtFIR {
+		return ErrWrongType
+	}
+	if len(b) < 2*ssrcLength {
+		return ErrPacketTooShort
+	}
+	p.SenderSSRC = binary.BigEndian.Uint32(b)
+	p.MediaSSRC = binary.BigEndian.Uint32(b[4:])
+	p.FIR = p.FIR[:0]
+	for b = b[8:]; len(b) >= firEntryLength; b = b[firEntryLength:] {
+		p.FIR = append(p.FIR, FIREntry{SSRC: binary.BigEndian.Uint32(b), SequenceNumber: b[4]})
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package rtcp
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// ReceptionReport is a report block in SR/RR.
+type ReceptionReport struct {
+	SSRC               uint32
+	FractionLost       uint8  // 丢包率, 定点数x/256.
+	TotalLost          uint32 // 24bit累计丢包.
+	LastSequenceNumber uint32 // 扩展最高序号.
+	Jitter             uint32 // rtp时间戳单位.
+	LastSenderReport   uint32 // LSR, 收到的SR里NTP中间32bit.
+	Delay              uint32 // DLSR, 单位1/65536秒.
+}
+
+func (r ReceptionReport) marshal(b []byte) {
+	binary.BigEndian.PutUint32(b[0:], r.SSRC)
+	binary.BigEndian.PutUint32(b[4:], uint32(r.FractionLost)<<24|r.TotalLost&0xffffff)
+	binary.BigEndian.PutUint32(b[8:], r.LastSequenceNumber)
+	binary.BigEndian.PutUint32(b[12:], r.Jitter)
+	binary.BigEndian.PutUint32(b[16:], r.LastSenderReport)
+	binary.BigEndian.PutUint32(b[20:], r.Delay)
+}
+
+func (r *ReceptionReport) unmarshal(b []byte) {
+	r.SSRC = binary.BigEndian.Uint32(b[0:])
+	r.FractionLost = b[4]
+	r.TotalLost = binary.BigEndian.Uint32(b[4:]) & 0xffffff
+	r.LastSequenceNumber = binary.BigEndian.Uint32(b[8:])
+	r.Jitter = binary.BigEndian.Uint32(b[12:])
+	r.LastSenderReport = binary.BigEndian.Uint32(b[16:])
+	r.Delay = binary.BigEndian.Uint32(b[20:])
+}
+
+func unmarshalReports(b []byte, count uint8) ([]ReceptionReport, error) {
+	if len(b) < int(count)*reportBlockLength {
+		return nil, ErrPacketTooShort
+	}
+	reports := make([]ReceptionReport, count)
+	for i := range reports {
+		reports[i].unmarshal(b[i*reportBlockLength:])
+	}
+	return reports, nil
+}
+
+// SenderReport is an RTCP SR.
+type SenderReport struct {
+	SSRC        uint32
+	NTPTime     uint64
+	RTPTime     uint32
+	PacketCount uint32
+	OctetCount  uint32
+	Reports     []ReceptionReport
+}
+
+const senderInfoLength = 20
+
+func (p *SenderReport) Marshal() ([]byte, error) {
+	if len(p.Reports) > maxCount {
+		return nil, ErrTooManyReports
+	}
+	b := newPacket(uint8(len(p.Reports)), TypeSenderReport, headerLength+ssrcLength+senderInfoLength+len(p.Reports)*reportBlockLength)
+	binary.BigEndian.PutUint32(b[4:], p.SSRC)
+	binary.BigEndian.PutUint64(b[8:], p.NTPTime)
+	binary.BigEndian.PutUint32(b[16:], p.RTPTime)
+	binary.BigEndian.PutUint32(b[20:], p.PacketCount)
+	binary.BigEndian.PutUint32(b[24:], p.OctetCount)
+	for i, r := range p.Reports {
+		r.marshal(b[28+i*reportBlockLength:])
+	}
+	return b, nil
+}
+
+func (p *SenderReport) Unmarshal(data []byte) error {
+	h, b, err := body(data, TypeSenderReport)
+	if err != nil {
+		return err
+	}
+	if len(b) < ssrcLength+senderInfoLength {
+		return ErrPacketTooShort
+	}
+	p.SSRC = binary.BigEndian.Uint32(b[0:])
+	p.NTPTime = binary.BigEndian.Uint64(b[4:])
+	p.RTPTime = binary.BigEndian.Uint32(b[12:])
+	p.PacketCount = binary.BigEndian.Uint32(b[16:])
+	p.OctetCount = binary.BigEndian.Uint32(b[20:])
+	p.Reports, err = unmarshalReports(b[24:], h.Count)
+	return err
+}
+
+// ReceiverReport is an RTCP RR.
+type ReceiverReport struct {
+	SSRC    uint32
+	Reports []ReceptionReport
+}
+
+func (p *ReceiverReport) Marshal() ([]byte, error) {
+	if len(p.Reports) > maxCount {
+		return nil, ErrTooManyReports
+	}
+	b := newPacket(uint8(len(p.Reports)), TypeReceiverReport, headerLength+ssrcLength+len(p.Reports)*reportBlockLength)
+	binary.BigEndian.PutUint32(b[4:], p.SSRC)
+	for i, r := range p.Reports {
+		r.marshal(b[8+i*reportBlockLength:])
+	}
+	return b, nil
+}
+
+func (p *ReceiverReport) Unmarshal(data []byte) error {
+	h, b, err := body(data, TypeReceiverReport)
+	if err != nil {
+		return err
+	}
+	if len(b) < ssrcLength {
+		return ErrPacketTooShort
+	}
+	p.SSRC = binary.BigEndian.Uint32(b)
+	p.Reports, err = unmarshalReports(b[ssrcLength:], h.Count)
+	return err
+}
+
+// ntp从1900年开始, unix从1970年开始.
+const ntpEpochOffset = 2208988800
+
+// ToNTP converts time to 64bit NTP timestamp.
+func ToNTP(t time.Time) uint64 {
+	nsec := uint64(t.UnixNano())
+	sec := nsec/1e9 + ntpEpochOffset
+	frac := (nsec % 1e9) << 32 / 1e9
+	return sec<<32 | frac
+}
+
+// FromNTP converts 64bit NTP timestamp to time.
+func FromNTP(ntp uint64) time.Time {
+	sec := int64(ntp>>32) - ntpEpochOffset
+	nsec := int64((ntp & 0xffffffff) * 1e9 >> 32)
+	return time.Unix(sec, nsec)
+}
+
+// MiddleNTP returns the middle 32 bits of NTP timestamp, used by LSR.
+func MiddleNTP(ntp uint64) uint32 {
+	return uint32(ntp >> 16)
+}
+
+// RoundTripTime 根据RR计算rtt, rfc3550 6.4.1: A - LSR - DLSR.
+// 没有收到过SR时LSR为0, 返回false.
+func RoundTripTime(arrival time.Time, r ReceptionReport) (time.Duration, bool) {
+	if r.LastSenderReport == 0 {
+		return 0, false
+	}
+	a := MiddleNTP(ToNTP(arrival))
+	rtt := a - r.LastSenderReport - r.Delay
+	if int32(rtt) < 0 {
+		return 0, false
+	}
+	return time.Duration(uint64(rtt) * uint64(time.Second) >> 16), true
+}
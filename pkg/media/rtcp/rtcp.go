@@ -0,0 +1,180 @@
+// Package rtcp implements the RTCP packets used by rtpua.
+// https://tools.ietf.org/html/rfc3550#section-6
+// https://tools.ietf.org/html/rfc4585#section-6 (PLI)
+// https://tools.ietf.org/html/rfc5104#section-4.3.1 (FIR)
+package rtcp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// PacketType is the RTCP packet type.
+type PacketType uint8
+
+const (
+	TypeSenderReport      PacketType = 200
+	TypeReceiverReport    PacketType = 201
+	TypeSourceDescription PacketType = 202
+	TypeGoodbye           PacketType = 203
+	TypeTransportFeedback PacketType = 205
+	TypePayloadFeedback   PacketType = 206
+	rtpVersion                       = 2
+	headerLength                     = 4
+	ssrcLength                       = 4
+	reportBlockLength                = 24
+	maxCount                         = 0x1f
+	fmtPLI                           = 1
+	fmtFIR                           = 4
+	sdesCNAME                        = 1
+)
+
+var (
+	ErrPacketTooShort = errors.New("rtcp: packet too short")
+	ErrBadVersion     = errors.New("rtcp: invalid version")
+	ErrBadLength      = errors.New("rtcp: invalid length")
+	ErrTooManyReports = errors.New("rtcp: too many reports")
+	ErrWrongType      = errors.New("rtcp: wrong packet type")
+)
+
+// Packet is an RTCP packet in a compound packet.
+type Packet interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// Header is the common header of all RTCP packets.
+type Header struct {
+	Padding bool
+	Count   uint8 // 报告块数目, 反馈包里是FMT.
+	Type    PacketType
+	Length  uint16 // 32bit字长度减一.
+}
+
+func (h Header) marshal(b []byte) {
+	b[0] = rtpVersion<<6 | h.Count&maxCount
+	if h.Padding {
+		b[0] |= 0x20
+	}
+	b[1] = uint8(h.Type)
+	binary.BigEndian.PutUint16(b[2:], h.Length)
+}
+
+func (h *Header) unmarshal(b []byte) error {
+	if len(b) < headerLength {
+		return ErrPacketTooShort
+	}
+	if b[0]>>6 != rtpVersion {
+		return ErrBadVersion
+	}
+	h.Padding = b[0]&0x20 != 0
+	h.Count = b[0] & maxCount
+	h.Type = PacketType(b[1])
+	h.Length = binary.BigEndian.Uint16(b[2:])
+	return nil
+}
+
+// newPacket 按总长度分配并写好头部.
+func newPacket(count uint8, typ PacketType, size int) []byte {
+	b := make([]byte, size)
+	Header{Count: count, Type: typ, Length: uint16(size/4 - 1)}.marshal(b)
+	return b
+}
+
+// body 校验头部并返回去掉头部和padding的内容.
+func body(data []byte, typ PacketType) (Header, []byte, error) {
+	var h Header
+	if err := h.unmarshal(data); err != nil {
+		return h, nil, err
+	}
+	if h.Type != typ {
+		return h, nil, ErrWrongType
+	}
+	size := (int(h.Length) + 1) * 4
+	if size > len(data) {
+		return h, nil, ErrBadLength
+	}
+	data = data[:size]
+	if h.Padding {
+		pad := int(data[size-1])
+		if pad == 0 || pad > size-headerLength {
+			return h, nil, ErrBadLength
+		}
+		data = data[:size-pad]
+	}
+	return h, data[headerLength:], nil
+}
+
+// Marshal serializes packets into a compound packet.
+func Marshal(packets ...Packet) ([]byte, error) {
+	var out []byte
+	for _, p := range packets {
+		b, err := p.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	return out, nil
+}
+
+// Unmarshal parses a compound packet.
+// Unknown packet types are returned as *RawPacket.
+func Unmarshal(data []byte) ([]Packet, error) {
+	var packets []Packet
+	for len(data) > 0 {
+		var h Header
+		if err := h.unmarshal(data); err != nil {
+			return nil, err
+		}
+		size := (int(h.Length) + 1) * 4
+		if size > len(data) {
+			return nil, ErrBadLength
+		}
+
+		var p Packet
+		switch {
+		case h.Type == TypeSenderReport:
+			p = &SenderReport{}
+		case h.Type == TypeReceiverReport:
+			p = &ReceiverReport{}
+		case h.Type == TypeSourceDescription:
+			p = &SourceDescription{}
+		case h.Type == TypeGoodbye:
+			p = &Goodbye{}
+		case h.Type == TypePayloadFeedback && h.Count == fmtPLI:
+			p = &PictureLossIndication{}
+		case h.Type == TypePayloadFeedback && h.Count == fmtFIR:
+			p = &FullIntraRequest{}
+		default:
+			p = &RawPacket{}
+		}
+		if err := p.Unmarshal(data[:size]); err != nil {
+			return nil, err
+		}
+		packets = append(packets, p)
+		data = data[size:]
+	}
+	return packets, nil
+}
+
+// RawPacket is an RTCP packet not parsed by this package.
+type RawPacket []byte
+
+func (r RawPacket) Marshal() ([]byte, error) { return append([]byte(nil), r...), nil }
+
+func (r *RawPacket) Unmarshal(data []byte) error {
+	var h Header
+	if err := h.unmarshal(data); err != nil {
+		return err
+	}
+	*r = append((*r)[:0], data...)
+	return nil
+}
+
+// Header returns the header of the raw packet.
+func (r RawPacket) Header() Header {
+	var h Header
+	_ = h.unmarshal(r)
+	return h
+}
@@ -0,0 +1,153 @@
+package rtcp_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"xmediaEmu/pkg/media/rtcp"
+)
+
+func TestUnmarshalReceiverReport(t *testing.T) {
+	data := []byte{
+		// v=2, p=0, count=1, RR, len=7
+		0x81, 0xc9, 0x00, 0x07,
+		// ssrc=0x902f9e2e
+		0x90, 0x2f, 0x9e, 0x2e,
+		// ssrc=0xbc5e9a40
+		0xbc, 0x5e, 0x9a, 0x40,
+		// fracLost=0x10, totalLost=3
+		0x10, 0x00, 0x00, 0x03,
+		// lastSeq=0x46e1
+		0x00, 0x00, 0x46, 0xe1,
+		// jitter=273
+		0x00, 0x00, 0x01, 0x11,
+		// lsr=0x9f36432
+		0x09, 0xf3, 0x64, 0x32,
+		// delay=150137
+		0x00, 0x02, 0x4a, 0x79,
+	}
+	packets, err := rtcp.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &rtcp.ReceiverReport{
+		SSRC: 0x902f9e2e,
+		Reports: []rtcp.ReceptionReport{{
+			SSRC:               0xbc5e9a40,
+			FractionLost:       0x10,
+			TotalLost:          3,
+			LastSequenceNumber: 0x46e1,
+			Jitter:             273,
+			LastSenderReport:   0x9f36432,
+			Delay:              150137,
+		}},
+	}
+	if len(packets) != 1 || !reflect.DeepEqual(packets[0], want) {
+		t.Fatalf("got %+v, want %+v", packets, want)
+	}
+
+	b, err := want.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("Marshal got %x, want %x", b, data)
+	}
+}
+
+func TestCompound(t *testing.T) {
+	packets := []rtcp.Packet{
+		&rtcp.SenderReport{
+			SSRC:        0x11223344,
+			NTPTime:     0xda8bd1fcdddda05a,
+			RTPTime:     0xaaf4edd5,
+			PacketCount: 1,
+			OctetCount:  2,
+			Reports:     []rtcp.ReceptionReport{{SSRC: 0x55667788, FractionLost: 1, TotalLost: 0xffffff, Jitter: 9}},
+		},
+		&rtcp.SourceDescription{Chunks: []rtcp.SourceDescriptionChunk{{Source: 0x11223344, CNAME: "session-1"}}},
+		&rtcp.PictureLossIndication{SenderSSRC: 1, MediaSSRC: 0x11223344},
+		&rtcp.FullIntraRequest{SenderSSRC: 1, MediaSSRC: 0x11223344, FIR: []rtcp.FIREntry{{SSRC: 0x11223344, SequenceNumber: 7}}},
+		&rtcp.Goodbye{Sources: []uint32{0x11223344}},
+	}
+	data, err := rtcp.Marshal(packets...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data)%4 != 0 {
+		t.Fatalf("compound length %d not aligned", len(data))
+	}
+
+	got, err := rtcp.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, packets) {
+		t.Errorf("got %+v, want %+v", got, packets)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"short", []byte{0x80, 0xc9}, rtcp.ErrPacketTooShort},
+		{"version", []byte{0x00, 0xc9, 0x00, 0x01, 0, 0, 0, 0}, rtcp.ErrBadVersion},
+		{"length", []byte{0x80, 0xc9, 0x00, 0x05, 0, 0, 0, 0}, rtcp.ErrBadLength},
+		{"reports", []byte{0x81, 0xc9, 0x00, 0x01, 0, 0, 0, 0}, rtcp.ErrPacketTooShort},
+	}
+	for _, c := range cases {
+		if _, err := rtcp.Unmarshal(c.data); err != c.err {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.err)
+		}
+	}
+}
+
+func TestUnknownPacket(t *testing.T) {
+	// APP包原样返回.
+	data := []byte{0x80, 0xcc, 0x00, 0x02, 1, 2, 3, 4, 'n', 'a', 'm', 'e'}
+	packets, err := rtcp.Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ok := packets[0].(*rtcp.RawPacket)
+	if !ok || !bytes.Equal(*raw, data) || raw.Header().Type != 204 {
+		t.Errorf("got %+v", packets[0])
+	}
+}
+
+func TestNTP(t *testing.T) {
+	now := time.Date(2022, 5, 1, 10, 20, 30, 500000000, time.UTC)
+	ntp := rtcp.ToNTP(now)
+	if ntp>>32 != 3860389230 || ntp&0xffffffff != 1<<31 {
+		t.Errorf("ToNTP got %x", ntp)
+	}
+	if back := rtcp.FromNTP(ntp); !back.Equal(now) {
+		t.Errorf("FromNTP got %v, want %v", back, now)
+	}
+}
+
+func TestRoundTripTime(t *testing.T) {
+	sent := time.Date(2022, 5, 1, 10, 20, 30, 0, time.UTC)
+	arrival := sent.Add(300 * time.Millisecond)
+	// 对端收到SR后等了100ms才发RR.
+	report := rtcp.ReceptionReport{
+		LastSenderReport: rtcp.MiddleNTP(rtcp.ToNTP(sent)),
+		Delay:            65536 / 10,
+	}
+	rtt, ok := rtcp.RoundTripTime(arrival, report)
+	if !ok {
+		t.Fatal("RoundTripTime not ok")
+	}
+	if d := rtt - 200*time.Millisecond; d < -time.Millisecond || d > time.Millisecond {
+		t.Errorf("RoundTripTime got %v, want 200ms", rtt)
+	}
+
+	if _, ok := rtcp.RoundTripTime(arrival, rtcp.ReceptionReport{}); ok {
+		t.Error("RoundTripTime without LSR should not be ok")
+	}
+}
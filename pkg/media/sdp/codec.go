@@ -0,0 +1,170 @@
+package sdp
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+const (
+	CodecH264           = "H264"
+	CodecPCMU           = "PCMU"
+	CodecPCMA           = "PCMA"
+	CodecAMR            = "AMR"
+	CodecAMRWB          = "AMR-WB"
+	CodecL16            = "L16"
+	CodecTelephoneEvent = "telephone-event"
+)
+
+// Codec is a payload format of m= section, from rtpmap and fmtp.
+type Codec struct {
+	PayloadType uint8
+	Name        string
+	ClockRate   int
+	Channels    int // 0表示默认单声道.
+	Fmtp        string
+}
+
+// rfc3551 静态负载, 对端可以不带rtpmap.
+var staticCodecs = map[uint8]Codec{
+	0: {Name: CodecPCMU, ClockRate: 8000},
+	8: {Name: CodecPCMA, ClockRate: 8000},
+}
+
+func (c Codec) rtpmap() string {
+	if c.Channels > 1 {
+		return c.Name + "/" + strconv.Itoa(c.ClockRate) + "/" + strconv.Itoa(c.Channels)
+	}
+	return c.Name + "/" + strconv.Itoa(c.ClockRate)
+}
+
+// Params parses fmtp "k1=v1;k2=v2", keys are lower case.
+func (c Codec) Params() map[string]string {
+	params := map[string]string{}
+	for _, kv := range strings.Split(c.Fmtp, ";") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		if len(parts) == 2 {
+			params[key] = strings.TrimSpace(parts[1])
+		} else {
+			params[key] = ""
+		}
+	}
+	return params
+}
+
+func (c Codec) param(key, def string) string {
+	if v, ok := c.Params()[key]; ok {
+		return v
+	}
+	return def
+}
+
+func (c Codec) IsTelephoneEvent() bool {
+	return strings.EqualFold(c.Name, CodecTelephoneEvent)
+}
+
+// Matches 是否同一编码, 名字、时钟、声道相同, H264/AMR还要比较fmtp.
+func (c Codec) Matches(other Codec) bool {
+	if !strings.EqualFold(c.Name, other.Name) || c.ClockRate != other.ClockRate || channels(c) != channels(other) {
+		return false
+	}
+	switch strings.ToUpper(c.Name) {
+	case CodecH264:
+		// rfc6184 8.2.2, packetization-mode必须一致, profile兼容, level可以不同.
+		return c.param("packetization-mode", "0") == other.param("packetization-mode", "0") &&
+			h264ProfileMatch(c.param("profile-level-id", defaultProfileLevelID), other.param("profile-level-id", defaultProfileLevelID))
+	case CodecAMR, CodecAMRWB:
+		// rfc4867 8.3, octet-align必须一致.
+		return c.param("octet-align", "0") == other.param("octet-align", "0")
+	}
+	return true
+}
+
+func channels(c Codec) int {
+	if c.Channels <= 0 {
+		return 1
+	}
+	return c.Channels
+}
+
+// 没有profile-level-id时默认baseline level 1.0, rfc6184 8.1.
+const defaultProfileLevelID = "42000a"
+
+// h264ProfileMatch profile相同或都是(constrained) baseline.
+func h264ProfileMatch(a, b string) bool {
+	pa, oka := parseProfileLevelID(a)
+	pb, okb := parseProfileLevelID(b)
+	if !oka || !okb {
+		return false
+	}
+	if isBaseline(pa) && isBaseline(pb) {
+		return true
+	}
+	return pa[0] == pb[0] && pa[1]&0xfc == pb[1]&0xfc
+}
+
+func parseProfileLevelID(s string) ([]byte, bool) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 3 {
+		return nil, false
+	}
+	return b, true
+}
+
+// baseline或者兼容constrained baseline的main/extended.
+func isBaseline(p []byte) bool {
+	idc, iop := p[0], p[1]
+	return idc == 0x42 || (idc == 0x4d && iop&0x80 != 0) || (idc == 0x58 && iop&0xc0 == 0xc0)
+}
+
+// Negotiate 按对端顺序选出第一个本端支持的编码, 另外带上双方都支持的telephone-event.
+// 返回的编码用对端的负载类型, fmtp用本端的, H264沿用对端的profile-level-id.
+func Negotiate(offered, local []Codec) []Codec {
+	var answer []Codec
+	var media, event bool
+	for _, o := range offered {
+		for _, l := range local {
+			if !l.Matches(o) {
+				continue
+			}
+			if o.IsTelephoneEvent() {
+				if event {
+					break
+				}
+				event = true
+			} else {
+				if media {
+					break
+				}
+				media = true
+			}
+			answer = append(answer, answerCodec(o, l))
+			break
+		}
+	}
+	if !media {
+		return nil
+	}
+	return answer
+}
+
+func answerCodec(offered, local Codec) Codec {
+	c := local
+	c.PayloadType = offered.PayloadType
+	if strings.EqualFold(c.Name, CodecH264) {
+		params := offered.Params()
+		fmtp := "packetization-mode=" + local.param("packetization-mode", "0")
+		if id, ok := params["profile-level-id"]; ok {
+			fmtp = "profile-level-id=" + id + ";" + fmtp
+		} else if id, ok := local.Params()["profile-level-id"]; ok {
+			fmtp = "profile-level-id=" + id + ";" + fmtp
+		}
+		c.Fmtp = fmtp
+	}
+	return c
+}
@@ -0,0 +1,424 @@
+// Package sdp implements the subset of SDP used by rtpua offer/answer.
+// https://tools.ietf.org/html/rfc4566
+// https://tools.ietf.org/html/rfc3264
+package sdp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNoVersion = errors.New("sdp: missing version line")
+	ErrBadLine   = errors.New("sdp: invalid line")
+	ErrBadMedia  = errors.New("sdp: invalid media line")
+	ErrBadRtpmap = errors.New("sdp: invalid rtpmap")
+	ErrNoAddress = errors.New("sdp: missing connection address")
+	ErrNoCodecs  = errors.New("sdp: no common codec")
+)
+
+const (
+	MediaAudio = "audio"
+	MediaVideo = "video"
+
+	ProtoRtpAvp  = "RTP/AVP"
+	ProtoRtpSavp = "RTP/SAVP"
+)
+
+// Direction is the media direction attribute, rfc3264 6.1.
+type Direction string
+
+const (
+	SendRecv Direction = "sendrecv"
+	SendOnly Direction = "sendonly"
+	RecvOnly Direction = "recvonly"
+	Inactive Direction = "inactive"
+)
+
+// Reverse 对端方向在本端看来的方向.
+func (d Direction) Reverse() Direction {
+	switch d {
+	case SendOnly:
+		return RecvOnly
+	case RecvOnly:
+		return SendOnly
+	case Inactive:
+		return Inactive
+	default:
+		return SendRecv
+	}
+}
+
+func (d Direction) CanSend() bool { return d == SendRecv || d == SendOnly || d == "" }
+func (d Direction) CanRecv() bool { return d == SendRecv || d == RecvOnly || d == "" }
+
+// Intersect 双方方向的交集, 例如本端只发送, 对端sendrecv时为sendonly.
+func (d Direction) Intersect(other Direction) Direction {
+	send := d.CanSend() && other.CanSend()
+	recv := d.CanRecv() && other.CanRecv()
+	switch {
+	case send && recv:
+		return SendRecv
+	case send:
+		return SendOnly
+	case recv:
+		return RecvOnly
+	default:
+		return Inactive
+	}
+}
+
+// Origin is the o= line.
+type Origin struct {
+	Username       string
+	SessionID      uint64
+	SessionVersion uint64
+	Address        string
+}
+
+// Attribute is an a= line not parsed into other fields.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// SessionDescription is a parsed SDP.
+type SessionDescription struct {
+	Origin      Origin
+	SessionName string
+	Address     string // 会话级c=.
+	Direction   Direction
+	Attributes  []Attribute
+	Media       []*MediaDescription
+}
+
+// MediaDescription is an m= section.
+type MediaDescription struct {
+	Type       string
+	Port       int
+	Proto      string
+	Address    string // 媒体级c=, 为空时用会话级.
+	Direction  Direction
+	Formats    []string // m=行原始格式.
+	Codecs     []Codec  // rtp负载, 按m=行格式顺序.
+	Ptime      int
+	Attributes []Attribute
+}
+
+// MediaOf returns the first m= section of the type.
+func (s *SessionDescription) MediaOf(typ string) *MediaDescription {
+	for _, m := range s.Media {
+		if m.Type == typ {
+			return m
+		}
+	}
+	return nil
+}
+
+// RemoteAddr returns "ip:port" the media should be sent to.
+func (s *SessionDescription) RemoteAddr(m *MediaDescription) (string, error) {
+	addr := m.Address
+	if addr == "" {
+		addr = s.Address
+	}
+	if addr == "" {
+		return "", ErrNoAddress
+	}
+	return fmt.Sprintf("%s:%d", addr, m.Port), nil
+}
+
+// MediaDirection 媒体级方向, 没有时用会话级, 默认sendrecv.
+func (s *SessionDescription) MediaDirection(m *MediaDescription) Direction {
+	if m.Direction != "" {
+		return m.Direction
+	}
+	if s.Direction != "" {
+		return s.Direction
+	}
+	return SendRecv
+}
+
+// Attribute returns the value of the first attribute with the key.
+func (m *MediaDescription) Attribute(key string) (string, bool) {
+	for _, a := range m.Attributes {
+		if a.Key == key {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// Codec returns the codec of the payload type.
+func (m *MediaDescription) Codec(payloadType uint8) (Codec, bool) {
+	for _, c := range m.Codecs {
+		if c.PayloadType == payloadType {
+			return c, true
+		}
+	}
+	return Codec{}, false
+}
+
+// Parse parses a SDP text, both CRLF and LF line endings are accepted.
+func Parse(text string) (*SessionDescription, error) {
+	s := &SessionDescription{}
+	var media *MediaDescription
+	hasVersion := false
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		if len(line) < 2 || line[1] != '=' {
+			return nil, ErrBadLine
+		}
+		value := line[2:]
+
+		switch line[0] {
+		case 'v':
+			if value != "0" {
+				return nil, ErrBadLine
+			}
+			hasVersion = true
+		case 'o':
+			fields := strings.Fields(value)
+			if len(fields) != 6 {
+				return nil, ErrBadLine
+			}
+			s.Origin.Username = fields[0]
+			s.Origin.SessionID, _ = strconv.ParseUint(fields[1], 10, 64)
+			s.Origin.SessionVersion, _ = strconv.ParseUint(fields[2], 10, 64)
+			s.Origin.Address = fields[5]
+		case 's':
+			s.SessionName = value
+		case 'c':
+			fields := strings.Fields(value)
+			if len(fields) != 3 {
+				return nil, ErrBadLine
+			}
+			// 组播地址可能带/ttl.
+			addr := strings.SplitN(fields[2], "/", 2)[0]
+			if media != nil {
+				media.Address = addr
+			} else {
+				s.Address = addr
+			}
+		case 'm':
+			m, err := parseMedia(value)
+			if err != nil {
+				return nil, err
+			}
+			media = m
+			s.Media = append(s.Media, m)
+		case 'a':
+			if err := s.parseAttribute(media, value); err != nil {
+				return nil, err
+			}
+		default:
+			// b= t= k= 等忽略.
+		}
+	}
+	if !hasVersion {
+		return nil, ErrNoVersion
+	}
+	return s, nil
+}
+
+func parseMedia(value string) (*MediaDescription, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 4 {
+		return nil, ErrBadMedia
+	}
+	port, err := strconv.Atoi(strings.SplitN(fields[1], "/", 2)[0])
+	if err != nil {
+		return nil, ErrBadMedia
+	}
+	m := &MediaDescription{Type: fields[0], Port: port, Proto: fields[2], Formats: fields[3:]}
+	if !strings.HasPrefix(m.Proto, "RTP/") {
+		return m, nil // 非rtp媒体, 如BFCP.
+	}
+	for _, f := range m.Formats {
+		pt, err := strconv.ParseUint(f, 10, 8)
+		if err != nil {
+			return nil, ErrBadMedia
+		}
+		// 静态负载没有rtpmap时用默认值.
+		c := staticCodecs[uint8(pt)]
+		c.PayloadType = uint8(pt)
+		m.Codecs = append(m.Codecs, c)
+	}
+	return m, nil
+}
+
+func (s *SessionDescription) parseAttribute(m *MediaDescription, value string) error {
+	key, val := value, ""
+	if i := strings.IndexByte(value, ':'); i >= 0 {
+		key, val = value[:i], value[i+1:]
+	}
+
+	switch Direction(key) {
+	case SendRecv, SendOnly, RecvOnly, Inactive:
+		if m != nil {
+			m.Direction = Direction(key)
+		} else {
+			s.Direction = Direction(key)
+		}
+		return nil
+	}
+	if m == nil {
+		s.Attributes = append(s.Attributes, Attribute{Key: key, Value: val})
+		return nil
+	}
+
+	switch key {
+	case "rtpmap":
+		pt, rest, err := splitPayloadType(val)
+		if err != nil {
+			return ErrBadRtpmap
+		}
+		c, err := parseRtpmap(rest)
+		if err != nil {
+			return err
+		}
+		for i := range m.Codecs {
+			if m.Codecs[i].PayloadType == pt {
+				c.PayloadType, c.Fmtp = pt, m.Codecs[i].Fmtp
+				m.Codecs[i] = c
+			}
+		}
+	case "fmtp":
+		pt, rest, err := splitPayloadType(val)
+		if err != nil {
+			return ErrBadLine
+		}
+		for i := range m.Codecs {
+			if m.Codecs[i].PayloadType == pt {
+				m.Codecs[i].Fmtp = rest
+			}
+		}
+	case "ptime":
+		m.Ptime, _ = strconv.Atoi(val)
+	default:
+		m.Attributes = append(m.Attributes, Attribute{Key: key, Value: val})
+	}
+	return nil
+}
+
+func splitPayloadType(val string) (uint8, string, error) {
+	fields := strings.SplitN(val, " ", 2)
+	pt, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return 0, "", err
+	}
+	rest := ""
+	if len(fields) > 1 {
+		rest = strings.TrimSpace(fields[1])
+	}
+	return uint8(pt), rest, nil
+}
+
+// parseRtpmap 解析 "name/clock[/channels]".
+func parseRtpmap(val string) (Codec, error) {
+	parts := strings.Split(val, "/")
+	if len(parts) < 2 {
+		return Codec{}, ErrBadRtpmap
+	}
+	clock, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Codec{}, ErrBadRtpmap
+	}
+	c := Codec{Name: parts[0], ClockRate: clock}
+	if len(parts) > 2 {
+		if c.Channels, err = strconv.Atoi(parts[2]); err != nil {
+			return Codec{}, ErrBadRtpmap
+		}
+	}
+	return c, nil
+}
+
+// Marshal generates the SDP text with CRLF line endings.
+func (s *SessionDescription) Marshal() string {
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(&b, format, args...)
+		b.WriteString("\r\n")
+	}
+
+	username := s.Origin.Username
+	if username == "" {
+		username = "-"
+	}
+	name := s.SessionName
+	if name == "" {
+		name = "-"
+	}
+	line("v=0")
+	line("o=%s %d %d IN %s %s", username, s.Origin.SessionID, s.Origin.SessionVersion, addrType(s.Origin.Address), s.Origin.Address)
+	line("s=%s", name)
+	if s.Address != "" {
+		line("c=IN %s %s", addrType(s.Address), s.Address)
+	}
+	line("t=0 0")
+	if s.Direction != "" {
+		line("a=%s", s.Direction)
+	}
+	for _, a := range s.Attributes {
+		line("%s", a)
+	}
+
+	for _, m := range s.Media {
+		proto := m.Proto
+		if proto == "" {
+			proto = ProtoRtpAvp
+		}
+		formats := m.Formats
+		if len(m.Codecs) > 0 {
+			formats = make([]string, 0, len(m.Codecs))
+			for _, c := range m.Codecs {
+				formats = append(formats, strconv.Itoa(int(c.PayloadType)))
+			}
+		}
+		if len(formats) == 0 {
+			// 拒绝的媒体也要带一个格式.
+			formats = append(formats, "0")
+		}
+		line("m=%s %d %s %s", m.Type, m.Port, proto, strings.Join(formats, " "))
+		if m.Address != "" {
+			line("c=IN %s %s", addrType(m.Address), m.Address)
+		}
+		for _, c := range m.Codecs {
+			if c.Name != "" {
+				line("a=rtpmap:%d %s", c.PayloadType, c.rtpmap())
+			}
+			if c.Fmtp != "" {
+				line("a=fmtp:%d %s", c.PayloadType, c.Fmtp)
+			}
+		}
+		if m.Ptime > 0 {
+			line("a=ptime:%d", m.Ptime)
+		}
+		for _, a := range m.Attributes {
+			line("%s", a)
+		}
+		if m.Direction != "" {
+			line("a=%s", m.Direction)
+		}
+	}
+	return b.String()
+}
+
+func (a Attribute) String() string {
+	if a.Value == "" {
+		return "a=" + a.Key
+	}
+	return "a=" + a.Key + ":" + a.Value
+}
+
+func addrType(addr string) string {
+	if strings.Contains(addr, ":") {
+		return "IP6"
+	}
+	return "IP4"
+}
@@ -0,0 +1,196 @@
+package sdp_test
+
+import (
+	"reflect"
+	"testing"
+
+	"xmediaEmu/pkg/media/sdp"
+)
+
+const imsOffer = "v=0\r\n" +
+	"o=- 1234 1 IN IP4 10.0.0.1\r\n" +
+	"s=-\r\n" +
+	"c=IN IP4 10.0.0.1\r\n" +
+	"t=0 0\r\n" +
+	"m=audio 40000 RTP/AVP 104 0 8 101\r\n" +
+	"a=rtpmap:104 AMR-WB/16000\r\n" +
+	"a=fmtp:104 octet-align=1\r\n" +
+	"a=rtpmap:101 telephone-event/8000\r\n" +
+	"a=fmtp:101 0-15\r\n" +
+	"a=ptime:20\r\n" +
+	"a=sendrecv\r\n" +
+	"m=video 40002 RTP/AVP 98 99\r\n" +
+	"c=IN IP4 10.0.0.2\r\n" +
+	"a=rtpmap:98 H264/90000\r\n" +
+	"a=fmtp:98 profile-level-id=42e01f;packetization-mode=0\r\n" +
+	"a=rtpmap:99 H264/90000\r\n" +
+	"a=fmtp:99 profile-level-id=42e01f;packetization-mode=1\r\n" +
+	"a=rtcp-fb:99 nack pli\r\n" +
+	"a=recvonly\r\n" +
+	"m=application 0 UDP/BFCP *\r\n"
+
+func TestParse(t *testing.T) {
+	s, err := sdp.Parse(imsOffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Origin.SessionID != 1234 || s.Address != "10.0.0.1" || len(s.Media) != 3 {
+		t.Fatalf("got %+v", s)
+	}
+
+	audio := s.MediaOf(sdp.MediaAudio)
+	wantAudio := []sdp.Codec{
+		{PayloadType: 104, Name: "AMR-WB", ClockRate: 16000, Fmtp: "octet-align=1"},
+		{PayloadType: 0, Name: "PCMU", ClockRate: 8000},
+		{PayloadType: 8, Name: "PCMA", ClockRate: 8000},
+		{PayloadType: 101, Name: "telephone-event", ClockRate: 8000, Fmtp: "0-15"},
+	}
+	if !reflect.DeepEqual(audio.Codecs, wantAudio) {
+		t.Errorf("audio codecs got %+v", audio.Codecs)
+	}
+	if audio.Ptime != 20 || s.MediaDirection(audio) != sdp.SendRecv {
+		t.Errorf("audio got ptime %d direction %s", audio.Ptime, audio.Direction)
+	}
+	if addr, err := s.RemoteAddr(audio); err != nil || addr != "10.0.0.1:40000" {
+		t.Errorf("audio addr got %s %v", addr, err)
+	}
+
+	video := s.MediaOf(sdp.MediaVideo)
+	if addr, _ := s.RemoteAddr(video); addr != "10.0.0.2:40002" {
+		t.Errorf("video addr got %s", addr)
+	}
+	if s.MediaDirection(video) != sdp.RecvOnly {
+		t.Errorf("video direction got %s", video.Direction)
+	}
+	if v, ok := video.Attribute("rtcp-fb"); !ok || v != "99 nack pli" {
+		t.Errorf("rtcp-fb got %q", v)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	s := &sdp.SessionDescription{
+		Origin:  sdp.Origin{SessionID: 1, SessionVersion: 2, Address: "10.0.0.3"},
+		Address: "10.0.0.3",
+		Media: []*sdp.MediaDescription{{
+			Type:      sdp.MediaVideo,
+			Port:      10000,
+			Proto:     sdp.ProtoRtpAvp,
+			Codecs:    []sdp.Codec{{PayloadType: 99, Name: "H264", ClockRate: 90000, Fmtp: "packetization-mode=1"}},
+			Direction: sdp.SendOnly,
+		}},
+	}
+	want := "v=0\r\n" +
+		"o=- 1 2 IN IP4 10.0.0.3\r\n" +
+		"s=-\r\n" +
+		"c=IN IP4 10.0.0.3\r\n" +
+		"t=0 0\r\n" +
+		"m=video 10000 RTP/AVP 99\r\n" +
+		"a=rtpmap:99 H264/90000\r\n" +
+		"a=fmtp:99 packetization-mode=1\r\n" +
+		"a=sendonly\r\n"
+	if got := s.Marshal(); got != want {
+		t.Errorf("Marshal got %q, want %q", got, want)
+	}
+
+	back, err := sdp.Parse(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back.Origin.Username, back.SessionName = "", ""
+	if back.Marshal() != want {
+		t.Errorf("roundtrip got %q", back.Marshal())
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	cases := []struct {
+		name string
+		text string
+		err  error
+	}{
+		{"version", "s=-\r\n", sdp.ErrNoVersion},
+		{"line", "v=0\r\nbad\r\n", sdp.ErrBadLine},
+		{"media", "v=0\r\nm=audio x RTP/AVP 0\r\n", sdp.ErrBadMedia},
+		{"rtpmap", "v=0\r\nm=audio 1 RTP/AVP 96\r\na=rtpmap:96 AMR\r\n", sdp.ErrBadRtpmap},
+	}
+	for _, c := range cases {
+		if _, err := sdp.Parse(c.text); err != c.err {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.err)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	s, err := sdp.Parse(imsOffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := sdp.Codec{PayloadType: 100, Name: "telephone-event", ClockRate: 8000, Fmtp: "0-15"}
+
+	cases := []struct {
+		name  string
+		media string
+		local []sdp.Codec
+		want  []sdp.Codec
+	}{
+		{
+			"h264 packetization-mode",
+			sdp.MediaVideo,
+			[]sdp.Codec{{PayloadType: 102, Name: "H264", ClockRate: 90000, Fmtp: "profile-level-id=42001f;packetization-mode=1"}},
+			[]sdp.Codec{{PayloadType: 99, Name: "H264", ClockRate: 90000, Fmtp: "profile-level-id=42e01f;packetization-mode=1"}},
+		},
+		{
+			"pcma with telephone-event",
+			sdp.MediaAudio,
+			[]sdp.Codec{{PayloadType: 8, Name: "PCMA", ClockRate: 8000}, event},
+			[]sdp.Codec{{PayloadType: 8, Name: "PCMA", ClockRate: 8000}, {PayloadType: 101, Name: "telephone-event", ClockRate: 8000, Fmtp: "0-15"}},
+		},
+		{
+			"amr-wb octet-align",
+			sdp.MediaAudio,
+			[]sdp.Codec{{PayloadType: 97, Name: "AMR-WB", ClockRate: 16000, Fmtp: "octet-align=1"}},
+			[]sdp.Codec{{PayloadType: 104, Name: "AMR-WB", ClockRate: 16000, Fmtp: "octet-align=1"}},
+		},
+		{
+			"amr-wb bandwidth-efficient",
+			sdp.MediaAudio,
+			[]sdp.Codec{{PayloadType: 97, Name: "AMR-WB", ClockRate: 16000}},
+			nil,
+		},
+		{
+			"only telephone-event",
+			sdp.MediaAudio,
+			[]sdp.Codec{{PayloadType: 97, Name: "AMR", ClockRate: 8000}, event},
+			nil,
+		},
+		{
+			"h264 high profile",
+			sdp.MediaVideo,
+			[]sdp.Codec{{PayloadType: 102, Name: "H264", ClockRate: 90000, Fmtp: "profile-level-id=640028;packetization-mode=1"}},
+			nil,
+		},
+	}
+	for _, c := range cases {
+		got := sdp.Negotiate(s.MediaOf(c.media).Codecs, c.local)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestDirection(t *testing.T) {
+	cases := []struct {
+		local, offer, want sdp.Direction
+	}{
+		{sdp.SendOnly, sdp.SendRecv, sdp.SendOnly},
+		{sdp.SendOnly, sdp.SendOnly, sdp.Inactive},
+		{sdp.SendRecv, sdp.SendOnly, sdp.RecvOnly},
+		{sdp.SendRecv, sdp.RecvOnly, sdp.SendOnly},
+		{sdp.SendRecv, sdp.Inactive, sdp.Inactive},
+	}
+	for _, c := range cases {
+		if got := c.local.Intersect(c.offer.Reverse()); got != c.want {
+			t.Errorf("%s/%s: got %s, want %s", c.local, c.offer, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package srtp
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrBadCrypto = errors.New("srtp: invalid crypto attribute")
+
+// Crypto is a SDES a=crypto attribute, rfc4568.
+// 只支持一个inline key, 忽略lifetime和MKI.
+type Crypto struct {
+	Tag   int
+	Suite string
+	Key   []byte
+	Salt  []byte
+}
+
+// ParseCrypto parses the value of a=crypto, e.g.
+// "1 AES_CM_128_HMAC_SHA1_80 inline:WVNfX19zZW1jdGwgKCkgewkyMjA7fQp9CnVubGVz|2^20|1:4".
+func ParseCrypto(value string) (Crypto, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "inline:") {
+		return Crypto{}, ErrBadCrypto
+	}
+	tag, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return Crypto{}, ErrBadCrypto
+	}
+	c := Crypto{Tag: tag, Suite: fields[1]}
+
+	inline := strings.SplitN(strings.TrimPrefix(fields[2], "inline:"), "|", 2)[0]
+	keySalt, err := base64.StdEncoding.DecodeString(inline)
+	if err != nil {
+		// 有些实现不带padding.
+		if keySalt, err = base64.RawStdEncoding.DecodeString(inline); err != nil {
+			return Crypto{}, ErrBadCrypto
+		}
+	}
+	if c.Suite == ProfileAesCm128HmacSha1_80 && len(keySalt) != KeyLen+SaltLen {
+		return Crypto{}, ErrBadKey
+	}
+	if len(keySalt) >= KeyLen {
+		c.Key, c.Salt = keySalt[:KeyLen], keySalt[KeyLen:]
+	}
+	return c, nil
+}
+
+// NewCrypto generates a random AES_CM_128_HMAC_SHA1_80 key.
+func NewCrypto(tag int) (Crypto, error) {
+	keySalt := make([]byte, KeyLen+SaltLen)
+	if _, err := rand.Read(keySalt); err != nil {
+		return Crypto{}, err
+	}
+	return Crypto{Tag: tag, Suite: ProfileAesCm128HmacSha1_80, Key: keySalt[:KeyLen], Salt: keySalt[KeyLen:]}, nil
+}
+
+// Supported 是否支持的加密套件.
+func (c Crypto) Supported() bool {
+	return c.Suite == ProfileAesCm128HmacSha1_80 && len(c.Key) == KeyLen && len(c.Salt) == SaltLen
+}
+
+// Context creates the SRTP context of the key.
+func (c Crypto) Context() (*Context, error) {
+	return CreateContext(c.Key, c.Salt)
+}
+
+// String returns the value of a=crypto.
+func (c Crypto) String() string {
+	keySalt := append(append([]byte{}, c.Key...), c.Salt...)
+	return fmt.Sprintf("%d %s inline:%s", c.Tag, c.Suite, base64.StdEncoding.EncodeToString(keySalt))
+}
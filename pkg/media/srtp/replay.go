@@ -0,0 +1,43 @@
+package srtp
+
+// 重放窗口大小, rfc3711建议至少64.
+const replayWindowSize = 64
+
+// replayWindow 滑动窗口, bit i表示max-i已经收到.
+type replayWindow struct {
+	started bool
+	max     uint64
+	mask    uint64
+}
+
+// check 是否可以接收, 太旧或者已经收到过的拒绝.
+func (w *replayWindow) check(index uint64) bool {
+	if !w.started || index > w.max {
+		return true
+	}
+	diff := w.max - index
+	if diff >= replayWindowSize {
+		return false
+	}
+	return w.mask&(1<<diff) == 0
+}
+
+// accept 认证通过后更新窗口.
+func (w *replayWindow) accept(index uint64) {
+	if !w.started {
+		w.started, w.max, w.mask = true, index, 1
+		return
+	}
+	if index > w.max {
+		shift := index - w.max
+		if shift >= replayWindowSize {
+			w.mask = 0
+		} else {
+			w.mask <<= shift
+		}
+		w.mask |= 1
+		w.max = index
+		return
+	}
+	w.mask |= 1 << (w.max - index)
+}
@@ -0,0 +1,332 @@
+// Package srtp implements SRTP/SRTCP with AES_CM_128_HMAC_SHA1_80.
+// https://tools.ietf.org/html/rfc3711
+package srtp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"sync"
+)
+
+const (
+	ProfileAesCm128HmacSha1_80 = "AES_CM_128_HMAC_SHA1_80"
+
+	KeyLen  = 16
+	SaltLen = 14
+
+	authKeyLen = 20
+	authTagLen = 10
+
+	rtpHeaderLen   = 12
+	rtcpHeaderLen  = 8
+	srtcpIndexLen  = 4
+	srtcpEncrypted = 1 << 31
+	maxSrtcpIndex  = 1<<31 - 1
+)
+
+// rfc3711 4.3.1 密钥派生的label.
+const (
+	labelRTPEncryption  = 0x00
+	labelRTPAuth        = 0x01
+	labelRTPSalt        = 0x02
+	labelRTCPEncryption = 0x03
+	labelRTCPAuth       = 0x04
+	labelRTCPSalt       = 0x05
+)
+
+var (
+	ErrBadKey      = errors.New("srtp: invalid master key or salt length")
+	ErrTooShort    = errors.New("srtp: packet too short")
+	ErrAuthFailed  = errors.New("srtp: authentication failed")
+	ErrReplayed    = errors.New("srtp: replayed packet")
+	ErrIndexExceed = errors.New("srtp: srtcp index exhausted")
+)
+
+// Context is one direction of a SRTP session, created from the master key/salt.
+// 发送和接收各用一个, 同一个Context可以有多个ssrc.
+type Context struct {
+	mu sync.Mutex
+
+	rtpBlock  cipher.Block
+	rtpSalt   []byte
+	rtpAuth   hash.Hash
+	rtcpBlock cipher.Block
+	rtcpSalt  []byte
+	rtcpAuth  hash.Hash
+
+	rtpStates  map[uint32]*rtpState
+	rtcpStates map[uint32]*rtcpState
+}
+
+type rtpState struct {
+	started bool
+	roc     uint32
+	seq     uint16
+	replay  replayWindow
+}
+
+type rtcpState struct {
+	index  uint32 // 发送方向的srtcp index.
+	replay replayWindow
+}
+
+// CreateContext derives the session keys, rfc3711 4.3 with kdr 0.
+func CreateContext(masterKey, masterSalt []byte) (*Context, error) {
+	if len(masterKey) != KeyLen || len(masterSalt) != SaltLen {
+		return nil, ErrBadKey
+	}
+	c := &Context{rtpStates: map[uint32]*rtpState{}, rtcpStates: map[uint32]*rtcpState{}}
+
+	var err error
+	if c.rtpBlock, c.rtpSalt, c.rtpAuth, err = sessionKeys(masterKey, masterSalt, labelRTPEncryption, labelRTPAuth, labelRTPSalt); err != nil {
+		return nil, err
+	}
+	if c.rtcpBlock, c.rtcpSalt, c.rtcpAuth, err = sessionKeys(masterKey, masterSalt, labelRTCPEncryption, labelRTCPAuth, labelRTCPSalt); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func sessionKeys(masterKey, masterSalt []byte, encLabel, authLabel, saltLabel byte) (cipher.Block, []byte, hash.Hash, error) {
+	encKey, err := deriveKey(masterKey, masterSalt, encLabel, KeyLen)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	authKey, err := deriveKey(masterKey, masterSalt, authLabel, authKeyLen)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	salt, err := deriveKey(masterKey, masterSalt, saltLabel, SaltLen)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return block, salt, hmac.New(sha1.New, authKey), nil
+}
+
+// deriveKey AES-CM作为PRF, x = label<<48 XOR master_salt, 输出前n字节.
+func deriveKey(masterKey, masterSalt []byte, label byte, n int) ([]byte, error) {
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, masterSalt)
+	iv[7] ^= label
+
+	out := make([]byte, n)
+	cipher.NewCTR(block, iv).XORKeyStream(out, out)
+	return out, nil
+}
+
+// counter rfc3711 4.1.1, IV = salt<<16 XOR ssrc<<64 XOR index<<16.
+func counter(salt []byte, ssrc uint32, index uint64) []byte {
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, salt)
+	for i := 0; i < 4; i++ {
+		iv[4+i] ^= byte(ssrc >> (24 - 8*i))
+	}
+	for i := 0; i < 6; i++ {
+		iv[8+i] ^= byte(index >> (40 - 8*i))
+	}
+	return iv
+}
+
+// rtpHeaderSize 包括csrc和扩展头.
+func rtpHeaderSize(packet []byte) (int, error) {
+	if len(packet) < rtpHeaderLen {
+		return 0, ErrTooShort
+	}
+	n := rtpHeaderLen + int(packet[0]&0x0f)*4
+	if packet[0]&0x10 != 0 {
+		if len(packet) < n+4 {
+			return 0, ErrTooShort
+		}
+		n += 4 + int(binary.BigEndian.Uint16(packet[n+2:]))*4
+	}
+	if len(packet) < n {
+		return 0, ErrTooShort
+	}
+	return n, nil
+}
+
+func (c *Context) rtpState(ssrc uint32) *rtpState {
+	s, ok := c.rtpStates[ssrc]
+	if !ok {
+		s = &rtpState{}
+		c.rtpStates[ssrc] = s
+	}
+	return s
+}
+
+// estimateRoc rfc3711 3.3.1, 附录A.
+func (s *rtpState) estimateRoc(seq uint16) uint32 {
+	if !s.started {
+		return 0
+	}
+	if s.seq < 0x8000 {
+		if int(seq)-int(s.seq) > 0x8000 && s.roc > 0 {
+			return s.roc - 1
+		}
+	} else if int(s.seq)-0x8000 > int(seq) {
+		return s.roc + 1
+	}
+	return s.roc
+}
+
+func (s *rtpState) update(roc uint32, seq uint16) {
+	index := uint64(roc)<<16 | uint64(seq)
+	if !s.started || index > uint64(s.roc)<<16|uint64(s.seq) {
+		s.roc, s.seq, s.started = roc, seq, true
+	}
+}
+
+// authTag HMAC-SHA1截取前80bit, rtp时带上roc.
+func authTag(auth hash.Hash, data []byte, roc []byte) []byte {
+	auth.Reset()
+	auth.Write(data)
+	if roc != nil {
+		auth.Write(roc)
+	}
+	return auth.Sum(nil)[:authTagLen]
+}
+
+// EncryptRTP encrypts a marshaled RTP packet and appends the auth tag.
+func (c *Context) EncryptRTP(packet []byte) ([]byte, error) {
+	headerLen, err := rtpHeaderSize(packet)
+	if err != nil {
+		return nil, err
+	}
+	ssrc := binary.BigEndian.Uint32(packet[8:])
+	seq := binary.BigEndian.Uint16(packet[2:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.rtpState(ssrc)
+	roc := s.estimateRoc(seq)
+	s.update(roc, seq)
+
+	out := make([]byte, len(packet), len(packet)+authTagLen)
+	copy(out, packet[:headerLen])
+	iv := counter(c.rtpSalt, ssrc, uint64(roc)<<16|uint64(seq))
+	cipher.NewCTR(c.rtpBlock, iv).XORKeyStream(out[headerLen:], packet[headerLen:])
+
+	var rocBytes [4]byte
+	binary.BigEndian.PutUint32(rocBytes[:], roc)
+	return append(out, authTag(c.rtpAuth, out, rocBytes[:])...), nil
+}
+
+// DecryptRTP authenticates and decrypts a SRTP packet, replayed packets are rejected.
+func (c *Context) DecryptRTP(packet []byte) ([]byte, error) {
+	if len(packet) < rtpHeaderLen+authTagLen {
+		return nil, ErrTooShort
+	}
+	body, tag := packet[:len(packet)-authTagLen], packet[len(packet)-authTagLen:]
+	headerLen, err := rtpHeaderSize(body)
+	if err != nil {
+		return nil, err
+	}
+	ssrc := binary.BigEndian.Uint32(body[8:])
+	seq := binary.BigEndian.Uint16(body[2:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.rtpState(ssrc)
+	roc := s.estimateRoc(seq)
+	index := uint64(roc)<<16 | uint64(seq)
+	if !s.replay.check(index) {
+		return nil, ErrReplayed
+	}
+
+	var rocBytes [4]byte
+	binary.BigEndian.PutUint32(rocBytes[:], roc)
+	if subtle.ConstantTimeCompare(authTag(c.rtpAuth, body, rocBytes[:]), tag) != 1 {
+		return nil, ErrAuthFailed
+	}
+
+	out := make([]byte, len(body))
+	copy(out, body[:headerLen])
+	cipher.NewCTR(c.rtpBlock, counter(c.rtpSalt, ssrc, index)).XORKeyStream(out[headerLen:], body[headerLen:])
+
+	s.replay.accept(index)
+	s.update(roc, seq)
+	return out, nil
+}
+
+func (c *Context) rtcpState(ssrc uint32) *rtcpState {
+	s, ok := c.rtcpStates[ssrc]
+	if !ok {
+		s = &rtcpState{}
+		c.rtcpStates[ssrc] = s
+	}
+	return s
+}
+
+// EncryptRTCP encrypts a compound RTCP packet, rfc3711 3.4.
+func (c *Context) EncryptRTCP(packet []byte) ([]byte, error) {
+	if len(packet) < rtcpHeaderLen {
+		return nil, ErrTooShort
+	}
+	ssrc := binary.BigEndian.Uint32(packet[4:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.rtcpState(ssrc)
+	if s.index >= maxSrtcpIndex {
+		return nil, ErrIndexExceed
+	}
+	s.index++
+	index := s.index
+
+	out := make([]byte, len(packet), len(packet)+srtcpIndexLen+authTagLen)
+	copy(out, packet[:rtcpHeaderLen])
+	cipher.NewCTR(c.rtcpBlock, counter(c.rtcpSalt, ssrc, uint64(index))).XORKeyStream(out[rtcpHeaderLen:], packet[rtcpHeaderLen:])
+
+	var e [srtcpIndexLen]byte
+	binary.BigEndian.PutUint32(e[:], srtcpEncrypted|index)
+	out = append(out, e[:]...)
+	return append(out, authTag(c.rtcpAuth, out, nil)...), nil
+}
+
+// DecryptRTCP authenticates and decrypts a SRTCP packet.
+func (c *Context) DecryptRTCP(packet []byte) ([]byte, error) {
+	if len(packet) < rtcpHeaderLen+srtcpIndexLen+authTagLen {
+		return nil, ErrTooShort
+	}
+	body, tag := packet[:len(packet)-authTagLen], packet[len(packet)-authTagLen:]
+	e := binary.BigEndian.Uint32(body[len(body)-srtcpIndexLen:])
+	index := e &^ srtcpEncrypted
+	ssrc := binary.BigEndian.Uint32(body[4:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.rtcpState(ssrc)
+	if !s.replay.check(uint64(index)) {
+		return nil, ErrReplayed
+	}
+	if subtle.ConstantTimeCompare(authTag(c.rtcpAuth, body, nil), tag) != 1 {
+		return nil, ErrAuthFailed
+	}
+
+	body = body[:len(body)-srtcpIndexLen]
+	out := make([]byte, len(body))
+	copy(out, body)
+	if e&srtcpEncrypted != 0 {
+		cipher.NewCTR(c.rtcpBlock, counter(c.rtcpSalt, ssrc, uint64(index))).XORKeyStream(out[rtcpHeaderLen:], body[rtcpHeaderLen:])
+	}
+	s.replay.accept(uint64(index))
+	return out, nil
+}
@@ -0,0 +1,185 @@
+package srtp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// rfc3711 B.2 AES-CM test vectors.
+func TestKeystream(t *testing.T) {
+	block, err := aes.NewCipher(unhex(t, "2B7E151628AED2A6ABF7158809CF4F3C"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := counter(unhex(t, "F0F1F2F3F4F5F6F7F8F9FAFBFCFD"), 0, 0)
+	if !bytes.Equal(iv, unhex(t, "F0F1F2F3F4F5F6F7F8F9FAFBFCFD0000")) {
+		t.Fatalf("counter got %x", iv)
+	}
+	out := make([]byte, 48)
+	cipher.NewCTR(block, iv).XORKeyStream(out, out)
+	want := unhex(t, "E03EAD0935C95E80E166B16DD92B4EB4D23513162B02D0F72A43A2FE4A5F97AB41E95B3BB0A2E8DD477901E4FCA894C0")
+	if !bytes.Equal(out, want) {
+		t.Errorf("keystream got %x", out)
+	}
+}
+
+// rfc3711 B.3 key derivation test vectors.
+func TestDeriveKey(t *testing.T) {
+	key := unhex(t, "E1F97A0D3E018BE0D64FA32C06DE4139")
+	salt := unhex(t, "0EC675AD498AFEEBB6960B3AABE6")
+	cases := []struct {
+		label byte
+		n     int
+		want  string
+	}{
+		{labelRTPEncryption, KeyLen, "C61E7A93744F39EE10734AFE3FF7A087"},
+		{labelRTPSalt, SaltLen, "30CBBC08863D8C85D49DB34A9AE1"},
+		{labelRTPAuth, authKeyLen, "CEBE321F6FF7716B6FD4AB49AF256A156D38BAA4"},
+	}
+	for _, c := range cases {
+		got, err := deriveKey(key, salt, c.label, c.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, unhex(t, c.want)) {
+			t.Errorf("label %d got %x, want %s", c.label, got, c.want)
+		}
+	}
+}
+
+func testContext(t *testing.T) *Context {
+	c, err := CreateContext(unhex(t, "E1F97A0D3E018BE0D64FA32C06DE4139"), unhex(t, "0EC675AD498AFEEBB6960B3AABE6"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRTP(t *testing.T) {
+	packet := unhex(t, "80601234decafbadcafebabeabababab")
+	want := unhex(t, "80601234decafbadcafebabe4e55dc4cff4654888354dd4feaf3")
+
+	encrypted, err := testContext(t).EncryptRTP(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encrypted, want) {
+		t.Fatalf("EncryptRTP got %x, want %x", encrypted, want)
+	}
+
+	rx := testContext(t)
+	decrypted, err := rx.DecryptRTP(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, packet) {
+		t.Errorf("DecryptRTP got %x, want %x", decrypted, packet)
+	}
+	if _, err := rx.DecryptRTP(encrypted); err != ErrReplayed {
+		t.Errorf("replay got %v", err)
+	}
+
+	tampered := append([]byte{}, encrypted...)
+	tampered[3]++
+	if _, err := rx.DecryptRTP(tampered); err != ErrAuthFailed {
+		t.Errorf("tampered got %v", err)
+	}
+}
+
+// 序号回绕时roc要加一, 乱序的旧包用旧roc.
+func TestRolloverCounter(t *testing.T) {
+	tx, rx := testContext(t), testContext(t)
+	var packets [][]byte
+	for _, seq := range []uint16{65534, 65535, 0, 1} {
+		p := []byte{0x80, 0x60, byte(seq >> 8), byte(seq), 0, 0, 0, 1, 0xca, 0xfe, 0xba, 0xbe, 1, 2, 3, 4}
+		encrypted, err := tx.EncryptRTP(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, encrypted)
+	}
+	for _, i := range []int{0, 2, 1, 3} {
+		if _, err := rx.DecryptRTP(packets[i]); err != nil {
+			t.Fatalf("packet %d: %v", i, err)
+		}
+	}
+	if s := rx.rtpStates[0xcafebabe]; s.roc != 1 || s.seq != 1 {
+		t.Errorf("roc got %d seq %d", s.roc, s.seq)
+	}
+}
+
+func TestRTCP(t *testing.T) {
+	packet := unhex(t, "80c80006cafebabe0102030405060708090a0b0c0d0e0f101112131415161718")
+	want := unhex(t, "80c80006cafebabedb81abf44a2a151e1c5930e65fd201136f56003ed4023a3f80000001ddfcc32474c200fb2841")
+
+	encrypted, err := testContext(t).EncryptRTCP(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encrypted, want) {
+		t.Fatalf("EncryptRTCP got %x, want %x", encrypted, want)
+	}
+
+	rx := testContext(t)
+	decrypted, err := rx.DecryptRTCP(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, packet) {
+		t.Errorf("DecryptRTCP got %x, want %x", decrypted, packet)
+	}
+	if _, err := rx.DecryptRTCP(encrypted); err != ErrReplayed {
+		t.Errorf("replay got %v", err)
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	var w replayWindow
+	for _, i := range []uint64{100, 98, 200, 150} {
+		if !w.check(i) {
+			t.Fatalf("%d should be accepted", i)
+		}
+		w.accept(i)
+	}
+	for _, i := range []uint64{100, 98, 200, 150, 136} {
+		if w.check(i) {
+			t.Errorf("%d should be rejected", i)
+		}
+	}
+	if !w.check(137) || !w.check(199) {
+		t.Error("packets in window should be accepted")
+	}
+}
+
+func TestCrypto(t *testing.T) {
+	c, err := ParseCrypto("1 AES_CM_128_HMAC_SHA1_80 inline:4fl6DT4Bi+DWT6MsBt5BOQ7Gda1Jiv7rtpYLOqvm|2^31|1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Tag != 1 || !c.Supported() {
+		t.Fatalf("got %+v", c)
+	}
+	if !bytes.Equal(c.Key, unhex(t, "E1F97A0D3E018BE0D64FA32C06DE4139")) || !bytes.Equal(c.Salt, unhex(t, "0EC675AD498AFEEBB6960B3AABE6")) {
+		t.Errorf("key got %x salt %x", c.Key, c.Salt)
+	}
+	if c.String() != "1 AES_CM_128_HMAC_SHA1_80 inline:4fl6DT4Bi+DWT6MsBt5BOQ7Gda1Jiv7rtpYLOqvm" {
+		t.Errorf("String got %s", c.String())
+	}
+
+	for _, v := range []string{"", "x AES_CM_128_HMAC_SHA1_80 inline:AAAA", "1 AES_CM_128_HMAC_SHA1_80 key:AAAA", "1 AES_CM_128_HMAC_SHA1_80 inline:AAAA"} {
+		if _, err := ParseCrypto(v); err == nil {
+			t.Errorf("%q should be invalid", v)
+		}
+	}
+}
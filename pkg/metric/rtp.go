@@ -0,0 +1,85 @@
+package metric
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+var rtpLabels = []string{"session", "media"}
+
+var (
+	rtpPacketsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "xmediaEmu", Subsystem: "rtp", Name: "packets_sent",
+		Help: "Number of rtp packets sent by the session.",
+	}, rtpLabels)
+	rtpOctetsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "xmediaEmu", Subsystem: "rtp", Name: "octets_sent",
+		Help: "Number of rtp payload octets sent by the session.",
+	}, rtpLabels)
+	rtpPacketsLost = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "xmediaEmu", Subsystem: "rtp", Name: "packets_lost",
+		Help: "Cumulative packets lost reported by the peer.",
+	}, rtpLabels)
+	rtpFractionLost = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "xmediaEmu", Subsystem: "rtp", Name: "fraction_lost",
+		Help: "Fraction of packets lost in the last report interval, 0-1.",
+	}, rtpLabels)
+	rtpJitter = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "xmediaEmu", Subsystem: "rtp", Name: "jitter_seconds",
+		Help: "Interarrival jitter reported by the peer.",
+	}, rtpLabels)
+	rtpRtt = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "xmediaEmu", Subsystem: "rtp", Name: "rtt_seconds",
+		Help: "Round trip time computed from rtcp reports.",
+	}, rtpLabels)
+)
+
+// counter只能累加, 记录上次上报的发送总数, 按差值累加.
+var (
+	rtpSentLock sync.Mutex
+	rtpSent     = map[[2]string]RtpStats{}
+)
+
+func init() {
+	prometheus.MustRegister(rtpPacketsSent, rtpOctetsSent, rtpPacketsLost, rtpFractionLost, rtpJitter, rtpRtt)
+}
+
+// RtpStats 一路rtp需要上报的统计.
+type RtpStats struct {
+	PacketsSent  uint32
+	OctetsSent   uint32
+	PacketsLost  uint32
+	FractionLost float64
+	Jitter       time.Duration
+	RTT          time.Duration
+}
+
+// ObserveRtp 更新会话media(video/audio)的rtp统计, 发送数为会话开始以来的总数.
+func ObserveRtp(session, media string, s RtpStats) {
+	key := [2]string{session, media}
+	rtpSentLock.Lock()
+	last := rtpSent[key]
+	rtpSent[key] = s
+	rtpSentLock.Unlock()
+	// uint32相减, 回绕后差值仍然正确.
+	rtpPacketsSent.WithLabelValues(session, media).Add(float64(s.PacketsSent - last.PacketsSent))
+	rtpOctetsSent.WithLabelValues(session, media).Add(float64(s.OctetsSent - last.OctetsSent))
+	rtpPacketsLost.WithLabelValues(session, media).Set(float64(s.PacketsLost))
+	rtpFractionLost.WithLabelValues(session, media).Set(s.FractionLost)
+	rtpJitter.WithLabelValues(session, media).Set(s.Jitter.Seconds())
+	rtpRtt.WithLabelValues(session, media).Set(s.RTT.Seconds())
+}
+
+// DeleteRtp 会话结束后删除, 避免label无限增长.
+func DeleteRtp(session, media string) {
+	rtpSentLock.Lock()
+	delete(rtpSent, [2]string{session, media})
+	rtpSentLock.Unlock()
+	for _, vec := range []*prometheus.CounterVec{rtpPacketsSent, rtpOctetsSent} {
+		vec.DeleteLabelValues(session, media)
+	}
+	for _, vec := range []*prometheus.GaugeVec{rtpPacketsLost, rtpFractionLost, rtpJitter, rtpRtt} {
+		vec.DeleteLabelValues(session, media)
+	}
+}
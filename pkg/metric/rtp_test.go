@@ -0,0 +1,37 @@
+package metric
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// 发送总数按差值累加到counter, 删除后重新计数.
+func TestObserveRtpCounters(t *testing.T) {
+	ObserveRtp("s1", "video", RtpStats{PacketsSent: 10, OctetsSent: 1000})
+	ObserveRtp("s1", "video", RtpStats{PacketsSent: 15, OctetsSent: 1500, PacketsLost: 2})
+	if got := testutil.ToFloat64(rtpPacketsSent.WithLabelValues("s1", "video")); got != 15 {
+		t.Fatalf("packets sent %v", got)
+	}
+	if got := testutil.ToFloat64(rtpOctetsSent.WithLabelValues("s1", "video")); got != 1500 {
+		t.Fatalf("octets sent %v", got)
+	}
+	if got := testutil.ToFloat64(rtpPacketsLost.WithLabelValues("s1", "video")); got != 2 {
+		t.Fatalf("packets lost %v", got)
+	}
+
+	// uint32回绕.
+	ObserveRtp("s1", "audio", RtpStats{PacketsSent: 1<<32 - 2})
+	ObserveRtp("s1", "audio", RtpStats{PacketsSent: 3})
+	if got := testutil.ToFloat64(rtpPacketsSent.WithLabelValues("s1", "audio")); got != 1<<32+3 {
+		t.Fatalf("wrapped packets sent %v", got)
+	}
+
+	DeleteRtp("s1", "video")
+	ObserveRtp("s1", "video", RtpStats{PacketsSent: 4})
+	if got := testutil.ToFloat64(rtpPacketsSent.WithLabelValues("s1", "video")); got != 4 {
+		t.Fatalf("packets sent after delete %v", got)
+	}
+	DeleteRtp("s1", "video")
+	DeleteRtp("s1", "audio")
+}